@@ -1,6 +1,8 @@
 package main
 
 import(
+	"bufio"
+	"bytes"
 	"time"
 	"net"
 	"sync"
@@ -8,80 +10,385 @@ import(
 	"strconv"
 	"errors"
 	"os"
+	"math"
+	"io/ioutil"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"encoding/binary"
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"golang.org/x/sys/unix"
+
+	log "github.com/cihub/seelog"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalPointMap map[string]int
+//Point value, keeps integer type until a float value is added
+type Value struct {
+	IsFloat bool                //Is float value or not
+	Int int64                   //Integer value
+	Float float64               //Float value
+}
 
-var GlobalMutex sync.Mutex
+//Application point
+type Point struct {
+	Key string                  //Point key
+	Tags map[string]string      //Point tags
+	Value Value                 //Point value
+}
 
-func initUdp(addr string) error {
-	udpAddress, err := net.ResolveUDPAddr("udp4", addr)
+//Aggregation shard, points are spread into shards by id to reduce lock contention
+type Shard struct {
+	mutex sync.Mutex            //Mutex to protect points
+	points map[string]*Point    //Points map, key is the point id
+}
 
-	if err != nil {
-		return errors.New("Resolve udp addr failed! udp address:" + addr)
+var GlobalShards []*Shard
+
+//Max datagram size or max line size of stream
+var GlobalMaxDatagramSize int
+
+//Number of reader goroutines of each datagram socket
+var GlobalReaders int
+
+//Malformed points, truncated packets and dropped packets count since last collect, accessed atomically
+var GlobalMalformedCount uint64
+var GlobalTruncatedCount uint64
+var GlobalDroppedCount uint64
+
+//Unix domain socket file mode and owner
+var GlobalUnixMode os.FileMode
+var GlobalUnixUid int
+var GlobalUnixGid int
+
+//Attach sender's pid, uid and process name as tags to points from unix domain sockets
+var GlobalUnixCredentials bool
+
+//Uids allowed to report via unix domain sockets, empty means all uids are allowed
+var GlobalUnixAllowedUids map[uint32]bool
+
+//Process names cache, cleared on each collect to avoid reusing a stale name of a reused pid
+var GlobalProcessNames map[int32]string
+var GlobalProcessNamesMutex sync.Mutex
+
+//Packets and stream connections rejected since last collect because of uid not allowed, accessed atomically
+var GlobalRejectedCount uint64
+
+//Parse point, the formats below are supported:
+//    key|value
+//    key|value|#tag1:value1,tag2:value2    (DogStatsD style tags)
+//    key,tag1=value1,tag2=value2|value     (InfluxDB line protocol style tags)
+func parsePoint(text string) (*Point, error) {
+	parts := strings.Split(text, "|")
+
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, errors.New("Point format error! point:" + text)
 	}
 
-	udpConn, err := net.ListenUDP("udp4", udpAddress)
+	keys := strings.Split(parts[0], ",")
 
-	if err != nil {
-		return errors.New("Listen udp addr failed! error:" + err.Error())
+	if len(keys[0]) == 0 {
+		return nil, errors.New("Point key empty! point:" + text)
+	}
+
+	point := &Point{
+		Key: keys[0],
+		Tags: make(map[string]string),
+	}
+
+	for _, tag := range keys[1:] {
+		err := addTag(point.Tags, tag, "=")
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = udpConn.SetReadBuffer(16 * 1024 * 1024)
+	value, err := parseValue(parts[1])
 
 	if err != nil {
-		return errors.New("Set read buffer 16M failed! error:" + err.Error())
+		return nil, errors.New("Point value error! point:" + text)
 	}
 
-	go func (conn *net.UDPConn) {
-		data := make([]byte, 4096)
+	point.Value = value
 
-		for {
-			read, _, err := conn.ReadFromUDP(data)
+	if len(parts) == 3 {
+		if !strings.HasPrefix(parts[2], "#") {
+			return nil, errors.New("Point tags error! point:" + text)
+		}
+
+		for _, tag := range strings.Split(parts[2][1:], ",") {
+			err := addTag(point.Tags, tag, ":")
 
 			if err != nil {
-				continue
+				return nil, err
 			}
+		}
+	}
 
-			point := strings.Split(string(data[:read]), "|")
+	//The tag of internal metrics is reserved, so user points never mix with them
+	if point.Tags["type"] == "internal" {
+		return nil, errors.New("Point tag 'type:internal' is reserved! point:" + text)
+	}
 
-			if len(point) != 2 {
-				continue
-			}
+	return point, nil
+}
 
-			key := point[0]
-			value, err := strconv.Atoi(point[1])
+//Parse value, integer is preferred and float is used if the value is not an integer
+func parseValue(text string) (Value, error) {
+	intValue, err := strconv.ParseInt(text, 10, 64)
 
-			if err != nil {
-				continue
-			}
+	if err == nil {
+		return Value{Int: intValue}, nil
+	}
+
+	floatValue, err := strconv.ParseFloat(text, 64)
+
+	if err != nil {
+		return Value{}, err
+	}
+
+	//NaN and Inf could not be written by the output plugins
+	if math.IsNaN(floatValue) || math.IsInf(floatValue, 0) {
+		return Value{}, errors.New("Value should be finite! value:" + text)
+	}
+
+	return Value{IsFloat: true, Float: floatValue}, nil
+}
+
+//Add another value, the result turns to float if any of the values is float
+func (value *Value) Add(other Value) {
+	if !value.IsFloat && !other.IsFloat {
+		value.Int += other.Int
+		return
+	}
+
+	if !value.IsFloat {
+		value.IsFloat = true
+		value.Float = float64(value.Int)
+		value.Int = 0
+	}
+
+	if other.IsFloat {
+		value.Float += other.Float
+	} else {
+		value.Float += float64(other.Int)
+	}
+}
+
+//Get the value as int64 or float64
+func (value *Value) Interface() interface{} {
+	if value.IsFloat {
+		return value.Float
+	}
+
+	return value.Int
+}
+
+//Add tag in 'name<separator>value' style to tags
+func addTag(tags map[string]string, tag string, separator string) error {
+	pair := strings.SplitN(tag, separator, 2)
+
+	if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+		return errors.New("Tag format error! tag:" + tag)
+	}
+
+	tags[pair[0]] = pair[1]
+
+	return nil
+}
+
+//Get the aggregation id of the point, points with the same key and tag set share the same id
+func (point *Point) Id() string {
+	names := make([]string, 0, len(point.Tags))
+
+	for name := range point.Tags {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	id := point.Key
+
+	for _, name := range names {
+		id += "," + name + "=" + point.Tags[name]
+	}
+
+	return id
+}
+
+//Get the shard of the point id using FNV-1a hash
+func getShard(id string) *Shard {
+	hash := uint32(2166136261)
+
+	for index := 0; index < len(id); index++ {
+		hash ^= uint32(id[index])
+		hash *= 16777619
+	}
+
+	return GlobalShards[hash % uint32(len(GlobalShards))]
+}
+
+//Add point to the shard it belongs to
+func addPoint(point *Point) {
+	id := point.Id()
+	shard := getShard(id)
+
+	shard.mutex.Lock()
+
+	oldPoint, ok := shard.points[id]
+
+	if !ok {
+		shard.points[id] = point
+	} else {
+		oldPoint.Value.Add(point.Value)
+	}
+
+	shard.mutex.Unlock()
+}
+
+//Swap out all points of the shard, the shard is locked only during the swap
+func (shard *Shard) swap() map[string]*Point {
+	shard.mutex.Lock()
+
+	points := shard.points
+	shard.points = make(map[string]*Point, len(points))
+
+	shard.mutex.Unlock()
+
+	return points
+}
+
+//Add points from text, points are separated by new line, extra tags are attached to each point
+func addPoints(text string, tags map[string]string) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+
+		if len(line) == 0 {
+			continue
+		}
+
+		point, err := parsePoint(line)
+
+		if err != nil {
+			atomic.AddUint64(&GlobalMalformedCount, 1)
+			continue
+		}
+
+		for name, value := range tags {
+			point.Tags[name] = value
+		}
+
+		addPoint(point)
+	}
+}
 
-			GlobalMutex.Lock()
+//Add points from datagram, if the datagram is truncated only the complete lines are added
+func addDatagram(data []byte, flags int, tags map[string]string) {
+	if flags & syscall.MSG_TRUNC != 0 {
+		atomic.AddUint64(&GlobalTruncatedCount, 1)
 
-			oldValue, ok := GlobalPointMap[key]
+		index := bytes.LastIndexByte(data, '\n')
 
-			if !ok {
-				GlobalPointMap[key] = value
-			} else {
-				GlobalPointMap[key] = oldValue + value
+		if index < 0 {
+			return
+		}
+
+		data = data[:index]
+	}
+
+	addPoints(string(data), tags)
+}
+
+//Read points from stream connection, points are separated by new line, a line longer than max size is counted as truncated and skipped
+func readStream(conn net.Conn, tags map[string]string) {
+	defer conn.Close()
+
+	bufferSize := 4096
+
+	if GlobalMaxDatagramSize < bufferSize {
+		bufferSize = GlobalMaxDatagramSize
+	}
+
+	reader := bufio.NewReaderSize(conn, bufferSize)
+
+	line := []byte{}
+	tooLong := false
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+
+		if !tooLong {
+			line = append(line, chunk...)
+
+			if len(bytes.TrimRight(line, "\r\n")) > GlobalMaxDatagramSize {
+				tooLong = true
+				line = line[:0]
 			}
+		}
 
-			GlobalMutex.Unlock()
+		//The line is longer than the buffer, continue reading the rest of it
+		if err == bufio.ErrBufferFull {
+			continue
 		}
 
-	}(udpConn)
+		if tooLong {
+			atomic.AddUint64(&GlobalTruncatedCount, 1)
+		} else if len(line) != 0 {
+			addPoints(string(line), tags)
+		}
 
-	return nil
+		line = line[:0]
+		tooLong = false
+
+		if err != nil {
+			return
+		}
+	}
 }
 
-func initUnix(addr string) error {
-	//Remove if unix domain socket exist
+//Accept stream connections, the peer credentials of unix domain socket connections are checked if peerCred is true
+func acceptStream(listener net.Listener, peerCred bool) {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			log.Warnf("Accept on %s failed! error:%s", listener.Addr(), err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if !peerCred {
+			go readStream(conn, nil)
+			continue
+		}
+
+		credentials, err := getPeerCredentials(conn)
+
+		if err != nil {
+			atomic.AddUint64(&GlobalRejectedCount, 1)
+			conn.Close()
+			continue
+		}
+
+		tags, ok := checkCredentials(credentials)
+
+		if !ok {
+			atomic.AddUint64(&GlobalRejectedCount, 1)
+			conn.Close()
+			continue
+		}
+
+		go readStream(conn, tags)
+	}
+}
+
+//Remove unix domain socket file if exist
+func removeUnixSocketFile(addr string) error {
 	_, err := os.Stat(addr)
 
 	if err == nil {
@@ -92,69 +399,380 @@ func initUnix(addr string) error {
 		}
 	}
 
-	unixAddr, err := net.ResolveUnixAddr("unixgram", addr)
+	return nil
+}
+
+//Set unix domain socket file mode and owner
+func setUnixSocketFileMode(addr string) error {
+	//Change unix domain socket file mode
+	err := os.Chmod(addr, GlobalUnixMode)
 
-	if nil != err {
-		return errors.New("Resolve unix addr failed! unix address:" + addr)
+	if err != nil {
+		return errors.New("Chmod on " + addr + " failed! error:" + err.Error())
 	}
 
-	unixConn, err := net.ListenUnixgram("unixgram", unixAddr)
+	//Change unix domain socket file owner, default is nobody
+	err = os.Chown(addr, GlobalUnixUid, GlobalUnixGid)
 
-	if nil != err {
-		return errors.New("Listen unix addr failed! error:" + err.Error())
+	if err != nil {
+		return errors.New("Chown on " + addr + " failed! error:" + err.Error())
 	}
 
-	//Change unix domain socket file mode
-	err = os.Chmod(addr, 0777)
+	return nil
+}
+
+//Get dropped packets count of the socket from SO_RXQ_OVFL control message
+func parseDroppedCount(oob []byte) (uint32, bool) {
+	messages, err := syscall.ParseSocketControlMessage(oob)
 
 	if err != nil {
-		return errors.New("Chmod on " + addr + " failed! error:" + err.Error())
+		return 0, false
 	}
 
-	//Change unix domain socket file to nobody
-	err = os.Chown(addr, 99, 99)
+	for _, message := range messages {
+		if message.Header.Level != syscall.SOL_SOCKET || message.Header.Type != syscall.SO_RXQ_OVFL {
+			continue
+		}
+
+		if len(message.Data) < 4 {
+			continue
+		}
+
+		//The counter is written by the kernel in host byte order
+		return binary.NativeEndian.Uint32(message.Data[:4]), true
+	}
+
+	return 0, false
+}
+
+//Listen udp address, set SO_REUSEPORT if several sockets will be bound to the same address
+func listenUdp(addr *net.UDPAddr, reusePort bool) (*net.UDPConn, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM | syscall.SOCK_CLOEXEC, syscall.IPPROTO_UDP)
 
 	if err != nil {
-		return errors.New("Chown on " + addr + " failed! error:" + err.Error())
+		return nil, errors.New("Create udp socket failed! error:" + err.Error())
 	}
 
-	go func (conn *net.UnixConn) {
-		data := make([]byte, 4096)
+	if reusePort {
+		err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1)
 
-		for {
-			read, err := conn.Read(data)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, errors.New("Set SO_REUSEPORT failed! error:" + err.Error())
+		}
+	}
 
-			if err != nil {
-				continue
-			}
+	//Receive dropped packets count with each packet
+	err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RXQ_OVFL, 1)
+
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.New("Set SO_RXQ_OVFL failed! error:" + err.Error())
+	}
 
-			point := strings.Split(string(data[:read]), "|")
+	sockAddr := &syscall.SockaddrInet4{Port: addr.Port}
 
-			if len(point) != 2 {
-				continue
-			}
+	if addr.IP != nil {
+		copy(sockAddr.Addr[:], addr.IP.To4())
+	}
 
-			key := point[0]
-			value, err := strconv.Atoi(point[1])
+	err = syscall.Bind(fd, sockAddr)
 
-			if err != nil {
-				continue
-			}
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.New("Bind udp addr failed! error:" + err.Error())
+	}
+
+	file := os.NewFile(uintptr(fd), "udp:" + addr.String())
+	defer file.Close()
 
-			GlobalMutex.Lock()
+	conn, err := net.FilePacketConn(file)
 
-			oldValue, ok := GlobalPointMap[key]
+	if err != nil {
+		return nil, errors.New("Listen udp addr failed! error:" + err.Error())
+	}
+
+	return conn.(*net.UDPConn), nil
+}
+
+//Read datagrams from udp socket
+func readUdp(conn *net.UDPConn) {
+	data := make([]byte, GlobalMaxDatagramSize)
+	oob := make([]byte, syscall.CmsgSpace(4))
+
+	var dropped uint32
+
+	for {
+		read, oobRead, flags, _, err := conn.ReadMsgUDP(data, oob)
 
-			if !ok {
-				GlobalPointMap[key] = value
-			} else {
-				GlobalPointMap[key] = oldValue + value
+		if err != nil {
+			continue
+		}
+
+		if oobRead > 0 {
+			count, ok := parseDroppedCount(oob[:oobRead])
+
+			if ok && count != dropped {
+				atomic.AddUint64(&GlobalDroppedCount, uint64(count - dropped))
+				dropped = count
 			}
+		}
 
-			GlobalMutex.Unlock()
+		addDatagram(data[:read], flags, nil)
+	}
+}
+
+func initUdp(addr string) error {
+	udpAddress, err := net.ResolveUDPAddr("udp4", addr)
+
+	if err != nil {
+		return errors.New("Resolve udp addr failed! udp address:" + addr)
+	}
+
+	//Each reader has its own socket bound to the same address, the kernel balances packets between them
+	for index := 0; index < GlobalReaders; index++ {
+		udpConn, err := listenUdp(udpAddress, GlobalReaders > 1)
+
+		if err != nil {
+			return err
 		}
 
-	}(unixConn)
+		err = udpConn.SetReadBuffer(16 * 1024 * 1024)
+
+		if err != nil {
+			return errors.New("Set read buffer 16M failed! error:" + err.Error())
+		}
+
+		go readUdp(udpConn)
+	}
+
+	return nil
+}
+
+//Get process name from /proc/<pid>/comm
+func getProcessName(pid int32) string {
+	GlobalProcessNamesMutex.Lock()
+	defer GlobalProcessNamesMutex.Unlock()
+
+	name, ok := GlobalProcessNames[pid]
+
+	if ok {
+		return name
+	}
+
+	comm, err := ioutil.ReadFile("/proc/" + strconv.Itoa(int(pid)) + "/comm")
+
+	if err != nil {
+		name = "unknown"
+	} else {
+		name = strings.TrimSpace(string(comm))
+	}
+
+	GlobalProcessNames[pid] = name
+
+	return name
+}
+
+//Get sender credentials from SCM_CREDENTIALS control message
+func parseCredentials(oob []byte) (*syscall.Ucred, error) {
+	messages, err := syscall.ParseSocketControlMessage(oob)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range messages {
+		if message.Header.Level != syscall.SOL_SOCKET || message.Header.Type != syscall.SCM_CREDENTIALS {
+			continue
+		}
+
+		return syscall.ParseUnixCredentials(&message)
+	}
+
+	return nil, errors.New("Credentials not found")
+}
+
+//Get credentials of the process connected to the unix domain socket(stream) from SO_PEERCRED
+func getPeerCredentials(conn net.Conn) (*syscall.Ucred, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+
+	if !ok {
+		return nil, errors.New("Not a unix domain socket connection")
+	}
+
+	rawConn, err := unixConn.SyscallConn()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials *syscall.Ucred
+	var credentialsErr error
+
+	err = rawConn.Control(func(fd uintptr) {
+		credentials, credentialsErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials, credentialsErr
+}
+
+//Check the uid is allowed or not, returns the credential tags if they should be attached
+func checkCredentials(credentials *syscall.Ucred) (map[string]string, bool) {
+	if len(GlobalUnixAllowedUids) != 0 && !GlobalUnixAllowedUids[credentials.Uid] {
+		return nil, false
+	}
+
+	if !GlobalUnixCredentials {
+		return nil, true
+	}
+
+	return map[string]string{
+		"pid": strconv.Itoa(int(credentials.Pid)),
+		"uid": strconv.Itoa(int(credentials.Uid)),
+		"process_name": getProcessName(credentials.Pid),
+	}, true
+}
+
+//Listen unix domain socket(datagram), set SO_PASSCRED if sender credentials are needed
+func listenUnixgram(addr string, passCred bool) (*net.UnixConn, error) {
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_DGRAM | syscall.SOCK_CLOEXEC, 0)
+
+	if err != nil {
+		return nil, errors.New("Create unix socket failed! error:" + err.Error())
+	}
+
+	if passCred {
+		err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+
+		if err != nil {
+			syscall.Close(fd)
+			return nil, errors.New("Set SO_PASSCRED failed! error:" + err.Error())
+		}
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrUnix{Name: addr})
+
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.New("Listen unix addr failed! error:" + err.Error())
+	}
+
+	file := os.NewFile(uintptr(fd), "unixgram:" + addr)
+	defer file.Close()
+
+	conn, err := net.FilePacketConn(file)
+
+	if err != nil {
+		return nil, errors.New("Listen unix addr failed! error:" + err.Error())
+	}
+
+	return conn.(*net.UnixConn), nil
+}
+
+//Read datagrams from unix domain socket
+func readUnix(conn *net.UnixConn, passCred bool) {
+	data := make([]byte, GlobalMaxDatagramSize)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+
+	for {
+		read, oobRead, flags, _, err := conn.ReadMsgUnix(data, oob)
+
+		if err != nil {
+			continue
+		}
+
+		if !passCred {
+			addDatagram(data[:read], flags, nil)
+			continue
+		}
+
+		credentials, err := parseCredentials(oob[:oobRead])
+
+		if err != nil {
+			atomic.AddUint64(&GlobalRejectedCount, 1)
+			continue
+		}
+
+		tags, ok := checkCredentials(credentials)
+
+		if !ok {
+			atomic.AddUint64(&GlobalRejectedCount, 1)
+			continue
+		}
+
+		addDatagram(data[:read], flags, tags)
+	}
+}
+
+func initUnix(addr string) error {
+	//Remove if unix domain socket exist
+	err := removeUnixSocketFile(addr)
+
+	if err != nil {
+		return err
+	}
+
+	passCred := GlobalUnixCredentials || len(GlobalUnixAllowedUids) != 0
+
+	unixConn, err := listenUnixgram(addr, passCred)
+
+	if err != nil {
+		return err
+	}
+
+	err = setUnixSocketFileMode(addr)
+
+	if err != nil {
+		return err
+	}
+
+	for index := 0; index < GlobalReaders; index++ {
+		go readUnix(unixConn, passCred)
+	}
+
+	return nil
+}
+
+func initTcp(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return errors.New("Listen tcp addr failed! error:" + err.Error())
+	}
+
+	go acceptStream(listener, false)
+
+	return nil
+}
+
+func initUnixStream(addr string) error {
+	//Remove if unix domain socket exist
+	err := removeUnixSocketFile(addr)
+
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("unix", addr)
+
+	if err != nil {
+		return errors.New("Listen unix stream addr failed! error:" + err.Error())
+	}
+
+	err = setUnixSocketFileMode(addr)
+
+	if err != nil {
+		return err
+	}
+
+	//Credentials of stream connections are read from SO_PEERCRED when accepted, the same uids are allowed as datagrams
+	peerCred := GlobalUnixCredentials || len(GlobalUnixAllowedUids) != 0
+
+	go acceptStream(listener, peerCred)
 
 	return nil
 }
@@ -164,13 +782,123 @@ func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalPointMap = make(map[string]int)
+	GlobalMaxDatagramSize = 65536
+	GlobalReaders = 1
+	shards := 16
+
+	maxDatagramSize, ok := config["max_datagram_size"]
+
+	if ok {
+		size, err := strconv.Atoi(maxDatagramSize)
+
+		if err != nil || size <= 0 {
+			return errors.New("Config 'max_datagram_size' error, should be a positive integer")
+		}
+
+		GlobalMaxDatagramSize = size
+	}
+
+	readers, ok := config["readers"]
+
+	if ok {
+		number, err := strconv.Atoi(readers)
+
+		if err != nil || number <= 0 {
+			return errors.New("Config 'readers' error, should be a positive integer")
+		}
+
+		GlobalReaders = number
+	}
+
+	shardsConfig, ok := config["shards"]
+
+	if ok {
+		number, err := strconv.Atoi(shardsConfig)
+
+		if err != nil || number <= 0 {
+			return errors.New("Config 'shards' error, should be a positive integer")
+		}
+
+		shards = number
+	}
+
+	GlobalUnixMode = 0777
+	GlobalUnixUid = 99
+	GlobalUnixGid = 99
+	GlobalUnixCredentials = false
+	GlobalUnixAllowedUids = make(map[uint32]bool)
+	GlobalProcessNames = make(map[int32]string)
+
+	unixMode, ok := config["unix_mode"]
+
+	if ok {
+		mode, err := strconv.ParseUint(unixMode, 8, 32)
+
+		if err != nil {
+			return errors.New("Config 'unix_mode' error, should be an octal file mode, e.g.:0660")
+		}
+
+		GlobalUnixMode = os.FileMode(mode)
+	}
+
+	unixOwner, ok := config["unix_owner"]
+
+	if ok {
+		owner := strings.Split(unixOwner, ":")
+
+		if len(owner) != 2 {
+			return errors.New("Config 'unix_owner' error, should be 'uid:gid', e.g.:99:99")
+		}
+
+		uid, err := strconv.Atoi(owner[0])
+
+		if err != nil {
+			return errors.New("Config 'unix_owner' error, uid should be an integer")
+		}
+
+		gid, err := strconv.Atoi(owner[1])
+
+		if err != nil {
+			return errors.New("Config 'unix_owner' error, gid should be an integer")
+		}
+
+		GlobalUnixUid = uid
+		GlobalUnixGid = gid
+	}
+
+	unixCredentials, ok := config["unix_credentials"]
+
+	if ok {
+		GlobalUnixCredentials = unixCredentials == "true"
+	}
+
+	unixAllowedUids, ok := config["unix_allowed_uids"]
+
+	if ok && len(unixAllowedUids) != 0 {
+		for _, allowedUid := range strings.Split(unixAllowedUids, ";") {
+			uid, err := strconv.ParseUint(allowedUid, 10, 32)
+
+			if err != nil {
+				return errors.New("Config 'unix_allowed_uids' error, should be uids separated by ';', e.g.:0;1000")
+			}
+
+			GlobalUnixAllowedUids[uint32(uid)] = true
+		}
+	}
+
+	GlobalShards = make([]*Shard, shards)
+
+	for index := range GlobalShards {
+		GlobalShards[index] = &Shard{points: make(map[string]*Point)}
+	}
 
 	udpAddr, udpAddrOk := config["udp_address"]
 	unixAddr, unixAddrOk := config["unix_address"]
+	tcpAddr, tcpAddrOk := config["tcp_address"]
+	unixStreamAddr, unixStreamAddrOk := config["unix_stream_address"]
 
-	if !udpAddrOk && !unixAddrOk {
-		return errors.New("Missing config 'udp_address' or 'unix_address'")
+	if !udpAddrOk && !unixAddrOk && !tcpAddrOk && !unixStreamAddrOk {
+		return errors.New("Missing config 'udp_address', 'unix_address', 'tcp_address' or 'unix_stream_address'")
 	}
 
 	if udpAddrOk {
@@ -189,6 +917,22 @@ func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 		}
 	}
 
+	if tcpAddrOk {
+		err := initTcp(tcpAddr)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if unixStreamAddrOk {
+		err := initUnixStream(unixStreamAddr)
+
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -198,21 +942,44 @@ func Collect()(*protocol.Proto, error) {
 	curTime := time.Now()
 	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
 
-	GlobalMutex.Lock()
-	defer GlobalMutex.Unlock()
+	//Swap out points shard by shard, so readers only wait for a map swap instead of the whole proto building
+	for _, shard := range GlobalShards {
+		points := shard.swap()
 
-	for pointKey, pointValue := range GlobalPointMap{
-		data := protocol.NewData()
-		data.Time = currentTime
+		for _, point := range points {
+			data := protocol.NewData()
+			data.Time = currentTime
 
-		data.Tag["node_name"] = GlobalNodeInfo.Name
-		data.Tag["node_ip"] = GlobalNodeInfo.IP
-		data.Field[pointKey] = pointValue
+			for name, value := range point.Tags {
+				data.Tag[name] = value
+			}
+
+			data.Tag["node_name"] = GlobalNodeInfo.Name
+			data.Tag["node_ip"] = GlobalNodeInfo.IP
+			data.Field[point.Key] = point.Value.Interface()
 
-		proto.DataList = append(proto.DataList, *data)
+			proto.DataList = append(proto.DataList, *data)
+		}
 	}
 
-	GlobalPointMap = make(map[string]int)
+	GlobalProcessNamesMutex.Lock()
+	GlobalProcessNames = make(map[int32]string)
+	GlobalProcessNamesMutex.Unlock()
+
+	//Internal metrics of the plugin itself are reported to the 'application_internal' measurement, so they are not listed as application instances
+	data := protocol.NewData()
+	data.Name = "internal"
+	data.Time = currentTime
+
+	data.Tag["node_name"] = GlobalNodeInfo.Name
+	data.Tag["node_ip"] = GlobalNodeInfo.IP
+	data.Tag["type"] = "internal"
+	data.Field["malformed_packets"] = atomic.SwapUint64(&GlobalMalformedCount, 0)
+	data.Field["truncated_packets"] = atomic.SwapUint64(&GlobalTruncatedCount, 0)
+	data.Field["dropped_packets"] = atomic.SwapUint64(&GlobalDroppedCount, 0)
+	data.Field["rejected_packets"] = atomic.SwapUint64(&GlobalRejectedCount, 0)
+
+	proto.DataList = append(proto.DataList, *data)
 
 	return proto, nil
 }
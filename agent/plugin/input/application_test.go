@@ -0,0 +1,604 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test application.go application_test.go
+//    go test -run NONE -bench . application.go application_test.go
+
+import(
+	"os"
+	"net"
+	"sync"
+	"time"
+	"reflect"
+	"strings"
+	"strconv"
+	"syscall"
+	"testing"
+	"sync/atomic"
+	"path/filepath"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Reset aggregation to the number of shards, 1 shard is the single mutex map before sharding
+func resetShards(shards int) {
+	GlobalShards = make([]*Shard, shards)
+
+	for index := range GlobalShards {
+		GlobalShards[index] = &Shard{points: make(map[string]*Point)}
+	}
+}
+
+//Reset aggregation and internal counters before each test
+func resetTest() {
+	resetShards(16)
+
+	GlobalMaxDatagramSize = 65536
+	GlobalProcessNames = make(map[int32]string)
+
+	atomic.StoreUint64(&GlobalMalformedCount, 0)
+	atomic.StoreUint64(&GlobalTruncatedCount, 0)
+	atomic.StoreUint64(&GlobalDroppedCount, 0)
+	atomic.StoreUint64(&GlobalRejectedCount, 0)
+}
+
+//Collect and split the data into points keyed by point id and the internal data
+func collectTest(t *testing.T) (map[string]interface{}, *protocol.Data) {
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := make(map[string]interface{})
+	var internal *protocol.Data
+
+	for index := range proto.DataList {
+		data := &proto.DataList[index]
+
+		if data.Name == "internal" {
+			internal = data
+			continue
+		}
+
+		for key, value := range data.Field {
+			point := &Point{Key: key, Tags: make(map[string]string)}
+
+			for name, tag := range data.Tag {
+				if name != "node_name" && name != "node_ip" {
+					point.Tags[name] = tag.(string)
+				}
+			}
+
+			points[point.Id()] = value
+		}
+	}
+
+	if internal == nil {
+		t.Fatal("internal data not reported")
+	}
+
+	return points, internal
+}
+
+func TestParsePoint(t *testing.T) {
+	tests := []struct {
+		text string
+		want *Point
+	}{
+		{"requests|1", &Point{Key: "requests", Tags: map[string]string{}, Value: Value{Int: 1}}},
+		{"latency|0.25", &Point{Key: "latency", Tags: map[string]string{}, Value: Value{IsFloat: true, Float: 0.25}}},
+		{"bytes|-9223372036854775808", &Point{Key: "bytes", Tags: map[string]string{}, Value: Value{Int: -9223372036854775808}}},
+		{"big|9223372036854775808", &Point{Key: "big", Tags: map[string]string{}, Value: Value{IsFloat: true, Float: 9223372036854775808}}},
+		//DogStatsD style tags
+		{"latency|12.5|#service:api,method:get", &Point{Key: "latency", Tags: map[string]string{"service": "api", "method": "get"}, Value: Value{IsFloat: true, Float: 12.5}}},
+		//InfluxDB line protocol style tags
+		{"requests,service=api,method=get|3", &Point{Key: "requests", Tags: map[string]string{"service": "api", "method": "get"}, Value: Value{Int: 3}}},
+		//Both styles, the DogStatsD style tag wins
+		{"requests,service=api|3|#service:web,url:a=b", &Point{Key: "requests", Tags: map[string]string{"service": "web", "url": "a=b"}, Value: Value{Int: 3}}},
+	}
+
+	for _, test := range tests {
+		point, err := parsePoint(test.text)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.text, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(point, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.text, point, test.want)
+		}
+	}
+
+	invalids := []string{
+		"requests",
+		"requests|",
+		"|1",
+		"requests|abc",
+		"requests|1|2",
+		"requests|1|service:api",
+		"requests|1|#service",
+		"requests|1|#service:",
+		"requests|1|#:api",
+		"requests,service|1",
+		"requests,=api|1",
+		"requests|NaN",
+		"requests|+Inf",
+		"requests|1|#a:b|c",
+		"requests|1|#type:internal",
+		"requests,type=internal|1",
+	}
+
+	for _, text := range invalids {
+		_, err := parsePoint(text)
+
+		if err == nil {
+			t.Errorf("%s: should fail", text)
+		}
+	}
+}
+
+func TestValueAdd(t *testing.T) {
+	tests := []struct {
+		values []Value
+		want interface{}
+	}{
+		{[]Value{{Int: 1}, {Int: 2}}, int64(3)},
+		{[]Value{{Int: 9223372036854775806}, {Int: 1}}, int64(9223372036854775807)},
+		//Integer turns to float once a float is added
+		{[]Value{{Int: 1}, {IsFloat: true, Float: 0.5}}, 1.5},
+		{[]Value{{IsFloat: true, Float: 0.5}, {Int: 2}}, 2.5},
+		{[]Value{{Int: 1}, {IsFloat: true, Float: 0.25}, {Int: 2}}, 3.25},
+	}
+
+	for _, test := range tests {
+		value := test.values[0]
+
+		for _, other := range test.values[1:] {
+			value.Add(other)
+		}
+
+		if value.Interface() != test.want {
+			t.Errorf("%+v: got %#v, want %#v", test.values, value.Interface(), test.want)
+		}
+	}
+}
+
+func TestAddDatagram(t *testing.T) {
+	resetTest()
+
+	//Batched points with the same key and tag set are summed up, tags in either style are the same tag set
+	addDatagram([]byte("requests|1\nrequests|2\r\nlatency,service=api|0.5\n\nlatency|0.25|#service:api\nbad|x\nrequests,type=internal|1\n"), 0, nil)
+	addDatagram([]byte("requests|4\nerrors|1"), 0, map[string]string{"pid": "100"})
+
+	//Truncated datagram keeps the complete lines only
+	addDatagram([]byte("requests|8\nrequests|1"), syscall.MSG_TRUNC, nil)
+	addDatagram([]byte("requests|16"), syscall.MSG_TRUNC, nil)
+
+	points, internal := collectTest(t)
+
+	want := map[string]interface{}{
+		"requests": int64(11),
+		"latency,service=api": 0.75,
+		"requests,pid=100": int64(4),
+		"errors,pid=100": int64(1),
+	}
+
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("got %v, want %v", points, want)
+	}
+
+	if internal.Field["malformed_packets"] != uint64(2) || internal.Field["truncated_packets"] != uint64(2) {
+		t.Errorf("got internal %v", internal.Field)
+	}
+
+	//Counters are reset by collect
+	points, internal = collectTest(t)
+
+	if len(points) != 0 || internal.Field["malformed_packets"] != uint64(0) || internal.Field["truncated_packets"] != uint64(0) {
+		t.Errorf("got %v and internal %v after collect", points, internal.Field)
+	}
+}
+
+//Internal metrics must not be in the application measurement, each field of it is listed as an application instance
+func TestCollectInternal(t *testing.T) {
+	resetTest()
+
+	addDatagram([]byte("requests|1\nbad|x"), 0, nil)
+	addDatagram([]byte("requests|2"), syscall.MSG_TRUNC, nil)
+	atomic.AddUint64(&GlobalDroppedCount, 3)
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto.Name = "application"
+
+	internals := map[string]bool{
+		"malformed_packets": true,
+		"truncated_packets": true,
+		"dropped_packets": true,
+		"rejected_packets": true,
+	}
+
+	fields := make(map[string]interface{})
+
+	for index := range proto.DataList {
+		data := &proto.DataList[index]
+		measurement := proto.Measurement(data)
+
+		switch measurement {
+		case "application":
+			for key := range data.Field {
+				if internals[key] {
+					t.Errorf("internal field %s is in the application measurement", key)
+				}
+			}
+
+			if data.Tag["type"] == "internal" {
+				t.Errorf("internal tag is in the application measurement")
+			}
+		case "application_internal":
+			for key, value := range data.Field {
+				fields[key] = value
+			}
+		default:
+			t.Errorf("unexpected measurement %s", measurement)
+		}
+	}
+
+	want := map[string]interface{}{
+		"malformed_packets": uint64(1),
+		"truncated_packets": uint64(1),
+		"dropped_packets": uint64(3),
+		"rejected_packets": uint64(0),
+	}
+
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got internal %v, want %v", fields, want)
+	}
+}
+
+//Write to a stream connection served by readStream, returns after readStream returns
+func readStreamTest(t *testing.T, writes []string) {
+	server, client := net.Pipe()
+	done := make(chan bool)
+
+	go func() {
+		readStream(server, nil)
+		close(done)
+	}()
+
+	for _, text := range writes {
+		_, err := client.Write([]byte(text))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readStream does not return after the connection is closed")
+	}
+}
+
+func TestReadStream(t *testing.T) {
+	resetTest()
+
+	GlobalMaxDatagramSize = 16
+
+	readStreamTest(t, []string{
+		//Exactly the max size
+		"exact|1234567890\n",
+		//Longer than the max size and the reader buffer, skipped and the connection is kept
+		"long|" + strings.Repeat("1", 40) + "\n",
+		"a|1\r\n",
+		//Line split by writes
+		"b|",
+		"2\nc|3\n",
+		"long,a=b|" + strings.Repeat("1", 10) + "\r\n",
+		//Partial line at EOF is added
+		"d|4",
+	})
+
+	points, internal := collectTest(t)
+
+	want := map[string]interface{}{
+		"exact": int64(1234567890),
+		"a": int64(1),
+		"b": int64(2),
+		"c": int64(3),
+		"d": int64(4),
+	}
+
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("got %v, want %v", points, want)
+	}
+
+	if internal.Field["truncated_packets"] != uint64(2) || internal.Field["malformed_packets"] != uint64(0) {
+		t.Errorf("got internal %v", internal.Field)
+	}
+
+	//Partial long line at EOF is counted as truncated too
+	readStreamTest(t, []string{"a|1\n", "long|" + strings.Repeat("1", 40)})
+
+	points, internal = collectTest(t)
+
+	if !reflect.DeepEqual(points, map[string]interface{}{"a": int64(1)}) || internal.Field["truncated_packets"] != uint64(1) {
+		t.Errorf("got %v and internal %v", points, internal.Field)
+	}
+}
+
+//The server side is closed when the client closes the connection
+func TestReadStreamClose(t *testing.T) {
+	resetTest()
+
+	server, client := net.Pipe()
+	done := make(chan bool)
+
+	go func() {
+		readStream(server, nil)
+		close(done)
+	}()
+
+	client.Write([]byte("a|1\n"))
+	client.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readStream does not return after the connection is closed")
+	}
+
+	_, err := server.Write([]byte("a|1\n"))
+
+	if err == nil {
+		t.Error("server side should be closed")
+	}
+}
+
+//Send a line to the unix stream listener and collect until the point or the rejection is counted
+func sendUnixStream(t *testing.T, address string, text string) (map[string]interface{}, *protocol.Data) {
+	conn, err := net.Dial("unix", address)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write([]byte(text))
+	conn.Close()
+
+	points := make(map[string]interface{})
+	var internal *protocol.Data
+
+	for retry := 0; retry < 100; retry++ {
+		time.Sleep(10 * time.Millisecond)
+
+		points, internal = collectTest(t)
+
+		if len(points) != 0 || internal.Field["rejected_packets"] != uint64(0) {
+			break
+		}
+	}
+
+	return points, internal
+}
+
+//The uids allowed and the credential tags apply to unix stream connections too
+func TestUnixStreamCredentials(t *testing.T) {
+	dir := t.TempDir()
+	owner := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+
+	//Current uid is not allowed
+	address := filepath.Join(dir, "rejected.sock")
+
+	err := Init(config.NodeInfo{Name: "test", IP: "127.0.0.1"}, map[string]string{
+		"unix_stream_address": address,
+		"unix_owner": owner,
+		"unix_allowed_uids": strconv.Itoa(os.Getuid() + 1),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, internal := sendUnixStream(t, address, "requests|1\n")
+
+	if len(points) != 0 || internal.Field["rejected_packets"] != uint64(1) {
+		t.Errorf("not allowed: got %v and internal %v", points, internal.Field)
+	}
+
+	//Current uid is allowed and tagged
+	address = filepath.Join(dir, "allowed.sock")
+
+	err = Init(config.NodeInfo{Name: "test", IP: "127.0.0.1"}, map[string]string{
+		"unix_stream_address": address,
+		"unix_owner": owner,
+		"unix_allowed_uids": "0;" + strconv.Itoa(os.Getuid()),
+		"unix_credentials": "true",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, internal = sendUnixStream(t, address, "requests|1\n")
+
+	point := &Point{Key: "requests", Tags: map[string]string{
+		"pid": strconv.Itoa(os.Getpid()),
+		"uid": strconv.Itoa(os.Getuid()),
+		"process_name": getProcessName(int32(os.Getpid())),
+	}}
+
+	if points[point.Id()] != int64(1) || internal.Field["rejected_packets"] != uint64(0) {
+		t.Errorf("allowed: got %v and internal %v, want %s", points, internal.Field, point.Id())
+	}
+}
+
+func BenchmarkParsePoint(b *testing.B) {
+	texts := []string{
+		"requests|1",
+		"latency|0.25|#service:api,method:get",
+		"requests,service=api,method=get|1",
+	}
+
+	for _, text := range texts {
+		b.Run(text, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for index := 0; index < b.N; index++ {
+				_, err := parsePoint(text)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+//Add points concurrently, each goroutine adds points of 64 keys like several readers
+func benchmarkAddPoint(b *testing.B, shards int) {
+	resetShards(shards)
+
+	points := make([]*Point, 64)
+
+	for index := range points {
+		points[index] = &Point{
+			Key: "key" + strconv.Itoa(index),
+			Tags: map[string]string{"service": "api"},
+			Value: Value{Int: 1},
+		}
+	}
+
+	var counter uint64
+
+	b.ReportAllocs()
+	b.SetParallelism(4)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			index := atomic.AddUint64(&counter, 1)
+			point := points[index % uint64(len(points))]
+
+			addPoint(&Point{Key: point.Key, Tags: point.Tags, Value: point.Value})
+		}
+	})
+}
+
+func BenchmarkAddPointSingleMutex(b *testing.B) {
+	benchmarkAddPoint(b, 1)
+}
+
+func BenchmarkAddPointShards(b *testing.B) {
+	benchmarkAddPoint(b, 16)
+}
+
+//Listeners started by the udp load benchmark, Init could not be called twice on the same address
+var udpListeners = make(map[string]bool)
+var udpListenersMutex sync.Mutex
+
+//Number of client sockets sending to the udp listener
+const UdpLoadClients = 64
+
+//Send points to a loopback udp listener as fast as possible, reports the rate of packets dropped by the kernel
+func benchmarkUdpLoad(b *testing.B, readers int) {
+	address := "127.0.0.1:" + strconv.Itoa(15700 + readers)
+
+	udpListenersMutex.Lock()
+
+	if !udpListeners[address] {
+		err := Init(config.NodeInfo{Name: "bench", IP: "127.0.0.1"}, map[string]string{
+			"udp_address": address,
+			"readers": strconv.Itoa(readers),
+		})
+
+		if err != nil {
+			udpListenersMutex.Unlock()
+			b.Fatal(err)
+		}
+
+		udpListeners[address] = true
+	}
+
+	udpListenersMutex.Unlock()
+
+	//SO_REUSEPORT balances packets by the 4-tuple, so packets are sent from many source ports like many clients
+	conns := make([]net.Conn, UdpLoadClients)
+
+	for index := range conns {
+		conn, err := net.Dial("udp", address)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		conns[index] = conn
+	}
+
+	Collect()
+
+	packet := []byte("requests,service=api|1\nlatency,service=api|0.5")
+
+	b.SetBytes(int64(len(packet)))
+	b.ResetTimer()
+
+	for index := 0; index < b.N; index++ {
+		conns[index % len(conns)].Write(packet)
+	}
+
+	b.StopTimer()
+
+	//Dropped count is received with the next packet of each socket, so markers are sent after the sockets are drained
+	time.Sleep(100 * time.Millisecond)
+
+	for _, conn := range conns {
+		conn.Write([]byte("marker|1"))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	proto, err := Collect()
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var received, dropped uint64
+
+	for _, data := range proto.DataList {
+		value, ok := data.Field["requests"]
+
+		if ok {
+			received += uint64(value.(int64))
+		}
+
+		value, ok = data.Field["dropped_packets"]
+
+		if ok {
+			dropped = value.(uint64)
+		}
+	}
+
+	b.ReportMetric(float64(received) / float64(b.N) * 100, "received%")
+	b.ReportMetric(float64(dropped) / float64(b.N) * 100, "dropped%")
+}
+
+func BenchmarkUdpLoad(b *testing.B) {
+	for _, readers := range []int{1, 4} {
+		b.Run("readers=" + strconv.Itoa(readers), func(b *testing.B) {
+			benchmarkUdpLoad(b, readers)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import(
+	"time"
+	"errors"
+	"strings"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+var GlobalFS *procfs.FS
+
+//Configured cgroup path patterns, all systemd slices and services are reported if empty
+var GlobalPaths []string
+
+//Cpu usage and time of last collect, used to calculate cpu percent
+var GlobalLastUsages map[string]uint64
+var GlobalLastTime time.Time
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalFS = procfs.NewFS(config["root_path"])
+
+	GlobalPaths = []string{}
+
+	for _, path := range strings.Split(config["paths"], ";") {
+		if len(path) == 0 {
+			continue
+		}
+
+		GlobalPaths = append(GlobalPaths, path)
+	}
+
+	GlobalLastUsages = make(map[string]uint64)
+	GlobalLastTime = time.Now()
+
+	_, err := getPaths()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+//Get cgroup paths to report, configured patterns are expanded every collect since cgroups come and go
+func getPaths() ([]string, error) {
+	if len(GlobalPaths) == 0 {
+		paths, err := GlobalFS.CgroupSystemdUnits()
+
+		if err != nil {
+			return nil, errors.New("List systemd units' cgroups failed! error:" + err.Error())
+		}
+
+		return paths, nil
+	}
+
+	paths := []string{}
+
+	for _, pattern := range GlobalPaths {
+		matches, err := GlobalFS.CgroupGlob(pattern)
+
+		if err != nil {
+			return nil, errors.New("List cgroups of '" + pattern + "' failed! error:" + err.Error())
+		}
+
+		paths = append(paths, matches...)
+	}
+
+	return paths, nil
+}
+
+func Collect()(*protocol.Proto, error) {
+	paths, err := getPaths()
+
+	if err != nil {
+		return nil, err
+	}
+
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	elapsed := uint64(curTime.Sub(GlobalLastTime) / time.Microsecond)
+
+	lastUsages := make(map[string]uint64)
+
+	for _, path := range paths {
+		//The cgroup may be removed after listed
+		stat, err := GlobalFS.CgroupStat(path)
+
+		if err != nil {
+			continue
+		}
+
+		lastUsages[path] = stat.CPUUsage
+
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["cgroup"] = path
+
+		data.Field["cpu_usage_usec"] = stat.CPUUsage
+		data.Field["cpu_user_usec"] = stat.CPUUser
+		data.Field["cpu_system_usec"] = stat.CPUSystem
+		data.Field["cpu_nr_periods"] = stat.NrPeriods
+		data.Field["cpu_nr_throttled"] = stat.NrThrottled
+		data.Field["cpu_throttled_usec"] = stat.ThrottledTime
+
+		data.Field["memory_current"] = stat.MemoryCurrent
+
+		if stat.MemoryMax != 0 {
+			data.Field["memory_max"] = stat.MemoryMax
+		}
+
+		for event, count := range stat.MemoryEvents {
+			data.Field["memory_events_" + event] = count
+		}
+
+		data.Field["io_read_bytes"] = stat.IOReadBytes
+		data.Field["io_write_bytes"] = stat.IOWriteBytes
+		data.Field["io_reads"] = stat.IOReads
+		data.Field["io_writes"] = stat.IOWrites
+
+		proto.DataList = append(proto.DataList, *data)
+
+		//Cpu percentage is a float, so it is reported to the 'cgroup_percent' measurement instead of mixing with the integer counters
+		lastUsage, ok := GlobalLastUsages[path]
+
+		if ok && elapsed != 0 && stat.CPUUsage >= lastUsage {
+			percentData := protocol.NewData()
+			percentData.Name = "percent"
+			percentData.Time = currentTime
+
+			percentData.Tag["node_name"] = GlobalNodeInfo.Name
+			percentData.Tag["node_ip"] = GlobalNodeInfo.IP
+			percentData.Tag["cgroup"] = path
+			percentData.Field["cpu_percent"] = float64(stat.CPUUsage - lastUsage) * 100 / float64(elapsed)
+
+			proto.DataList = append(proto.DataList, *percentData)
+		}
+	}
+
+	GlobalLastUsages = lastUsages
+	GlobalLastTime = curTime
+
+	return proto, nil
+}
@@ -6,57 +6,126 @@ import(
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
+var GlobalFS *procfs.FS
+
+//Report each cpu or not, default is true
+var GlobalPerCPU bool
+
+//Cpu times of last collect, key is "cpu" for total and "cpuN" for each cpu, used to calculate percentages
+var GlobalLastTimes map[string]procfs.CPUTimes
 
 func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
+	GlobalPerCPU = config["percpu"] != "false"
+	GlobalLastTimes = make(map[string]procfs.CPUTimes)
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	//Take the first sample, so the first collect reports percentages since now instead of since boot
+	stat, err := GlobalFS.Stat()
+
+	if err != nil {
+		return errors.New("Read stat failed! error:" + err.Error())
+	}
+
+	GlobalLastTimes[stat.Total.Name] = stat.Total
+
+	for _, times := range stat.CPUs {
+		GlobalLastTimes[times.Name] = times
 	}
 
 	return nil
 }
 
-func Collect()(*protocol.Proto, error) {
-	cpuStat := GlobalStat.CPUStats()
+//Calculate percentage of delta jiffies
+func percent(current uint64, last uint64, total uint64) float64 {
+	if total == 0 || current < last {
+		return 0
+	}
 
-	if cpuStat == nil {
-		return nil, errors.New("CPUStats failed! error:got nil")
+	return float64(current - last) * 100 / float64(total)
+}
+
+//Build data of cpu times compared with last collect
+func newCPUData(name string, current procfs.CPUTimes, currentTime string) *protocol.Data {
+	last, ok := GlobalLastTimes[current.Name]
+
+	//Cpu may be hot plugged, report percentages since boot for the new cpu
+	if !ok {
+		last = procfs.CPUTimes{Name: current.Name}
 	}
 
-	proto := protocol.NewProto(1)
+	GlobalLastTimes[current.Name] = current
 
-	curTime := time.Now()
-	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+	var total uint64
+
+	if current.Total() > last.Total() {
+		total = current.Total() - last.Total()
+	}
 
 	data := protocol.NewData()
 	data.Time = currentTime
 
 	data.Tag["node_name"] = GlobalNodeInfo.Name
 	data.Tag["node_ip"] = GlobalNodeInfo.IP
-	data.Field["user"] = cpuStat.User
-	data.Field["kernel"] = cpuStat.Kernel
-	data.Field["idle"] = cpuStat.Idle
-	data.Field["iowait"] = cpuStat.IOWait
-	data.Field["swap"] = cpuStat.Swap
-	data.Field["nice"] = cpuStat.Nice
-	data.Field["loadmin1"] = cpuStat.LoadMin1
-	data.Field["loadmin5"] = cpuStat.LoadMin5
-	data.Field["loadmin15"] = cpuStat.LoadMin15
+	data.Tag["cpu"] = name
+	data.Field["user"] = percent(current.User, last.User, total)
+	data.Field["kernel"] = percent(current.System, last.System, total)
+	data.Field["idle"] = percent(current.Idle, last.Idle, total)
+	data.Field["iowait"] = percent(current.IOWait, last.IOWait, total)
+	data.Field["nice"] = percent(current.Nice, last.Nice, total)
+	data.Field["irq"] = percent(current.IRQ, last.IRQ, total)
+	data.Field["softirq"] = percent(current.SoftIRQ, last.SoftIRQ, total)
+	data.Field["steal"] = percent(current.Steal, last.Steal, total)
+	data.Field["guest"] = percent(current.Guest, last.Guest, total)
+
+	return data
+}
+
+func Collect()(*protocol.Proto, error) {
+	stat, err := GlobalFS.Stat()
+
+	if err != nil {
+		return nil, errors.New("Read stat failed! error:" + err.Error())
+	}
+
+	loadAvg, err := GlobalFS.LoadAvg()
+
+	if err != nil {
+		return nil, errors.New("Read loadavg failed! error:" + err.Error())
+	}
+
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	data := newCPUData("total", stat.Total, currentTime)
+
+	data.Field["swap"] = float64(0)
+	data.Field["loadmin1"] = loadAvg.Load1
+	data.Field["loadmin5"] = loadAvg.Load5
+	data.Field["loadmin15"] = loadAvg.Load15
 
 	proto.DataList = append(proto.DataList, *data)
 
+	//Each cpu is reported to the 'cpu_core' measurement, so the 'cpu' measurement averaged by instance has the total only
+	if GlobalPerCPU {
+		for _, times := range stat.CPUs {
+			data := newCPUData(times.Name, times, currentTime)
+			data.Name = "core"
+
+			proto.DataList = append(proto.DataList, *data)
+		}
+	}
+
 	return proto, nil
 }
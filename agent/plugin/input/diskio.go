@@ -0,0 +1,160 @@
+package main
+
+import(
+	"time"
+	"errors"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+	"github.com/DarkMetrix/monitor/agent/src/filter"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+var GlobalFS *procfs.FS
+var GlobalFilter *filter.Filter
+
+//Disk stats and time of last collect, used to calculate rates
+var GlobalLastStats map[string]procfs.DiskStats
+var GlobalLastTime time.Time
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	var err error
+
+	//Loop and ram devices are excluded by default
+	exclude, ok := config["exclude"]
+
+	if !ok {
+		exclude = "^loop[0-9]+$;^ram[0-9]+$"
+	}
+
+	GlobalFilter, err = filter.NewFilter(config["include"], exclude)
+
+	if err != nil {
+		return err
+	}
+
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalFS = procfs.NewFS(config["root_path"])
+	GlobalLastStats = make(map[string]procfs.DiskStats)
+
+	//Take the first sample, so the first collect could report rates
+	stats, err := GlobalFS.DiskStats()
+
+	if err != nil {
+		return errors.New("Read diskstats failed! error:" + err.Error())
+	}
+
+	for _, stat := range stats {
+		GlobalLastStats[stat.Name] = stat
+	}
+
+	GlobalLastTime = time.Now()
+
+	return nil
+}
+
+//Get delta of counters, counters may be reset if the device is removed and added again
+func delta(current uint64, last uint64) uint64 {
+	if current < last {
+		return 0
+	}
+
+	return current - last
+}
+
+func Collect()(*protocol.Proto, error) {
+	stats, err := GlobalFS.DiskStats()
+
+	if err != nil {
+		return nil, errors.New("Read diskstats failed! error:" + err.Error())
+	}
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	elapsed := curTime.Sub(GlobalLastTime).Seconds()
+	GlobalLastTime = curTime
+
+	lastStats := GlobalLastStats
+	GlobalLastStats = make(map[string]procfs.DiskStats)
+
+	proto := protocol.NewProto(1)
+
+	for _, stat := range stats {
+		GlobalLastStats[stat.Name] = stat
+
+		if !GlobalFilter.Match(stat.Name) {
+			continue
+		}
+
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["device_name"] = stat.Name
+
+		data.Field["reads"] = stat.Reads
+		data.Field["writes"] = stat.Writes
+		data.Field["read_bytes"] = stat.ReadSectors * 512
+		data.Field["write_bytes"] = stat.WriteSectors * 512
+		data.Field["read_merged"] = stat.ReadMerged
+		data.Field["write_merged"] = stat.WriteMerged
+		data.Field["read_time"] = stat.ReadTime
+		data.Field["write_time"] = stat.WriteTime
+		data.Field["io_in_progress"] = stat.IOInProgress
+		data.Field["io_time"] = stat.IOTime
+		data.Field["weighted_io_time"] = stat.WeightedIOTime
+
+		proto.DataList = append(proto.DataList, *data)
+
+		//Rates need the last sample, a new device reports counters only
+		last, ok := lastStats[stat.Name]
+
+		if ok && elapsed > 0 {
+			reads := delta(stat.Reads, last.Reads)
+			writes := delta(stat.Writes, last.Writes)
+			ioTime := delta(stat.IOTime, last.IOTime)
+			waitTime := delta(stat.ReadTime, last.ReadTime) + delta(stat.WriteTime, last.WriteTime)
+
+			await := float64(0)
+
+			if reads + writes != 0 {
+				await = float64(waitTime) / float64(reads + writes)
+			}
+
+			utilization := float64(ioTime) / (elapsed * 1000) * 100
+
+			if utilization > 100 {
+				utilization = 100
+			}
+
+			//Rates are floats, so they are reported to the 'diskio_rate' measurement instead of mixing with the integer counters
+			rateData := protocol.NewData()
+			rateData.Name = "rate"
+			rateData.Time = currentTime
+
+			rateData.Tag["node_name"] = GlobalNodeInfo.Name
+			rateData.Tag["node_ip"] = GlobalNodeInfo.IP
+			rateData.Tag["device_name"] = stat.Name
+
+			rateData.Field["read_iops"] = float64(reads) / elapsed
+			rateData.Field["write_iops"] = float64(writes) / elapsed
+			rateData.Field["iops"] = float64(reads + writes) / elapsed
+			rateData.Field["read_bytes_per_second"] = float64(delta(stat.ReadSectors, last.ReadSectors) * 512) / elapsed
+			rateData.Field["write_bytes_per_second"] = float64(delta(stat.WriteSectors, last.WriteSectors) * 512) / elapsed
+			rateData.Field["await"] = await
+			rateData.Field["util_percent"] = utilization
+
+			proto.DataList = append(proto.DataList, *rateData)
+		}
+	}
+
+	return proto, nil
+}
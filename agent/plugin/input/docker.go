@@ -0,0 +1,486 @@
+package main
+
+import(
+	"net"
+	"sync"
+	"time"
+	"errors"
+	"strings"
+	"strconv"
+	"net/http"
+	"io/ioutil"
+	"encoding/json"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/filter"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+var GlobalFilter *filter.Filter
+
+//Docker engine api client, the host of the url is ignored when using unix socket
+var GlobalClient *http.Client
+var GlobalUrl string
+
+//Label names to tag
+var GlobalLabels []string
+
+//Max concurrent requests of containers
+var GlobalWorkers int
+
+//Cpu usage of last collect, used to calculate cpu percentage
+var GlobalLastCPUs map[string]CPUStats
+
+//Running containers of last collect, used to count started and stopped containers
+var GlobalLastRunning map[string]bool
+
+//Container in GET /containers/json
+type Container struct {
+	Id string
+	Names []string
+	Image string
+	Labels map[string]string
+	State string
+}
+
+//Container in GET /containers/{id}/json
+type ContainerInspect struct {
+	RestartCount int64
+	State struct {
+		StartedAt string
+		Health *struct {
+			Status string
+			FailingStreak int64
+		}
+	}
+}
+
+type CPUStats struct {
+	CPUUsage struct {
+		TotalUsage uint64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemCPUUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs uint64 `json:"online_cpus"`
+}
+
+type BlkioEntry struct {
+	Op string `json:"op"`
+	Value uint64 `json:"value"`
+}
+
+//Stats in GET /containers/{id}/stats
+type ContainerStats struct {
+	CPUStats CPUStats `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64 `json:"usage"`
+		Limit uint64 `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]map[string]uint64 `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []BlkioEntry `json:"io_service_bytes_recursive"`
+		IOServicedRecursive []BlkioEntry `json:"io_serviced_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	var err error
+
+	GlobalFilter, err = filter.NewFilter(config["include"], config["exclude"])
+
+	if err != nil {
+		return err
+	}
+
+	endpoint, ok := config["endpoint"]
+
+	if !ok {
+		endpoint = "unix:///var/run/docker.sock"
+	}
+
+	timeout := 5
+
+	_, ok = config["timeout"]
+
+	if ok {
+		timeout, err = strconv.Atoi(config["timeout"])
+
+		if err != nil {
+			return errors.New("Parse timeout failed! error:" + err.Error())
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		path := strings.TrimPrefix(endpoint, "unix://")
+
+		GlobalUrl = "http://docker"
+		GlobalClient = &http.Client{
+			Timeout: time.Duration(timeout) * time.Second,
+			Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return net.DialTimeout("unix", path, time.Duration(timeout) * time.Second)
+				},
+			},
+		}
+	case strings.HasPrefix(endpoint, "tcp://"):
+		GlobalUrl = "http://" + strings.TrimPrefix(endpoint, "tcp://")
+		GlobalClient = &http.Client{
+			Timeout: time.Duration(timeout) * time.Second,
+		}
+	default:
+		return errors.New("Endpoint '" + endpoint + "' invalid! should be unix:// or tcp://")
+	}
+
+	GlobalWorkers = 8
+
+	_, ok = config["workers"]
+
+	if ok {
+		GlobalWorkers, err = strconv.Atoi(config["workers"])
+
+		if err != nil {
+			return errors.New("Parse workers failed! error:" + err.Error())
+		}
+
+		if GlobalWorkers <= 0 {
+			return errors.New("Workers should be greater than 0!")
+		}
+	}
+
+	GlobalLabels = []string{}
+
+	for _, label := range strings.Split(config["labels"], ";") {
+		if len(label) == 0 {
+			continue
+		}
+
+		GlobalLabels = append(GlobalLabels, label)
+	}
+
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalLastCPUs = make(map[string]CPUStats)
+	GlobalLastRunning = nil
+
+	return nil
+}
+
+//Get short container id as docker ps
+func shortId(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+
+	return id
+}
+
+//Get the api path and decode the json response
+func get(path string, result interface{}) error {
+	response, err := GlobalClient.Get(GlobalUrl + path)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New("Status " + response.Status + " " + strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+//Sum blkio entries of the operation, op is "Read" in cgroup v1 and "read" in cgroup v2
+func sumBlkio(entries []BlkioEntry, op string) uint64 {
+	var sum uint64
+
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Op, op) {
+			sum += entry.Value
+		}
+	}
+
+	return sum
+}
+
+//Collect stats of a running container, cpu usage is returned to calculate cpu percentage next collect
+func collectStats(container Container, data *protocol.Data) (*CPUStats, error) {
+	var stats ContainerStats
+
+	//One-shot returns at once without waiting for the second sample, cpu percentage is calculated by last collect
+	err := get("/containers/" + container.Id + "/stats?stream=false&one-shot=true", &stats)
+
+	if err != nil {
+		return nil, err
+	}
+
+	last, ok := GlobalLastCPUs[container.Id]
+
+	if ok && stats.CPUStats.SystemCPUUsage > last.SystemCPUUsage && stats.CPUStats.CPUUsage.TotalUsage >= last.CPUUsage.TotalUsage {
+		cpus := stats.CPUStats.OnlineCPUs
+
+		if cpus == 0 {
+			cpus = 1
+		}
+
+		data.Field["cpu_percent"] = float64(stats.CPUStats.CPUUsage.TotalUsage - last.CPUUsage.TotalUsage) / float64(stats.CPUStats.SystemCPUUsage - last.SystemCPUUsage) * float64(cpus) * 100
+	}
+
+	data.Field["cpu_usage"] = stats.CPUStats.CPUUsage.TotalUsage
+
+	//Page cache is not counted as used, the same as docker stats
+	usage := stats.MemoryStats.Usage
+
+	cache, ok := stats.MemoryStats.Stats["total_inactive_file"]
+
+	if !ok {
+		cache = stats.MemoryStats.Stats["inactive_file"]
+	}
+
+	if cache < usage {
+		usage -= cache
+	}
+
+	data.Field["memory_usage"] = usage
+	data.Field["memory_limit"] = stats.MemoryStats.Limit
+
+	if stats.MemoryStats.Limit != 0 {
+		data.Field["memory_percent"] = float64(usage) / float64(stats.MemoryStats.Limit) * 100
+	}
+
+	counters := make(map[string]uint64)
+
+	for _, network := range stats.Networks {
+		for key, value := range network {
+			counters[key] += value
+		}
+	}
+
+	for _, key := range []string{"rx_bytes", "tx_bytes", "rx_packets", "tx_packets", "rx_errors", "tx_errors", "rx_dropped", "tx_dropped"} {
+		data.Field["net_" + key] = counters[key]
+	}
+
+	data.Field["blkio_read_bytes"] = sumBlkio(stats.BlkioStats.IOServiceBytesRecursive, "read")
+	data.Field["blkio_write_bytes"] = sumBlkio(stats.BlkioStats.IOServiceBytesRecursive, "write")
+	data.Field["blkio_reads"] = sumBlkio(stats.BlkioStats.IOServicedRecursive, "read")
+	data.Field["blkio_writes"] = sumBlkio(stats.BlkioStats.IOServicedRecursive, "write")
+
+	data.Field["pids"] = stats.PidsStats.Current
+
+	return &stats.CPUStats, nil
+}
+
+//Collect inspect and stats of a container, cpu usage is nil if the container is not running
+func collectContainer(container Container, data *protocol.Data) (*CPUStats, error) {
+	var inspect ContainerInspect
+
+	err := get("/containers/" + container.Id + "/json", &inspect)
+
+	if err != nil {
+		return nil, err
+	}
+
+	health := "none"
+
+	if inspect.State.Health != nil {
+		health = inspect.State.Health.Status
+		data.Field["health_failing_streak"] = inspect.State.Health.FailingStreak
+	}
+
+	data.Tag["health"] = health
+
+	data.Field["restart_count"] = inspect.RestartCount
+
+	if container.State != "running" {
+		data.Field["running"] = 0
+		return nil, nil
+	}
+
+	data.Field["running"] = 1
+
+	startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+
+	if err == nil {
+		data.Field["uptime"] = int64(time.Since(startedAt).Seconds())
+	}
+
+	return collectStats(container, data)
+}
+
+func Collect()(*protocol.Proto, error) {
+	var containers []Container
+
+	err := get("/containers/json?all=1", &containers)
+
+	if err != nil {
+		return nil, errors.New("List containers failed! error:" + err.Error())
+	}
+
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	datas := make([]*protocol.Data, len(containers))
+	cpus := make([]*CPUStats, len(containers))
+	errs := make([]error, len(containers))
+
+	states := make(map[string]int)
+	running := make(map[string]bool)
+
+	//Containers are requested concurrently by workers, each request may take a while
+	indexes := make(chan int, len(containers))
+
+	var wait sync.WaitGroup
+
+	for worker := 0; worker < GlobalWorkers && worker < len(containers); worker++ {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for index := range indexes {
+				cpus[index], errs[index] = collectContainer(containers[index], datas[index])
+			}
+		}()
+	}
+
+	for index, container := range containers {
+		name := container.Id
+
+		if len(container.Names) != 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+
+		states[container.State]++
+
+		if container.State == "running" {
+			running[container.Id] = true
+		}
+
+		if !GlobalFilter.Match(name) {
+			continue
+		}
+
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["container_name"] = name
+		data.Tag["container_id"] = shortId(container.Id)
+		data.Tag["image"] = container.Image
+		data.Tag["state"] = container.State
+
+		for _, label := range GlobalLabels {
+			value, ok := container.Labels[label]
+
+			if ok {
+				data.Tag[label] = value
+			}
+		}
+
+		datas[index] = data
+		indexes <- index
+	}
+
+	close(indexes)
+	wait.Wait()
+
+	lastCPUs := make(map[string]CPUStats)
+
+	for index, data := range datas {
+		if data == nil {
+			continue
+		}
+
+		//The container may be removed after listed
+		if errs[index] != nil {
+			continue
+		}
+
+		if cpus[index] != nil {
+			lastCPUs[containers[index].Id] = *cpus[index]
+		}
+
+		proto.DataList = append(proto.DataList, *data)
+
+		//Percentages are floats, so they are reported to the 'docker_percent' measurement instead of mixing with the integer counters
+		percentData := protocol.NewData()
+		percentData.Name = "percent"
+		percentData.Time = currentTime
+
+		for key, value := range data.Tag {
+			percentData.Tag[key] = value
+		}
+
+		for _, name := range []string{"cpu_percent", "memory_percent"} {
+			value, ok := data.Field[name]
+
+			if ok {
+				percentData.Field[name] = value
+				delete(data.Field, name)
+			}
+		}
+
+		if len(percentData.Field) != 0 {
+			proto.DataList = append(proto.DataList, *percentData)
+		}
+	}
+
+	//Summary of containers, started and stopped are counted since last collect
+	data := protocol.NewData()
+	data.Time = currentTime
+
+	data.Tag["node_name"] = GlobalNodeInfo.Name
+	data.Tag["node_ip"] = GlobalNodeInfo.IP
+	data.Tag["container_name"] = "total"
+
+	data.Field["containers"] = len(containers)
+	data.Field["containers_running"] = states["running"]
+	data.Field["containers_paused"] = states["paused"]
+	data.Field["containers_stopped"] = len(containers) - states["running"] - states["paused"]
+
+	if GlobalLastRunning != nil {
+		started := 0
+		stopped := 0
+
+		for id := range running {
+			if !GlobalLastRunning[id] {
+				started++
+			}
+		}
+
+		for id := range GlobalLastRunning {
+			if !running[id] {
+				stopped++
+			}
+		}
+
+		data.Field["started"] = started
+		data.Field["stopped"] = stopped
+	}
+
+	proto.DataList = append(proto.DataList, *data)
+
+	GlobalLastCPUs = lastCPUs
+	GlobalLastRunning = running
+
+	return proto, nil
+}
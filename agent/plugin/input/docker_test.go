@@ -0,0 +1,292 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test docker.go docker_test.go
+
+import(
+	"net"
+	"sync"
+	"time"
+	"strings"
+	"testing"
+	"net/http"
+	"path/filepath"
+	"encoding/json"
+	"net/http/httptest"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Fake docker engine api on a unix socket
+type FakeDocker struct {
+	sync.Mutex
+
+	containers []map[string]interface{}
+	totalUsage uint64              //Cpu usage of containers, increased by each stats request
+	systemUsage uint64
+	requests int                   //Requests in progress
+	maxRequests int                //Max requests in progress
+}
+
+func (docker *FakeDocker) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	docker.Lock()
+	docker.requests++
+
+	if docker.requests > docker.maxRequests {
+		docker.maxRequests = docker.requests
+	}
+
+	docker.Unlock()
+
+	//Keep the request in progress a while to count concurrent requests
+	time.Sleep(20 * time.Millisecond)
+
+	defer func() {
+		docker.Lock()
+		docker.requests--
+		docker.Unlock()
+	}()
+
+	docker.Lock()
+	defer docker.Unlock()
+
+	var result interface{}
+
+	switch {
+	case request.URL.Path == "/containers/json":
+		result = docker.containers
+	case strings.HasSuffix(request.URL.Path, "/stats"):
+		docker.totalUsage += 50
+		docker.systemUsage += 1000
+
+		result = map[string]interface{}{
+			"cpu_stats": map[string]interface{}{
+				"cpu_usage": map[string]interface{}{"total_usage": docker.totalUsage},
+				"system_cpu_usage": docker.systemUsage,
+				"online_cpus": 2,
+			},
+			"memory_stats": map[string]interface{}{
+				"usage": 300,
+				"limit": 1000,
+				"stats": map[string]interface{}{"inactive_file": 100},
+			},
+			"networks": map[string]interface{}{
+				"eth0": map[string]interface{}{"rx_bytes": 10, "tx_bytes": 20},
+				"eth1": map[string]interface{}{"rx_bytes": 1, "tx_bytes": 2},
+			},
+			"blkio_stats": map[string]interface{}{
+				"io_service_bytes_recursive": []map[string]interface{}{{"op": "read", "value": 4096}, {"op": "Write", "value": 8192}},
+			},
+			"pids_stats": map[string]interface{}{"current": 7},
+		}
+	case strings.HasSuffix(request.URL.Path, "/json"):
+		id := strings.Split(request.URL.Path, "/")[2]
+
+		if id == "removed" {
+			http.Error(writer, "No such container", http.StatusNotFound)
+			return
+		}
+
+		result = map[string]interface{}{
+			"RestartCount": 2,
+			"State": map[string]interface{}{
+				"StartedAt": time.Now().Add(-time.Hour).Format(time.RFC3339Nano),
+				"Health": map[string]interface{}{"Status": "healthy", "FailingStreak": 0},
+			},
+		}
+	default:
+		http.NotFound(writer, request)
+		return
+	}
+
+	json.NewEncoder(writer).Encode(result)
+}
+
+func startFakeDocker(t *testing.T, docker *FakeDocker) string {
+	path := filepath.Join(t.TempDir(), "docker.sock")
+
+	listener, err := net.Listen("unix", path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(docker)
+	server.Listener = listener
+	server.Start()
+
+	t.Cleanup(server.Close)
+
+	return "unix://" + path
+}
+
+//Get the data of the container, the measurement is 'docker' if name is empty or 'docker_<name>'
+func getContainerData(proto *protocol.Proto, name string, dataName string) *protocol.Data {
+	for index := range proto.DataList {
+		if proto.DataList[index].Tag["container_name"] == name && proto.DataList[index].Name == dataName {
+			return &proto.DataList[index]
+		}
+	}
+
+	return nil
+}
+
+func getContainer(proto *protocol.Proto, name string) *protocol.Data {
+	return getContainerData(proto, name, "")
+}
+
+func TestCollect(t *testing.T) {
+	docker := &FakeDocker{}
+
+	for _, name := range []string{"web1", "web2", "web3", "web4", "web5"} {
+		docker.containers = append(docker.containers, map[string]interface{}{
+			"Id": name + "0123456789abcdef",
+			"Names": []string{"/" + name},
+			"Image": "nginx",
+			"Labels": map[string]string{"service": "web"},
+			"State": "running",
+		})
+	}
+
+	docker.containers = append(docker.containers, map[string]interface{}{
+		"Id": "stopped0123456789",
+		"Names": []string{"/stopped"},
+		"Image": "redis",
+		"State": "exited",
+	}, map[string]interface{}{
+		"Id": "removed",
+		"Names": []string{"/removed"},
+		"Image": "redis",
+		"State": "running",
+	})
+
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"endpoint": startFakeDocker(t, docker),
+		"workers": "2",
+		"labels": "service",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	web := getContainer(proto, "web1")
+
+	if web == nil {
+		t.Fatalf("web1 not reported: %+v", proto.DataList)
+	}
+
+	tags := map[string]interface{}{
+		"container_id": "web101234567",
+		"image": "nginx",
+		"state": "running",
+		"health": "healthy",
+		"service": "web",
+	}
+
+	for key, value := range tags {
+		if web.Tag[key] != value {
+			t.Errorf("tag %s: got %v, want %v", key, web.Tag[key], value)
+		}
+	}
+
+	fields := map[string]interface{}{
+		"running": 1,
+		"restart_count": int64(2),
+		"memory_usage": uint64(200),
+		"memory_limit": uint64(1000),
+		"net_rx_bytes": uint64(11),
+		"net_tx_bytes": uint64(22),
+		"blkio_read_bytes": uint64(4096),
+		"blkio_write_bytes": uint64(8192),
+		"pids": uint64(7),
+	}
+
+	for key, value := range fields {
+		if web.Field[key] != value {
+			t.Errorf("field %s: got %v(%T), want %v(%T)", key, web.Field[key], web.Field[key], value, value)
+		}
+	}
+
+	//Float percentages are not mixed with the integer counters
+	percents := getContainerData(proto, "web1", "percent")
+
+	if percents == nil || percents.Field["memory_percent"] != float64(20) || percents.Tag["service"] != "web" {
+		t.Errorf("docker_percent: got %+v", percents)
+	}
+
+	_, ok := web.Field["memory_percent"]
+
+	if ok {
+		t.Errorf("memory_percent should not be reported to docker")
+	}
+
+	//Cpu percentage needs the last collect
+	_, ok = percents.Field["cpu_percent"]
+
+	if ok {
+		t.Errorf("cpu_percent should not be reported in the first collect")
+	}
+
+	stopped := getContainer(proto, "stopped")
+
+	if stopped == nil || stopped.Field["running"] != 0 {
+		t.Errorf("stopped: got %+v", stopped)
+	}
+
+	//The container removed after listed is skipped
+	if getContainer(proto, "removed") != nil {
+		t.Errorf("removed container should not be reported")
+	}
+
+	total := getContainer(proto, "total")
+
+	if total == nil || total.Field["containers"] != 7 || total.Field["containers_running"] != 6 || total.Field["containers_stopped"] != 1 {
+		t.Errorf("total: got %+v", total)
+	}
+
+	if docker.maxRequests > 2 {
+		t.Errorf("concurrent requests: got %d, want at most 2 workers", docker.maxRequests)
+	}
+
+	//A container stopped since last collect
+	docker.Lock()
+	docker.containers[1]["State"] = "exited"
+	docker.Unlock()
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	percents = getContainerData(proto, "web1", "percent")
+
+	//Each stats request increases the total usage by 50 and the system usage by 1000, 7 requests between the two samples
+	percent, ok := percents.Field["cpu_percent"].(float64)
+
+	if !ok || percent <= 0 || percent > 200 {
+		t.Errorf("cpu_percent: got %v", percents.Field["cpu_percent"])
+	}
+
+	total = getContainer(proto, "total")
+
+	if total.Field["started"] != 0 || total.Field["stopped"] != 1 {
+		t.Errorf("started and stopped: got %+v", total.Field)
+	}
+}
+
+func TestInitWorkers(t *testing.T) {
+	err := Init(config.NodeInfo{}, map[string]string{"workers": "0"})
+
+	if err == nil {
+		t.Errorf("workers 0 should fail")
+	}
+}
@@ -0,0 +1,627 @@
+package main
+
+import(
+	"os"
+	"sync"
+	"time"
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"strconv"
+	"syscall"
+	"os/exec"
+	"encoding/json"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/lineprotocol"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Max bytes of stderr reported
+const MaxStderrBytes = 1024
+
+//Time to wait for the output pipes to be closed after the shell exited
+const WaitDelay = time.Second
+
+//States of nagios plugins by exit code
+var GlobalNagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+//Perfdata of nagios plugins, e.g.:"'time'=0.5s;1;2;0;10"
+var GlobalPerfdataRegex = regexp.MustCompile(`^'?([^'=]+)'?=([-+0-9.eE]+)([^;]*)(?:;([-+0-9.eE]*))?(?:;([-+0-9.eE]*))?(?:;([-+0-9.eE]*))?(?:;([-+0-9.eE]*))?$`)
+
+//Command to run
+type Command struct {
+	Name string
+	Command string               //Command line run by "/bin/sh -c"
+	Format string                //"json", "influx", "nagios" or "value"
+	Timeout time.Duration
+	Env []string                 //Appended to the environment of the agent, e.g.:"KEY=value"
+	Dir string
+}
+
+//Output of a command in one collect
+type Output struct {
+	stdout []byte
+	stderr []byte
+	exitCode int
+	timeout bool
+	duration float64             //Milliseconds
+	err error                    //Error of starting the command
+}
+
+var GlobalCommands []*Command
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalCommands = []*Command{}
+
+	for _, name := range strings.Split(config["commands"], ";") {
+		if len(name) == 0 {
+			continue
+		}
+
+		command, err := newCommand(name)
+
+		if err != nil {
+			return err
+		}
+
+		GlobalCommands = append(GlobalCommands, command)
+	}
+
+	if len(GlobalCommands) == 0 {
+		return errors.New("No command is configured!")
+	}
+
+	return nil
+}
+
+//Get option of the command, '<command>:<option>' is used if configured, otherwise '<option>' as the default of all commands
+func getOption(name string, option string, defaultValue string) string {
+	value, ok := GlobalConfig[name + ":" + option]
+
+	if ok {
+		return value
+	}
+
+	value, ok = GlobalConfig[option]
+
+	if ok {
+		return value
+	}
+
+	return defaultValue
+}
+
+//Create command from config
+func newCommand(name string) (*Command, error) {
+	command := &Command{
+		Name: name,
+		Command: GlobalConfig[name + ":command"],
+		Format: getOption(name, "format", "value"),
+		Env: []string{},
+		Dir: getOption(name, "dir", ""),
+	}
+
+	if len(command.Command) == 0 {
+		return nil, errors.New("Command of '" + name + "' is not configured!")
+	}
+
+	switch command.Format {
+	case "json", "influx", "nagios", "value":
+	default:
+		return nil, errors.New("Format of command '" + name + "' invalid! should be json, influx, nagios or value")
+	}
+
+	timeout, err := strconv.ParseFloat(getOption(name, "timeout", "10"), 64)
+
+	if err != nil {
+		return nil, errors.New("Parse timeout of command '" + name + "' failed! error:" + err.Error())
+	}
+
+	command.Timeout = time.Duration(timeout * float64(time.Second))
+
+	//Env is like "KEY1=value1;KEY2=value2"
+	for _, env := range strings.Split(getOption(name, "env", ""), ";") {
+		if len(env) == 0 {
+			continue
+		}
+
+		if !strings.Contains(env, "=") {
+			return nil, errors.New("Env '" + env + "' of command '" + name + "' invalid! should be 'KEY=value'")
+		}
+
+		command.Env = append(command.Env, env)
+	}
+
+	return command, nil
+}
+
+//Run the command, the process group is killed if timeout so children of the shell are killed too
+func run(command *Command) *Output {
+	output := &Output{}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("/bin/sh", "-c", command.Command)
+	cmd.Env = append(os.Environ(), command.Env...)
+	cmd.Dir = command.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	//A daemonized grandchild out of the process group may keep stdout open, the pipes are closed a while after the shell exits
+	cmd.WaitDelay = WaitDelay
+
+	start := time.Now()
+
+	err := cmd.Start()
+
+	if err != nil {
+		output.err = err
+		output.exitCode = -1
+		return output
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(command.Timeout):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+		output.timeout = true
+		err = <-done
+	}
+
+	output.duration = float64(time.Since(start)) / float64(time.Millisecond)
+	output.stdout = stdout.Bytes()
+	output.stderr = stderr.Bytes()
+
+	//The shell exited successfully but the pipes were closed by force
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
+
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+
+		if ok {
+			output.exitCode = exitErr.ExitCode()
+		} else {
+			output.exitCode = -1
+		}
+	}
+
+	return output
+}
+
+//Parse json output, a proto, a data or a list of data
+func parseJson(stdout []byte) ([]protocol.Data, error) {
+	stdout = bytes.TrimSpace(stdout)
+
+	if len(stdout) != 0 && stdout[0] == '[' {
+		datas := []protocol.Data{}
+
+		err := json.Unmarshal(stdout, &datas)
+
+		return datas, err
+	}
+
+	var fields map[string]json.RawMessage
+
+	err := json.Unmarshal(stdout, &fields)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, ok := fields["data"]
+
+	if !ok {
+		data := protocol.Data{}
+
+		err = json.Unmarshal(stdout, &data)
+
+		return []protocol.Data{data}, err
+	}
+
+	proto := protocol.Proto{}
+
+	err = json.Unmarshal(stdout, &proto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//Name of the proto is the measurement as influx output
+	if len(proto.Name) != 0 {
+		for index := range proto.DataList {
+			data := &proto.DataList[index]
+
+			if data.Tag == nil {
+				data.Tag = make(map[string]interface{})
+			}
+
+			_, ok := data.Tag["measurement"]
+
+			if !ok {
+				data.Tag["measurement"] = proto.Name
+			}
+		}
+	}
+
+	return proto.DataList, nil
+}
+
+//Parse influxdb line protocol output, lines could not be parsed are counted
+func parseInflux(stdout []byte) ([]protocol.Data, int) {
+	datas := []protocol.Data{}
+	failed := 0
+
+	for _, line := range strings.Split(string(stdout), "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := lineprotocol.ParseLine(line, time.Nanosecond)
+
+		if err != nil {
+			failed++
+			continue
+		}
+
+		datas = append(datas, *point.Data())
+	}
+
+	return datas, failed
+}
+
+//Split perfdata by spaces, labels could be quoted with spaces, e.g.:"'disk used'=80%;90;95 load1=0.5"
+func splitPerfdata(text string) []string {
+	perfdatas := []string{}
+
+	start := -1
+	quoted := false
+
+	for index := 0; index <= len(text); index++ {
+		if index == len(text) || (text[index] == ' ' && !quoted) {
+			if start >= 0 {
+				perfdatas = append(perfdatas, text[start:index])
+			}
+
+			start = -1
+			continue
+		}
+
+		if start < 0 {
+			start = index
+		}
+
+		if text[index] == '\'' {
+			quoted = !quoted
+		}
+	}
+
+	return perfdatas
+}
+
+//Parse nagios plugin output, perfdata follows '|' of the first line or the long text, e.g.:"OK - load is 0.5 | load1=0.5;5;10;0"
+func parseNagios(stdout []byte) (*protocol.Data, string, int) {
+	data := protocol.NewData()
+	failed := 0
+
+	lines := strings.Split(strings.TrimSpace(string(stdout)), "\n")
+	perfdatas := []string{}
+
+	for index, line := range lines {
+		pair := strings.SplitN(line, "|", 2)
+
+		if len(pair) != 2 {
+			continue
+		}
+
+		if index == 0 {
+			lines[0] = pair[0]
+		}
+
+		perfdatas = append(perfdatas, splitPerfdata(pair[1])...)
+	}
+
+	for _, perfdata := range perfdatas {
+		matches := GlobalPerfdataRegex.FindStringSubmatch(perfdata)
+
+		if matches == nil {
+			failed++
+			continue
+		}
+
+		label := strings.Replace(strings.TrimSpace(matches[1]), " ", "_", -1)
+
+		value, err := strconv.ParseFloat(matches[2], 64)
+
+		if err != nil {
+			failed++
+			continue
+		}
+
+		data.Field[label] = value
+
+		for index, suffix := range []string{"_warn", "_crit", "_min", "_max"} {
+			threshold, err := strconv.ParseFloat(matches[index + 4], 64)
+
+			if err == nil {
+				data.Field[label + suffix] = threshold
+			}
+		}
+	}
+
+	return data, strings.TrimSpace(lines[0]), failed
+}
+
+//Parse 'key value' lines, 'key=value' is accepted too
+func parseValue(stdout []byte) (*protocol.Data, int) {
+	data := protocol.NewData()
+	failed := 0
+
+	for _, line := range strings.Split(string(stdout), "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pair := strings.Fields(strings.Replace(line, "=", " ", 1))
+
+		if len(pair) != 2 {
+			failed++
+			continue
+		}
+
+		value, err := strconv.ParseFloat(pair[1], 64)
+
+		if err != nil {
+			failed++
+			continue
+		}
+
+		data.Field[pair[0]] = value
+	}
+
+	return data, failed
+}
+
+//Create data with common tags
+func newData(currentTime string, command *Command) *protocol.Data {
+	data := protocol.NewData()
+	data.Time = currentTime
+
+	data.Tag["node_name"] = GlobalNodeInfo.Name
+	data.Tag["node_ip"] = GlobalNodeInfo.IP
+	data.Tag["command"] = command.Name
+
+	return data
+}
+
+//Convert number and bool values to floats and move string values to a copy of the data reported to the 'exec_output' measurement,
+//so the types are not mixed in one measurement. Values of other types(e.g.:json objects) are dropped and counted.
+func splitFields(data *protocol.Data) (*protocol.Data, int) {
+	output := protocol.NewData()
+	output.Name = "output"
+	output.Time = data.Time
+
+	for key, value := range data.Tag {
+		output.Tag[key] = value
+	}
+
+	dropped := 0
+
+	for key, value := range data.Field {
+		switch typed := value.(type) {
+		case float64:
+		case float32:
+			data.Field[key] = float64(typed)
+		case int:
+			data.Field[key] = float64(typed)
+		case int64:
+			data.Field[key] = float64(typed)
+		case uint64:
+			data.Field[key] = float64(typed)
+		case bool:
+			data.Field[key] = float64(0)
+
+			if typed {
+				data.Field[key] = float64(1)
+			}
+		case string:
+			output.Field[key] = typed
+			delete(data.Field, key)
+		default:
+			dropped++
+			delete(data.Field, key)
+		}
+	}
+
+	if len(output.Field) == 0 {
+		return nil, dropped
+	}
+
+	return output, dropped
+}
+
+//Run the command and parse the output, the status of the command is reported as the first data
+func collectCommand(currentTime string, command *Command) []protocol.Data {
+	output := run(command)
+
+	status := newData(currentTime, command)
+	status.Tag["type"] = "status"
+
+	//All values of the status are floats like the values parsed, so the types are not mixed in one measurement
+	status.Field["exit_code"] = float64(output.exitCode)
+	status.Field["duration"] = output.duration
+	status.Field["timeout"] = float64(0)
+
+	if output.timeout {
+		status.Field["timeout"] = float64(1)
+	}
+
+	if output.err != nil {
+		log.Warnf("Run command %s failed! error:%s", command.Name, output.err)
+
+		status.Field["stderr"] = output.err.Error()
+
+		datas, _ := appendData([]protocol.Data{}, status)
+
+		return datas
+	}
+
+	if len(output.stderr) != 0 {
+		stderr := output.stderr
+
+		if len(stderr) > MaxStderrBytes {
+			stderr = stderr[:MaxStderrBytes]
+		}
+
+		status.Field["stderr"] = strings.TrimSpace(string(stderr))
+	}
+
+	var parsed []protocol.Data
+	var failed int
+
+	switch command.Format {
+	case "json":
+		var err error
+
+		parsed, err = parseJson(output.stdout)
+
+		if err != nil {
+			log.Warnf("Parse json output of command %s failed! error:%s", command.Name, err)
+
+			parsed = nil
+			failed = 1
+		}
+	case "influx":
+		parsed, failed = parseInflux(output.stdout)
+	case "nagios":
+		if output.exitCode >= 0 && output.exitCode < len(GlobalNagiosStates) {
+			status.Tag["state"] = GlobalNagiosStates[output.exitCode]
+		} else {
+			status.Tag["state"] = "UNKNOWN"
+		}
+
+		var data *protocol.Data
+		var text string
+
+		data, text, failed = parseNagios(output.stdout)
+		data.Time = currentTime
+
+		if len(text) != 0 {
+			status.Field["output"] = text
+		}
+
+		parsed = []protocol.Data{*data}
+	case "value":
+		var data *protocol.Data
+
+		data, failed = parseValue(output.stdout)
+		data.Time = currentTime
+		parsed = []protocol.Data{*data}
+	}
+
+	datas := []protocol.Data{}
+
+	for index := range parsed {
+		data := &parsed[index]
+
+		if len(data.Field) == 0 {
+			continue
+		}
+
+		if data.Tag == nil {
+			data.Tag = make(map[string]interface{})
+		}
+
+		//Time of json data is optional
+		if len(data.Time) == 0 {
+			data.Time = currentTime
+		}
+
+		//All data are reported to the 'exec' measurement, the measurement of json and influx output is tagged by 'measurement'
+		data.Name = ""
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["command"] = command.Name
+
+		var dropped int
+
+		datas, dropped = appendData(datas, data)
+		failed += dropped
+	}
+
+	status.Field["parse_errors"] = float64(failed)
+
+	statusDatas, _ := appendData([]protocol.Data{}, status)
+
+	return append(statusDatas, datas...)
+}
+
+//Append the data and its string values to the datas, the count of values dropped is returned
+func appendData(datas []protocol.Data, data *protocol.Data) ([]protocol.Data, int) {
+	output, dropped := splitFields(data)
+
+	if len(data.Field) != 0 {
+		datas = append(datas, *data)
+	}
+
+	if output != nil {
+		datas = append(datas, *output)
+	}
+
+	return datas, dropped
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	results := make([][]protocol.Data, len(GlobalCommands))
+
+	var wait sync.WaitGroup
+
+	//Commands are run concurrently, a slow command does not delay the others
+	for index, command := range GlobalCommands {
+		wait.Add(1)
+
+		go func(index int, command *Command) {
+			defer wait.Done()
+
+			results[index] = collectCommand(currentTime, command)
+		}(index, command)
+	}
+
+	wait.Wait()
+
+	for _, datas := range results {
+		proto.DataList = append(proto.DataList, datas...)
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,273 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test exec.go exec_test.go
+
+import(
+	"reflect"
+	"testing"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+func TestParseJson(t *testing.T) {
+	tests := []struct {
+		name string
+		stdout string
+		want []map[string]interface{}            //Tags and fields of each data
+		fail bool
+	}{
+		{"data", `{"tag":{"queue":"jobs"},"field":{"size":3}}`, []map[string]interface{}{{"queue": "jobs", "size": float64(3)}}, false},
+		{"list", "[{\"field\":{\"a\":1}},{\"field\":{\"b\":2}}]\n", []map[string]interface{}{{"a": float64(1)}, {"b": float64(2)}}, false},
+		//The name of the proto is tagged unless the data is tagged
+		{"proto", `{"name":"app","data":[{"field":{"a":1}},{"tag":{"measurement":"db"},"field":{"b":2}}]}`, []map[string]interface{}{{"measurement": "app", "a": float64(1)}, {"measurement": "db", "b": float64(2)}}, false},
+		{"invalid", `{"field":`, nil, true},
+		{"not_object", `"ok"`, nil, true},
+	}
+
+	for _, test := range tests {
+		datas, err := parseJson([]byte(test.stdout))
+
+		if test.fail {
+			if err == nil {
+				t.Errorf("%s: should fail, got %+v", test.name, datas)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		checkDatas(t, test.name, datas, test.want)
+	}
+}
+
+//Check the tags and fields of each data
+func checkDatas(t *testing.T, name string, datas []protocol.Data, want []map[string]interface{}) {
+	if len(datas) != len(want) {
+		t.Errorf("%s: got %+v, want %+v", name, datas, want)
+		return
+	}
+
+	for index, data := range datas {
+		values := make(map[string]interface{})
+
+		for key, value := range data.Tag {
+			values[key] = value
+		}
+
+		for key, value := range data.Field {
+			values[key] = value
+		}
+
+		if !reflect.DeepEqual(values, want[index]) {
+			t.Errorf("%s: data %d got %+v, want %+v", name, index, values, want[index])
+		}
+	}
+}
+
+func TestParseInflux(t *testing.T) {
+	stdout := "# comment\n\ncpu,host=a usage=0.5,count=3i 1700000000000000000\nbroken line\n  mem free=10  \ncpu,host=\n"
+
+	datas, failed := parseInflux([]byte(stdout))
+
+	if failed != 2 {
+		t.Errorf("got failed %d, want 2", failed)
+	}
+
+	checkDatas(t, "influx", datas, []map[string]interface{}{
+		{"measurement": "cpu", "host": "a", "usage": 0.5, "count": int64(3)},
+		{"measurement": "mem", "free": float64(10)},
+	})
+}
+
+func TestSplitPerfdata(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{" load1=0.5  load5=0.2 ", []string{"load1=0.5", "load5=0.2"}},
+		{"'disk used'=80%;90;95 load1=0.5", []string{"'disk used'=80%;90;95", "load1=0.5"}},
+		{"'a b c'=1 'd'=2", []string{"'a b c'=1", "'d'=2"}},
+	}
+
+	for _, test := range tests {
+		got := splitPerfdata(test.text)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestParseNagios(t *testing.T) {
+	tests := []struct {
+		name string
+		stdout string
+		output string
+		fields map[string]interface{}
+		failed int
+	}{
+		{"no_perfdata", "OK - all good\n", "OK - all good", map[string]interface{}{}, 0},
+		{"thresholds", "WARNING - load is 5 | load1=5;4;10;0 load5=2.5;;;0;", "WARNING - load is 5", map[string]interface{}{
+			"load1": float64(5), "load1_warn": float64(4), "load1_crit": float64(10), "load1_min": float64(0),
+			"load5": 2.5, "load5_min": float64(0),
+		}, 0},
+		//The unit is not converted
+		{"quoted", "OK | 'disk used'=80%;90;95 time=0.5s", "OK", map[string]interface{}{
+			"disk_used": float64(80), "disk_used_warn": float64(90), "disk_used_crit": float64(95), "time": 0.5,
+		}, 0},
+		//Perfdata of the long text
+		{"long_text", "OK - 2 disks | root=10\n/ is fine\n/data is fine | data=20;;;;100\n", "OK - 2 disks", map[string]interface{}{
+			"root": float64(10), "data": float64(20), "data_max": float64(100),
+		}, 0},
+		{"invalid", "CRITICAL | load=high ok=1 =2", "CRITICAL", map[string]interface{}{"ok": float64(1)}, 2},
+	}
+
+	for _, test := range tests {
+		data, output, failed := parseNagios([]byte(test.stdout))
+
+		if output != test.output || failed != test.failed || !reflect.DeepEqual(data.Field, test.fields) {
+			t.Errorf("%s: got %q %d %+v, want %q %d %+v", test.name, output, failed, data.Field, test.output, test.failed, test.fields)
+		}
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	data, failed := parseValue([]byte("# comment\nsize 3\nlatency=0.25\n\n  errors   1e3\nstate ok\nmissing\na b c\n"))
+
+	want := map[string]interface{}{"size": float64(3), "latency": 0.25, "errors": float64(1000)}
+
+	if failed != 3 || !reflect.DeepEqual(data.Field, want) {
+		t.Errorf("got %d %+v, want 3 %+v", failed, data.Field, want)
+	}
+}
+
+//Get the data of the command by type and measurement name
+func getCommandData(proto *protocol.Proto, command string, dataType string, name string) []protocol.Data {
+	datas := []protocol.Data{}
+
+	for _, data := range proto.DataList {
+		if data.Tag["command"] != command || data.Name != name {
+			continue
+		}
+
+		if (dataType == "status") != (data.Tag["type"] == "status") {
+			continue
+		}
+
+		datas = append(datas, data)
+	}
+
+	return datas
+}
+
+func TestCollect(t *testing.T) {
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"commands": "value;influx;json;nagios;slow;missing",
+		"value:command": "echo size 3; echo warning >&2; exit 2",
+		"influx:command": `echo 'app,queue=jobs size=3i,ready=true,state="idle" '; echo broken`,
+		"influx:format": "influx",
+		"json:command": `echo '{"tag":{"queue":"jobs"},"field":{"size":3,"labels":{"a":1}}}'`,
+		"json:format": "json",
+		"nagios:command": "echo 'WARNING - queue is long | size=30;20;50'; exit 1",
+		"nagios:format": "nagios",
+		"slow:command": "echo size 1; sleep 5",
+		"slow:timeout": "0.2",
+		"missing:command": "exit 127",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command string
+		exitCode float64
+		timeout float64
+		parseErrors float64
+		fields map[string]interface{}                //Fields parsed from stdout
+		output map[string]interface{}                //Text reported to the 'exec_output' measurement
+	}{
+		{"value", 2, 0, 0, map[string]interface{}{"size": float64(3)}, map[string]interface{}{"stderr": "warning"}},
+		{"influx", 0, 0, 1, map[string]interface{}{"size": float64(3), "ready": float64(1)}, map[string]interface{}{"state": "idle"}},
+		//Json objects are dropped and counted
+		{"json", 0, 0, 1, map[string]interface{}{"size": float64(3)}, nil},
+		{"nagios", 1, 0, 0, map[string]interface{}{"size": float64(30), "size_warn": float64(20), "size_crit": float64(50)}, map[string]interface{}{"output": "WARNING - queue is long"}},
+		{"slow", -1, 1, 0, map[string]interface{}{"size": float64(1)}, nil},
+		{"missing", 127, 0, 0, nil, nil},
+	}
+
+	for _, test := range tests {
+		status := getCommandData(proto, test.command, "status", "")
+
+		if len(status) != 1 {
+			t.Errorf("%s: got status %+v", test.command, status)
+			continue
+		}
+
+		if status[0].Field["exit_code"] != test.exitCode || status[0].Field["timeout"] != test.timeout || status[0].Field["parse_errors"] != test.parseErrors {
+			t.Errorf("%s: got status %+v", test.command, status[0].Field)
+		}
+
+		var fields map[string]interface{}
+
+		for _, data := range getCommandData(proto, test.command, "", "") {
+			fields = data.Field
+		}
+
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: got fields %+v, want %+v", test.command, fields, test.fields)
+		}
+
+		//Strings are not mixed with the floats in one measurement
+		output := make(map[string]interface{})
+
+		for _, data := range proto.DataList {
+			if data.Tag["command"] != test.command {
+				continue
+			}
+
+			if data.Name == "output" {
+				for key, value := range data.Field {
+					output[key] = value
+				}
+
+				continue
+			}
+
+			for key, value := range data.Field {
+				_, ok := value.(float64)
+
+				if !ok {
+					t.Errorf("%s: field %s got %T, want float64", test.command, key, value)
+				}
+			}
+		}
+
+		if test.output == nil {
+			test.output = map[string]interface{}{}
+		}
+
+		if !reflect.DeepEqual(output, test.output) {
+			t.Errorf("%s: got exec_output %+v, want %+v", test.command, output, test.output)
+		}
+	}
+
+	duration, _ := getCommandData(proto, "slow", "status", "")[0].Field["duration"].(float64)
+
+	if duration < 200 || duration > 3000 {
+		t.Errorf("slow: got duration %v, want about 200", duration)
+	}
+}
@@ -3,52 +3,89 @@ package main
 import(
 	"time"
 	"errors"
-	"strings"
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
-	"regexp"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+	"github.com/DarkMetrix/monitor/agent/src/filter"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
-var GlobalIncludes map[string]bool
+var GlobalFS *procfs.FS
+
+//Filters on device name, mount point and file system type
+var GlobalDeviceFilter *filter.Filter
+var GlobalMountPointFilter *filter.Filter
+var GlobalFSTypeFilter *filter.Filter
+
+//Any include pattern is configured or not, nothing is reported if not, the same as the old include only config
+var GlobalIncluded bool
+
+//Virtual and in-memory file systems are excluded by default
+const DefaultExcludeFSType = "^(tmpfs|devtmpfs|overlay|proc|sysfs|cgroup|cgroup2|devpts|mqueue|debugfs|tracefs|securityfs|pstore|autofs|configfs|fusectl|hugetlbfs|bpf|binfmt_misc|nsfs|rpc_pipefs|squashfs)$"
 
 func Init(nodeInfo config.NodeInfo, config map[string]string) error {
-	GlobalIncludes = make(map[string]bool)
+	var err error
 
-	_, ok := config["include"]
+	GlobalDeviceFilter, err = filter.NewFilter(config["include"], config["exclude"])
 
-	if ok {
-		includes := strings.Split(config["include"], ";")
+	if err != nil {
+		return err
+	}
 
-		for _, include := range includes {
-			GlobalIncludes[include] = true
-		}
+	GlobalMountPointFilter, err = filter.NewFilter(config["include_mount_point"], config["exclude_mount_point"])
+
+	if err != nil {
+		return err
 	}
 
+	excludeFSType, ok := config["exclude_fs_type"]
+
+	if !ok {
+		excludeFSType = DefaultExcludeFSType
+	}
+
+	GlobalFSTypeFilter, err = filter.NewFilter(config["include_fs_type"], excludeFSType)
+
+	if err != nil {
+		return err
+	}
+
+	_, includeOk := config["include"]
+	_, includeMountPointOk := config["include_mount_point"]
+	_, includeFSTypeOk := config["include_fs_type"]
+
+	GlobalIncluded = includeOk || includeMountPointOk || includeFSTypeOk
+
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	return nil
+}
+
+//Calculate percentage
+func percent(value uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
 	}
 
-	return nil
+	return float64(value) * 100 / float64(total)
 }
 
 func Collect()(*protocol.Proto, error) {
-	fsInfos := GlobalStat.FSInfos()
+	if !GlobalIncluded {
+		return protocol.NewProto(1), nil
+	}
+
+	mounts, err := GlobalFS.Mounts()
 
-	if fsInfos == nil {
-		return nil, errors.New("FSInfos failed! error:got nil")
+	if err != nil {
+		return nil, errors.New("Read mounts failed! error:" + err.Error())
 	}
 
 	proto := protocol.NewProto(1)
@@ -56,23 +93,23 @@ func Collect()(*protocol.Proto, error) {
 	curTime := time.Now()
 	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
 
-	for _, info := range fsInfos {
-		is_match := false
-
-		for key := range GlobalIncludes {
-			match, err := regexp.MatchString(key, info.DeviceName)
+	for _, mount := range mounts {
+		if !GlobalDeviceFilter.Match(mount.Device) {
+			continue
+		}
 
-			if err != nil {
-				continue
-			}
+		if !GlobalMountPointFilter.Match(mount.MountPoint) {
+			continue
+		}
 
-			if match {
-				is_match = true
-				break
-			}
+		if !GlobalFSTypeFilter.Match(mount.FSType) {
+			continue
 		}
 
-		if !is_match {
+		//Mount point may be unreachable, e.g.:a hung nfs
+		info, err := GlobalFS.FSUsage(mount.MountPoint)
+
+		if err != nil {
 			continue
 		}
 
@@ -82,9 +119,9 @@ func Collect()(*protocol.Proto, error) {
 		data.Tag["node_name"] = GlobalNodeInfo.Name
 		data.Tag["node_ip"] = GlobalNodeInfo.IP
 
-		data.Tag["device_name"] = info.DeviceName
-		data.Tag["fs_type"] = info.FSType
-		data.Tag["mount_point"] = info.MountPoint
+		data.Tag["device_name"] = mount.Device
+		data.Tag["fs_type"] = mount.FSType
+		data.Tag["mount_point"] = mount.MountPoint
 
 		data.Field["size"] = info.Size
 		data.Field["used"] = info.Used
@@ -96,6 +133,21 @@ func Collect()(*protocol.Proto, error) {
 		data.Field["inodes_available"] = info.AvailableInodes
 
 		proto.DataList = append(proto.DataList, *data)
+
+		//Percentages are floats, so they are reported to the 'filesystem_percent' measurement instead of mixing with the integer counters
+		percentData := protocol.NewData()
+		percentData.Name = "percent"
+		percentData.Time = currentTime
+
+		for key, value := range data.Tag {
+			percentData.Tag[key] = value
+		}
+
+		//Same as df, blocks reserved for root are not counted
+		percentData.Field["used_percent"] = percent(info.Used, info.Used + info.Available)
+		percentData.Field["inodes_used_percent"] = percent(info.UsedInodes, info.TotalInodes)
+
+		proto.DataList = append(proto.DataList, *percentData)
 	}
 
 	return proto, nil
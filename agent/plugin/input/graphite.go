@@ -0,0 +1,487 @@
+package main
+
+import(
+	"net"
+	"sync"
+	"time"
+	"bufio"
+	"errors"
+	"strings"
+	"strconv"
+	"path/filepath"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Max bytes of a udp packet
+const MaxPacketBytes = 64 * 1024
+
+//Max bytes of a line of tcp connections
+const MaxLineBytes = 1024 * 1024
+
+//Template maps the parts of a dotted path to measurement, field and tags, e.g.:"servers.* .host.measurement.field*"
+type Template struct {
+	Filter []string              //Glob patterns of the path parts, empty matches all paths
+	Parts []string               //"measurement", "measurement*", "field", "field*", a tag name, or "" to skip the part
+	Tags map[string]string       //Tags added to the points matched
+}
+
+//Points received since last collect
+type Buffer struct {
+	sync.Mutex
+
+	datas []protocol.Data
+	received uint64
+	dropped uint64               //Dropped since the buffer is full
+	failed uint64                //Lines could not be parsed
+}
+
+var GlobalBuffer *Buffer
+var GlobalMaxBuffer int
+var GlobalSeparator string
+var GlobalTemplates []*Template
+
+//Used if no template matched
+var GlobalDefaultTemplate = &Template{
+	Parts: []string{"measurement*"},
+	Tags: make(map[string]string),
+}
+
+var GlobalTcpListener net.Listener
+var GlobalUdpConn net.PacketConn
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalMaxBuffer = 10000
+
+	_, ok := config["max_buffer"]
+
+	if ok {
+		var err error
+
+		GlobalMaxBuffer, err = strconv.Atoi(config["max_buffer"])
+
+		if err != nil {
+			return errors.New("Parse max_buffer failed! error:" + err.Error())
+		}
+	}
+
+	GlobalSeparator = "."
+
+	_, ok = config["separator"]
+
+	if ok {
+		GlobalSeparator = config["separator"]
+	}
+
+	GlobalTemplates = []*Template{}
+
+	for _, text := range strings.Split(config["templates"], ";") {
+		if len(strings.TrimSpace(text)) == 0 {
+			continue
+		}
+
+		template, err := parseTemplate(text)
+
+		if err != nil {
+			return err
+		}
+
+		GlobalTemplates = append(GlobalTemplates, template)
+	}
+
+	GlobalBuffer = &Buffer{
+		datas: []protocol.Data{},
+	}
+
+	tcpAddress := ":2003"
+
+	_, ok = config["tcp_address"]
+
+	if ok {
+		tcpAddress = config["tcp_address"]
+	}
+
+	udpAddress := ":2003"
+
+	_, ok = config["udp_address"]
+
+	if ok {
+		udpAddress = config["udp_address"]
+	}
+
+	if len(tcpAddress) == 0 && len(udpAddress) == 0 {
+		return errors.New("No tcp_address or udp_address is configured!")
+	}
+
+	var err error
+
+	if len(tcpAddress) != 0 {
+		GlobalTcpListener, err = net.Listen("tcp", tcpAddress)
+
+		if err != nil {
+			return errors.New("Listen tcp_address failed! error:" + err.Error())
+		}
+
+		go serveTcp(GlobalTcpListener)
+	}
+
+	if len(udpAddress) != 0 {
+		GlobalUdpConn, err = net.ListenPacket("udp", udpAddress)
+
+		if err != nil {
+			return errors.New("Listen udp_address failed! error:" + err.Error())
+		}
+
+		go serveUdp(GlobalUdpConn)
+	}
+
+	return nil
+}
+
+//Parse template, it is "[filter] template [tag=value,...]", e.g.:"servers.* .host.measurement.field* env=prod"
+func parseTemplate(text string) (*Template, error) {
+	fields := strings.Fields(text)
+
+	template := &Template{
+		Filter: []string{},
+		Tags: make(map[string]string),
+	}
+
+	var parts, tags string
+
+	switch {
+	case len(fields) == 1:
+		parts = fields[0]
+	case len(fields) == 2 && strings.Contains(fields[1], "="):
+		parts, tags = fields[0], fields[1]
+	case len(fields) == 2:
+		template.Filter = strings.Split(fields[0], ".")
+		parts = fields[1]
+	case len(fields) == 3:
+		template.Filter = strings.Split(fields[0], ".")
+		parts, tags = fields[1], fields[2]
+	default:
+		return nil, errors.New("Template '" + text + "' invalid! should be '[filter] template [tag=value,...]'")
+	}
+
+	for _, pattern := range template.Filter {
+		_, err := filepath.Match(pattern, "")
+
+		if err != nil {
+			return nil, errors.New("Filter of template '" + text + "' invalid! error:" + err.Error())
+		}
+	}
+
+	template.Parts = strings.Split(parts, ".")
+
+	for index, part := range template.Parts {
+		if strings.HasSuffix(part, "*") && index != len(template.Parts) - 1 {
+			return nil, errors.New("Template '" + text + "' invalid! '" + part + "' should be the last part")
+		}
+	}
+
+	for _, tag := range strings.Split(tags, ",") {
+		if len(tag) == 0 {
+			continue
+		}
+
+		pair := strings.SplitN(tag, "=", 2)
+
+		if len(pair) != 2 || len(pair[0]) == 0 {
+			return nil, errors.New("Tag '" + tag + "' of template '" + text + "' invalid! should be 'tag=value'")
+		}
+
+		template.Tags[pair[0]] = pair[1]
+	}
+
+	return template, nil
+}
+
+//Does the template match the path parts or not
+func (template *Template) match(parts []string) bool {
+	if len(template.Filter) > len(parts) {
+		return false
+	}
+
+	for index, pattern := range template.Filter {
+		matched, _ := filepath.Match(pattern, parts[index])
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+//Get the template of the path parts, the first template matched is used
+func getTemplate(parts []string) *Template {
+	for _, template := range GlobalTemplates {
+		if template.match(parts) {
+			return template
+		}
+	}
+
+	return GlobalDefaultTemplate
+}
+
+//Apply the template to the path parts, returns measurement, field and tags
+func (template *Template) apply(parts []string) (string, string, map[string]string) {
+	measurements := []string{}
+	fields := []string{}
+	tags := make(map[string]string)
+	applied := make(map[string]bool)
+
+	for key, value := range template.Tags {
+		tags[key] = value
+	}
+
+	for index, part := range template.Parts {
+		if index >= len(parts) {
+			break
+		}
+
+		switch part {
+		case "":
+		case "measurement":
+			measurements = append(measurements, parts[index])
+		case "measurement*":
+			measurements = append(measurements, parts[index:]...)
+		case "field":
+			fields = append(fields, parts[index])
+		case "field*":
+			fields = append(fields, parts[index:]...)
+		default:
+			//Parts of the same tag are joined
+			if applied[part] {
+				tags[part] += GlobalSeparator + parts[index]
+			} else {
+				tags[part] = parts[index]
+			}
+
+			applied[part] = true
+		}
+	}
+
+	measurement := strings.Join(measurements, GlobalSeparator)
+
+	if len(measurement) == 0 {
+		measurement = strings.Join(parts, GlobalSeparator)
+	}
+
+	field := strings.Join(fields, GlobalSeparator)
+
+	if len(field) == 0 {
+		field = "value"
+	}
+
+	return measurement, field, tags
+}
+
+//Parse a line, e.g.:"servers.web01.cpu.idle 98.5 1700000000", graphite tags are supported, e.g.:"cpu.idle;host=web01 98.5"
+func parseLine(line string) (*protocol.Data, error) {
+	fields := strings.Fields(line)
+
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, errors.New("Line should be 'path value [timestamp]'")
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+
+	if err != nil {
+		return nil, errors.New("Value '" + fields[1] + "' invalid!")
+	}
+
+	curTime := time.Now()
+
+	//Timestamp is in seconds, -1 means now
+	if len(fields) == 3 {
+		timestamp, err := strconv.ParseFloat(fields[2], 64)
+
+		if err != nil {
+			return nil, errors.New("Timestamp '" + fields[2] + "' invalid!")
+		}
+
+		if timestamp > 0 {
+			curTime = time.Unix(0, int64(timestamp * float64(time.Second)))
+		}
+	}
+
+	pathTags := strings.Split(fields[0], ";")
+	parts := strings.Split(pathTags[0], ".")
+
+	for _, part := range parts {
+		if len(part) == 0 {
+			return nil, errors.New("Path '" + pathTags[0] + "' invalid!")
+		}
+	}
+
+	measurement, field, tags := getTemplate(parts).apply(parts)
+
+	for _, tag := range pathTags[1:] {
+		pair := strings.SplitN(tag, "=", 2)
+
+		if len(pair) != 2 || len(pair[0]) == 0 {
+			return nil, errors.New("Tag '" + tag + "' invalid!")
+		}
+
+		tags[pair[0]] = pair[1]
+	}
+
+	data := protocol.NewData()
+	data.Time = curTime.Local().Format("2006-01-02 15:04:05")
+	data.Tag["measurement"] = measurement
+
+	//Tag named 'measurement' of the path or the template is renamed so the measurement is not overwritten
+	for key, value := range tags {
+		if key == "measurement" {
+			key = "exported_measurement"
+		}
+
+		data.Tag[key] = value
+	}
+
+	data.Field[field] = value
+
+	return data, nil
+}
+
+//Parse lines and add points to the buffer
+func (buffer *Buffer) add(lines []string) {
+	datas := []protocol.Data{}
+	failed := 0
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 {
+			continue
+		}
+
+		data, err := parseLine(line)
+
+		if err != nil {
+			failed++
+			continue
+		}
+
+		datas = append(datas, *data)
+	}
+
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	buffer.received += uint64(len(datas))
+	buffer.failed += uint64(failed)
+
+	for _, data := range datas {
+		if len(buffer.datas) >= GlobalMaxBuffer {
+			buffer.dropped++
+			continue
+		}
+
+		buffer.datas = append(buffer.datas, data)
+	}
+}
+
+//Accept tcp connections, clients could keep the connection and send lines continuously
+func serveTcp(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			log.Warnf("Accept tcp failed! error:%s", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			scanner := bufio.NewScanner(conn)
+			scanner.Buffer(make([]byte, 64 * 1024), MaxLineBytes)
+
+			for scanner.Scan() {
+				GlobalBuffer.add([]string{scanner.Text()})
+			}
+
+			//Line too long or connection reset
+			err := scanner.Err()
+
+			if err != nil {
+				log.Warnf("Read tcp from %s failed! error:%s", conn.RemoteAddr(), err)
+			}
+		}(conn)
+	}
+}
+
+//Read udp packets, each packet has one or more lines
+func serveUdp(conn net.PacketConn) {
+	buffer := make([]byte, MaxPacketBytes)
+
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+
+		if err != nil {
+			log.Warnf("Read udp failed! error:%s", err)
+			return
+		}
+
+		GlobalBuffer.add(strings.Split(string(buffer[:n]), "\n"))
+	}
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	GlobalBuffer.Lock()
+
+	datas := GlobalBuffer.datas
+
+	status := protocol.NewData()
+	status.Time = currentTime
+
+	status.Tag["node_name"] = GlobalNodeInfo.Name
+	status.Tag["node_ip"] = GlobalNodeInfo.IP
+	status.Tag["type"] = "status"
+
+	status.Field["points_received"] = GlobalBuffer.received
+	status.Field["points_dropped"] = GlobalBuffer.dropped
+	status.Field["parse_errors"] = GlobalBuffer.failed
+
+	GlobalBuffer.datas = []protocol.Data{}
+	GlobalBuffer.received = 0
+	GlobalBuffer.dropped = 0
+	GlobalBuffer.failed = 0
+
+	GlobalBuffer.Unlock()
+
+	proto.DataList = append(proto.DataList, *status)
+
+	//Node tags sent by clients are kept
+	for _, data := range datas {
+		_, ok := data.Tag["node_name"]
+
+		if !ok {
+			data.Tag["node_name"] = GlobalNodeInfo.Name
+			data.Tag["node_ip"] = GlobalNodeInfo.IP
+		}
+
+		proto.DataList = append(proto.DataList, data)
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test graphite.go graphite_test.go
+
+import(
+	"net"
+	"time"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		text string
+		want *Template
+	}{
+		{".host.measurement.field*", &Template{
+			Filter: []string{},
+			Parts: []string{"", "host", "measurement", "field*"},
+			Tags: map[string]string{},
+		}},
+		{"measurement* env=prod,dc=us", &Template{
+			Filter: []string{},
+			Parts: []string{"measurement*"},
+			Tags: map[string]string{"env": "prod", "dc": "us"},
+		}},
+		{"servers.* .host.measurement.field*", &Template{
+			Filter: []string{"servers", "*"},
+			Parts: []string{"", "host", "measurement", "field*"},
+			Tags: map[string]string{},
+		}},
+		{"  stats.*.gauges  ..measurement.field  type=gauge  ", &Template{
+			Filter: []string{"stats", "*", "gauges"},
+			Parts: []string{"", "", "measurement", "field"},
+			Tags: map[string]string{"type": "gauge"},
+		}},
+	}
+
+	for _, test := range tests {
+		template, err := parseTemplate(test.text)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.text, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(template, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.text, template, test.want)
+		}
+	}
+
+	invalids := []string{
+		"servers.* measurement* env=prod extra",
+		"servers.[ measurement",
+		"measurement*.host",
+		"field*.measurement",
+		"servers.* measurement =prod",
+	}
+
+	for _, text := range invalids {
+		_, err := parseTemplate(text)
+
+		if err == nil {
+			t.Errorf("%s: should fail", text)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	GlobalSeparator = "."
+
+	tests := []struct {
+		template string
+		path string
+		measurement string
+		field string
+		tags map[string]string
+	}{
+		{".host.measurement.field*", "servers.web01.cpu.usage.idle", "cpu", "usage.idle", map[string]string{"host": "web01"}},
+		{"measurement*", "stats.api.requests", "stats.api.requests", "value", map[string]string{}},
+		{".measurement*", "stats.api.requests", "api.requests", "value", map[string]string{}},
+		{"host.measurement.measurement.field env=prod", "web01.disk.sda.used", "disk.sda", "used", map[string]string{"host": "web01", "env": "prod"}},
+		//Parts of the same tag are joined
+		{"region.region.measurement", "us.east.cpu", "cpu", "value", map[string]string{"region": "us.east"}},
+		//Path shorter than the template, the measurement is the path if not mapped
+		{".host.measurement.field", "servers.web01", "servers.web01", "value", map[string]string{"host": "web01"}},
+		{"..field*", "a.b.c.d", "a.b.c.d", "c.d", map[string]string{}},
+	}
+
+	for _, test := range tests {
+		template, err := parseTemplate(test.template)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		measurement, field, tags := template.apply(strings.Split(test.path, "."))
+
+		if measurement != test.measurement || field != test.field || !reflect.DeepEqual(tags, test.tags) {
+			t.Errorf("%s %s: got %s %s %v, want %s %s %v", test.template, test.path, measurement, field, tags, test.measurement, test.field, test.tags)
+		}
+	}
+
+	//Joined by the separator configured
+	GlobalSeparator = "_"
+
+	template, _ := parseTemplate(".measurement*")
+	measurement, _, _ := template.apply([]string{"stats", "api", "requests"})
+
+	if measurement != "api_requests" {
+		t.Errorf("separator: got %s, want api_requests", measurement)
+	}
+
+	GlobalSeparator = "."
+}
+
+func TestParseLine(t *testing.T) {
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"tcp_address": "127.0.0.1:0",
+		"udp_address": "",
+		"templates": "servers.* .host.measurement.field* env=prod;stats.* .measurement*;apps.* .measurement.field measurement=app",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		tags map[string]interface{}
+		fields map[string]interface{}
+		time string
+	}{
+		{"servers.web01.cpu.usage.idle 98.5 1700000000", map[string]interface{}{"measurement": "cpu", "host": "web01", "env": "prod"}, map[string]interface{}{"usage.idle": 98.5}, time.Unix(1700000000, 0).Local().Format("2006-01-02 15:04:05")},
+		{"stats.api.requests 3", map[string]interface{}{"measurement": "api.requests"}, map[string]interface{}{"value": float64(3)}, ""},
+		//Not matched by the templates, graphite tags override the template tags
+		{"cpu.idle;host=web01;env=dev 1 -1", map[string]interface{}{"measurement": "cpu.idle", "host": "web01", "env": "dev"}, map[string]interface{}{"value": float64(1)}, ""},
+		{"servers.web02.mem.used;env=dev 10", map[string]interface{}{"measurement": "mem", "host": "web02", "env": "dev"}, map[string]interface{}{"used": float64(10)}, ""},
+		//Tags named 'measurement' of the path or the template are exported
+		{"cpu.idle;measurement=host 1", map[string]interface{}{"measurement": "cpu.idle", "exported_measurement": "host"}, map[string]interface{}{"value": float64(1)}, ""},
+		{"apps.web.requests 5", map[string]interface{}{"measurement": "web", "exported_measurement": "app"}, map[string]interface{}{"requests": float64(5)}, ""},
+	}
+
+	for _, test := range tests {
+		data, err := parseLine(test.line)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(data.Tag, test.tags) || !reflect.DeepEqual(data.Field, test.fields) {
+			t.Errorf("%s: got %v %v, want %v %v", test.line, data.Tag, data.Field, test.tags, test.fields)
+		}
+
+		if len(test.time) != 0 && data.Time != test.time {
+			t.Errorf("%s: got time %s, want %s", test.line, data.Time, test.time)
+		}
+	}
+
+	invalids := []string{
+		"cpu.idle",
+		"cpu.idle abc",
+		"cpu.idle 1 abc",
+		"cpu..idle 1",
+		"cpu.idle;host 1",
+		"cpu.idle 1 2 3",
+	}
+
+	for _, line := range invalids {
+		_, err := parseLine(line)
+
+		if err == nil {
+			t.Errorf("%s: should fail", line)
+		}
+	}
+}
+
+//Long lines are read and the listener keeps accepting after connections fail
+func TestServeTcp(t *testing.T) {
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"tcp_address": "127.0.0.1:0",
+		"udp_address": "",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", GlobalTcpListener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := "long." + strings.Repeat("a", 100 * 1024)
+
+	conn.Write([]byte(long + " 1\nshort 2\n"))
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	fields := make(map[string]interface{})
+
+	for time.Now().Before(deadline) && len(fields) < 2 {
+		time.Sleep(10 * time.Millisecond)
+
+		proto, err := Collect()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, data := range proto.DataList {
+			measurement, _ := data.Tag["measurement"].(string)
+
+			if len(measurement) != 0 {
+				fields[measurement] = data.Field["value"]
+			}
+		}
+	}
+
+	if fields[long] != float64(1) || fields["short"] != float64(2) {
+		t.Errorf("got %d points, want long and short", len(fields))
+	}
+}
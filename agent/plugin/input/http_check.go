@@ -0,0 +1,366 @@
+package main
+
+import(
+	"io"
+	"net"
+	"sync"
+	"time"
+	"errors"
+	"regexp"
+	"strings"
+	"strconv"
+	"net/http"
+	"net/url"
+	"io/ioutil"
+	"crypto/tls"
+	"net/http/httptrace"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Max bytes of the body matched against body regex
+const MaxBodyBytes = 1024 * 1024
+
+//Target to check
+type Target struct {
+	Name string
+	Url string
+	Method string
+	Headers map[string]string
+	Body string
+	Status []string             //Expected status codes, e.g.:"200" or "2xx"
+	BodyRegex *regexp.Regexp    //Expected body regex, nil if not configured
+	Timeout time.Duration
+	FollowRedirects bool
+
+	client *http.Client
+}
+
+var GlobalTargets []*Target
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalTargets = []*Target{}
+
+	for _, name := range strings.Split(config["targets"], ";") {
+		if len(name) == 0 {
+			continue
+		}
+
+		target, err := newTarget(name)
+
+		if err != nil {
+			return err
+		}
+
+		GlobalTargets = append(GlobalTargets, target)
+	}
+
+	if len(GlobalTargets) == 0 {
+		return errors.New("No target is configured!")
+	}
+
+	return nil
+}
+
+//Get option of the target, '<target>:<option>' is used if configured, otherwise '<option>' as the default of all targets
+func getOption(name string, option string, defaultValue string) string {
+	value, ok := GlobalConfig[name + ":" + option]
+
+	if ok {
+		return value
+	}
+
+	value, ok = GlobalConfig[option]
+
+	if ok {
+		return value
+	}
+
+	return defaultValue
+}
+
+//Create target from config
+func newTarget(name string) (*Target, error) {
+	var err error
+
+	target := &Target{
+		Name: name,
+		Url: getOption(name, "url", ""),
+		Method: strings.ToUpper(getOption(name, "method", "GET")),
+		Headers: make(map[string]string),
+		Body: getOption(name, "body", ""),
+	}
+
+	parsedUrl, err := url.Parse(target.Url)
+
+	if err != nil || (parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https") {
+		return nil, errors.New("Url of target '" + name + "' invalid! should be http:// or https://")
+	}
+
+	//Headers are like "Host: example.com;Authorization: Basic xxx"
+	for _, header := range strings.Split(getOption(name, "headers", ""), ";") {
+		if len(header) == 0 {
+			continue
+		}
+
+		pair := strings.SplitN(header, ":", 2)
+
+		if len(pair) != 2 {
+			return nil, errors.New("Header '" + header + "' of target '" + name + "' invalid! should be 'name: value'")
+		}
+
+		target.Headers[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+	}
+
+	target.Status = strings.Split(getOption(name, "status", "2xx;3xx"), ";")
+
+	bodyRegex := getOption(name, "body_regex", "")
+
+	if len(bodyRegex) != 0 {
+		target.BodyRegex, err = regexp.Compile(bodyRegex)
+
+		if err != nil {
+			return nil, errors.New("Compile body_regex of target '" + name + "' failed! error:" + err.Error())
+		}
+	}
+
+	timeout, err := strconv.ParseFloat(getOption(name, "timeout", "10"), 64)
+
+	if err != nil {
+		return nil, errors.New("Parse timeout of target '" + name + "' failed! error:" + err.Error())
+	}
+
+	target.Timeout = time.Duration(timeout * float64(time.Second))
+	target.FollowRedirects = getOption(name, "follow_redirects", "false") == "true"
+
+	//Connections are not reused, so each check includes dns, connect and tls time
+	target.client = &http.Client{
+		Timeout: target.Timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: getOption(name, "insecure_skip_verify", "false") == "true",
+			},
+		},
+	}
+
+	if !target.FollowRedirects {
+		target.client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	return target, nil
+}
+
+//Is the status code expected or not
+func (target *Target) expectStatus(code int) bool {
+	status := strconv.Itoa(code)
+
+	for _, expected := range target.Status {
+		if expected == status {
+			return true
+		}
+
+		if len(expected) == 3 && strings.HasSuffix(expected, "xx") && expected[0] == status[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Get the result of the request error
+func getErrorResult(err error) string {
+	urlErr, ok := err.(*url.Error)
+
+	if ok && urlErr.Timeout() {
+		return "timeout"
+	}
+
+	var dnsErr *net.DNSError
+
+	if errors.As(err, &dnsErr) {
+		return "dns_failed"
+	}
+
+	if strings.Contains(err.Error(), "tls:") || strings.Contains(err.Error(), "x509:") {
+		return "tls_failed"
+	}
+
+	return "connection_failed"
+}
+
+//Milliseconds between two times, 0 if either is not set
+func milliseconds(start time.Time, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+
+	return float64(end.Sub(start)) / float64(time.Millisecond)
+}
+
+//Check the target
+func check(target *Target, data *protocol.Data) {
+	var dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+
+	//Dialing ipv4 and ipv6 concurrently(happy eyeballs) calls ConnectStart and ConnectDone from several goroutines,
+	//even after the request is done, so the times are set under the mutex.
+	//Connect time is from the first dial started to the first dial succeeded.
+	var mutex sync.Mutex
+
+	setTime := func(value *time.Time) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if value.IsZero() {
+			*value = time.Now()
+		}
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { setTime(&dnsStart) },
+		DNSDone: func(httptrace.DNSDoneInfo) { setTime(&dnsDone) },
+		ConnectStart: func(string, string) { setTime(&connectStart) },
+		ConnectDone: func(network string, addr string, err error) {
+			if err == nil {
+				setTime(&connectDone)
+			}
+		},
+		TLSHandshakeStart: func() { setTime(&tlsStart) },
+		TLSHandshakeDone: func(tls.ConnectionState, error) { setTime(&tlsDone) },
+		GotFirstResponseByte: func() { setTime(&firstByte) },
+	}
+
+	//All values are floats like the times, so the types are not mixed in one measurement
+	data.Field["up"] = float64(0)
+
+	var body io.Reader
+
+	if len(target.Body) != 0 {
+		body = strings.NewReader(target.Body)
+	}
+
+	request, err := http.NewRequest(target.Method, target.Url, body)
+
+	if err != nil {
+		data.Tag["result"] = "request_invalid"
+		return
+	}
+
+	for key, value := range target.Headers {
+		if strings.EqualFold(key, "Host") {
+			request.Host = value
+			continue
+		}
+
+		request.Header.Set(key, value)
+	}
+
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+
+	start := time.Now()
+
+	response, err := target.client.Do(request)
+
+	if err != nil {
+		data.Tag["result"] = getErrorResult(err)
+		data.Field["response_time"] = milliseconds(start, time.Now())
+		return
+	}
+
+	defer response.Body.Close()
+
+	//The body is read within the timeout of the client
+	content, err := ioutil.ReadAll(io.LimitReader(response.Body, MaxBodyBytes))
+
+	size := int64(len(content))
+
+	if err == nil {
+		var rest int64
+
+		rest, err = io.Copy(ioutil.Discard, response.Body)
+		size += rest
+	}
+
+	end := time.Now()
+
+	mutex.Lock()
+
+	data.Field["response_time"] = milliseconds(start, end)
+	data.Field["dns_time"] = milliseconds(dnsStart, dnsDone)
+	data.Field["connect_time"] = milliseconds(connectStart, connectDone)
+	data.Field["tls_time"] = milliseconds(tlsStart, tlsDone)
+	data.Field["first_byte_time"] = milliseconds(start, firstByte)
+
+	mutex.Unlock()
+
+	data.Field["status_code"] = float64(response.StatusCode)
+	data.Field["response_size"] = float64(size)
+
+	if response.TLS != nil && len(response.TLS.PeerCertificates) != 0 {
+		data.Field["cert_expiry_days"] = response.TLS.PeerCertificates[0].NotAfter.Sub(end).Hours() / 24
+	}
+
+	switch {
+	case err != nil:
+		data.Tag["result"] = getErrorResult(err)
+	case !target.expectStatus(response.StatusCode):
+		data.Tag["result"] = "status_mismatch"
+	case target.BodyRegex != nil && !target.BodyRegex.Match(content):
+		data.Tag["result"] = "body_mismatch"
+	default:
+		data.Tag["result"] = "success"
+		data.Field["up"] = float64(1)
+	}
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	datas := make([]*protocol.Data, len(GlobalTargets))
+
+	var wait sync.WaitGroup
+
+	//Targets are checked concurrently, a slow target does not delay the others
+	for index, target := range GlobalTargets {
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["target"] = target.Name
+		data.Tag["url"] = target.Url
+		data.Tag["method"] = target.Method
+
+		datas[index] = data
+
+		wait.Add(1)
+
+		go func(target *Target, data *protocol.Data) {
+			defer wait.Done()
+
+			check(target, data)
+		}(target, data)
+	}
+
+	wait.Wait()
+
+	for _, data := range datas {
+		proto.DataList = append(proto.DataList, *data)
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test http_check.go http_check_test.go
+
+import(
+	"log"
+	"net"
+	"time"
+	"testing"
+	"net/http"
+	"io/ioutil"
+	"net/http/httptest"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Fake server of the targets
+func serveTarget(writer http.ResponseWriter, request *http.Request) {
+	switch request.URL.Path {
+	case "/ok":
+		writer.Write([]byte("status: healthy"))
+	case "/missing":
+		http.NotFound(writer, request)
+	case "/redirect":
+		http.Redirect(writer, request, "/ok", http.StatusFound)
+	case "/slow":
+		select {
+		case <-request.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	case "/echo":
+		body, _ := ioutil.ReadAll(request.Body)
+
+		if request.Method != "POST" || string(body) != "ping" || request.Header.Get("X-Token") != "secret" || request.Host != "example.com" {
+			http.Error(writer, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		writer.Write([]byte("pong"))
+	}
+}
+
+//Get an address nothing listens on
+func getClosedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+	listener.Close()
+
+	return address
+}
+
+func getTarget(proto *protocol.Proto, name string) *protocol.Data {
+	for index := range proto.DataList {
+		if proto.DataList[index].Tag["target"] == name {
+			return &proto.DataList[index]
+		}
+	}
+
+	return nil
+}
+
+func TestCollect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(serveTarget))
+	defer server.Close()
+
+	//Handshake errors of the unverified target are expected
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(serveTarget))
+	tlsServer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"targets": "ok;status;missing;body_match;body_mismatch;timeout;redirect;follow;tls;tls_verify;post;refused",
+		"timeout": "2",
+		"ok:url": server.URL + "/ok",
+		"status:url": server.URL + "/missing",
+		"status:status": "404",
+		"missing:url": server.URL + "/missing",
+		"body_match:url": server.URL + "/ok",
+		"body_match:body_regex": "health(y|ier)",
+		"body_mismatch:url": server.URL + "/ok",
+		"body_mismatch:body_regex": "^unhealthy",
+		"timeout:url": server.URL + "/slow",
+		"timeout:timeout": "0.2",
+		"redirect:url": server.URL + "/redirect",
+		"follow:url": server.URL + "/redirect",
+		"follow:follow_redirects": "true",
+		"follow:status": "200",
+		"tls:url": tlsServer.URL + "/ok",
+		"tls:insecure_skip_verify": "true",
+		"tls_verify:url": tlsServer.URL + "/ok",
+		"post:url": server.URL + "/echo",
+		"post:method": "post",
+		"post:body": "ping",
+		"post:headers": "Host: example.com;X-Token: secret",
+		"refused:url": "http://" + getClosedAddress(t) + "/",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		result string
+		up float64
+		statusCode float64        //0 if no response
+	}{
+		{"ok", "success", 1, 200},
+		{"status", "success", 1, 404},
+		{"missing", "status_mismatch", 0, 404},
+		{"body_match", "success", 1, 200},
+		{"body_mismatch", "body_mismatch", 0, 200},
+		{"timeout", "timeout", 0, 0},
+		{"redirect", "success", 1, 302},
+		{"follow", "success", 1, 200},
+		{"tls", "success", 1, 200},
+		{"tls_verify", "tls_failed", 0, 0},
+		{"post", "success", 1, 200},
+		{"refused", "connection_failed", 0, 0},
+	}
+
+	for _, test := range tests {
+		data := getTarget(proto, test.target)
+
+		if data == nil {
+			t.Errorf("%s: not reported", test.target)
+			continue
+		}
+
+		if data.Tag["result"] != test.result || data.Field["up"] != test.up {
+			t.Errorf("%s: got result %v up %v, want %s %v", test.target, data.Tag["result"], data.Field["up"], test.result, test.up)
+		}
+
+		statusCode, ok := data.Field["status_code"]
+
+		if (test.statusCode == 0 && ok) || (test.statusCode != 0 && statusCode != test.statusCode) {
+			t.Errorf("%s: got status_code %v, want %v", test.target, statusCode, test.statusCode)
+		}
+
+		//All values are floats in one measurement
+		for key, value := range data.Field {
+			_, ok := value.(float64)
+
+			if !ok {
+				t.Errorf("%s: field %s got %T, want float64", test.target, key, value)
+			}
+		}
+	}
+
+	//Timeout is reported with the time waited
+	responseTime, _ := getTarget(proto, "timeout").Field["response_time"].(float64)
+
+	if responseTime < 200 || responseTime > 2000 {
+		t.Errorf("timeout: got response_time %v, want about 200", responseTime)
+	}
+
+	if getTarget(proto, "ok").Field["response_size"] != float64(len("status: healthy")) {
+		t.Errorf("ok: got response_size %v", getTarget(proto, "ok").Field["response_size"])
+	}
+
+	//The certificate of httptest expires in decades
+	tls := getTarget(proto, "tls")
+	expiry, ok := tls.Field["cert_expiry_days"].(float64)
+
+	if !ok || expiry < 365 {
+		t.Errorf("tls: got cert_expiry_days %v", tls.Field["cert_expiry_days"])
+	}
+
+	tlsTime, _ := tls.Field["tls_time"].(float64)
+
+	if tlsTime <= 0 {
+		t.Errorf("tls: got tls_time %v", tls.Field["tls_time"])
+	}
+
+	_, ok = getTarget(proto, "ok").Field["cert_expiry_days"]
+
+	if ok {
+		t.Errorf("ok: cert_expiry_days should not be reported for http")
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []map[string]string{
+		{},
+		{"targets": "web", "web:url": "ftp://example.com/"},
+		{"targets": "web", "web:url": "http://example.com/", "web:headers": "X-Token"},
+		{"targets": "web", "web:url": "http://example.com/", "web:body_regex": "("},
+		{"targets": "web", "web:url": "http://example.com/", "web:timeout": "soon"},
+	}
+
+	for _, test := range tests {
+		err := Init(config.NodeInfo{}, test)
+
+		if err == nil {
+			t.Errorf("%v: should fail", test)
+		}
+	}
+}
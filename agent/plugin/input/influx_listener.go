@@ -0,0 +1,305 @@
+package main
+
+import(
+	"io"
+	"net"
+	"sync"
+	"time"
+	"errors"
+	"strings"
+	"strconv"
+	"net/http"
+	"io/ioutil"
+	"compress/gzip"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/lineprotocol"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Max bytes of a http request body
+const MaxBodyBytes = 32 * 1024 * 1024
+
+//Max bytes of a udp packet
+const MaxPacketBytes = 64 * 1024
+
+//Precisions of timestamps
+var GlobalPrecisions = map[string]time.Duration{
+	"n": time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u": time.Microsecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+//Points received since last collect
+type Buffer struct {
+	sync.Mutex
+
+	datas []protocol.Data
+	received uint64
+	dropped uint64               //Dropped since the buffer is full
+	failed uint64                //Lines could not be parsed
+}
+
+var GlobalBuffer *Buffer
+var GlobalMaxBuffer int
+var GlobalPrecision time.Duration
+
+var GlobalHttpListener net.Listener
+var GlobalUdpConn net.PacketConn
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalMaxBuffer = 10000
+
+	_, ok := config["max_buffer"]
+
+	if ok {
+		var err error
+
+		GlobalMaxBuffer, err = strconv.Atoi(config["max_buffer"])
+
+		if err != nil {
+			return errors.New("Parse max_buffer failed! error:" + err.Error())
+		}
+	}
+
+	precision := "ns"
+
+	_, ok = config["precision"]
+
+	if ok {
+		precision = config["precision"]
+	}
+
+	GlobalPrecision, ok = GlobalPrecisions[precision]
+
+	if !ok {
+		return errors.New("Precision '" + precision + "' invalid! should be ns, us, ms, s, m or h")
+	}
+
+	GlobalBuffer = &Buffer{
+		datas: []protocol.Data{},
+	}
+
+	httpAddress := ":8186"
+
+	_, ok = config["http_address"]
+
+	if ok {
+		httpAddress = config["http_address"]
+	}
+
+	udpAddress := ":8089"
+
+	_, ok = config["udp_address"]
+
+	if ok {
+		udpAddress = config["udp_address"]
+	}
+
+	if len(httpAddress) == 0 && len(udpAddress) == 0 {
+		return errors.New("No http_address or udp_address is configured!")
+	}
+
+	var err error
+
+	if len(httpAddress) != 0 {
+		GlobalHttpListener, err = net.Listen("tcp", httpAddress)
+
+		if err != nil {
+			return errors.New("Listen http_address failed! error:" + err.Error())
+		}
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/write", handleWrite)
+		mux.HandleFunc("/ping", handlePing)
+
+		go http.Serve(GlobalHttpListener, mux)
+	}
+
+	if len(udpAddress) != 0 {
+		GlobalUdpConn, err = net.ListenPacket("udp", udpAddress)
+
+		if err != nil {
+			return errors.New("Listen udp_address failed! error:" + err.Error())
+		}
+
+		go serveUdp(GlobalUdpConn)
+	}
+
+	return nil
+}
+
+//Parse lines and add points to the buffer, returns the count of lines could not be parsed
+func (buffer *Buffer) add(text string, precision time.Duration) int {
+	datas := []protocol.Data{}
+	failed := 0
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		point, err := lineprotocol.ParseLine(line, precision)
+
+		if err != nil {
+			failed++
+			continue
+		}
+
+		datas = append(datas, *point.Data())
+	}
+
+	buffer.Lock()
+	defer buffer.Unlock()
+
+	buffer.received += uint64(len(datas))
+	buffer.failed += uint64(failed)
+
+	for _, data := range datas {
+		if len(buffer.datas) >= GlobalMaxBuffer {
+			buffer.dropped++
+			continue
+		}
+
+		buffer.datas = append(buffer.datas, data)
+	}
+
+	return failed
+}
+
+//Handle '/write' of influxdb 1.x http api, the precision could be set by the 'precision' query
+func handleWrite(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	precision := GlobalPrecision
+
+	query := request.URL.Query().Get("precision")
+
+	if len(query) != 0 {
+		var ok bool
+
+		precision, ok = GlobalPrecisions[query]
+
+		if !ok {
+			http.Error(writer, "Precision '" + query + "' invalid", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var reader io.Reader = http.MaxBytesReader(writer, request.Body, MaxBodyBytes)
+
+	if request.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(reader)
+
+		if err != nil {
+			http.Error(writer, "Read gzip body failed! error:" + err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		defer gzipReader.Close()
+
+		reader = io.LimitReader(gzipReader, MaxBodyBytes)
+	}
+
+	body, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		http.Error(writer, "Read body failed! error:" + err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	failed := GlobalBuffer.add(string(body), precision)
+
+	//Lines parsed are kept like the partial write of influxdb
+	if failed != 0 {
+		http.Error(writer, "partial write: " + strconv.Itoa(failed) + " lines could not be parsed", http.StatusBadRequest)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+//Handle '/ping' used by clients to check the server
+func handlePing(writer http.ResponseWriter, request *http.Request) {
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+//Read udp packets, each packet has one or more lines
+func serveUdp(conn net.PacketConn) {
+	buffer := make([]byte, MaxPacketBytes)
+
+	for {
+		n, _, err := conn.ReadFrom(buffer)
+
+		if err != nil {
+			log.Warnf("Read udp failed! error:%s", err)
+			return
+		}
+
+		GlobalBuffer.add(string(buffer[:n]), GlobalPrecision)
+	}
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	GlobalBuffer.Lock()
+
+	datas := GlobalBuffer.datas
+
+	status := protocol.NewData()
+	status.Time = currentTime
+
+	status.Tag["node_name"] = GlobalNodeInfo.Name
+	status.Tag["node_ip"] = GlobalNodeInfo.IP
+	status.Tag["type"] = "status"
+
+	status.Field["points_received"] = GlobalBuffer.received
+	status.Field["points_dropped"] = GlobalBuffer.dropped
+	status.Field["parse_errors"] = GlobalBuffer.failed
+
+	GlobalBuffer.datas = []protocol.Data{}
+	GlobalBuffer.received = 0
+	GlobalBuffer.dropped = 0
+	GlobalBuffer.failed = 0
+
+	GlobalBuffer.Unlock()
+
+	proto.DataList = append(proto.DataList, *status)
+
+	//Node tags sent by clients are kept
+	for _, data := range datas {
+		_, ok := data.Tag["node_name"]
+
+		if !ok {
+			data.Tag["node_name"] = GlobalNodeInfo.Name
+			data.Tag["node_ip"] = GlobalNodeInfo.IP
+		}
+
+		proto.DataList = append(proto.DataList, data)
+	}
+
+	return proto, nil
+}
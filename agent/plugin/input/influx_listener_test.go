@@ -0,0 +1,206 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test influx_listener.go influx_listener_test.go
+
+import(
+	"time"
+	"bytes"
+	"strings"
+	"testing"
+	"net/http"
+	"compress/gzip"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Start the http listener on a random loopback port, returns the url of '/write'
+func initTest(t *testing.T, precision string) string {
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"http_address": "127.0.0.1:0",
+		"udp_address": "",
+		"precision": precision,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		GlobalHttpListener.Close()
+	})
+
+	return "http://" + GlobalHttpListener.Addr().String() + "/write"
+}
+
+//Post the body to '/write', returns the status code
+func write(t *testing.T, url string, body []byte, gzipped bool) int {
+	request, err := http.NewRequest("POST", url, bytes.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gzipped {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	return response.StatusCode
+}
+
+//Get the points collected by measurement, the status is keyed by "status"
+func collect(t *testing.T) map[string]protocol.Data {
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datas := make(map[string]protocol.Data)
+
+	for _, data := range proto.DataList {
+		measurement, ok := data.Tag["measurement"].(string)
+
+		if !ok {
+			measurement = "status"
+		}
+
+		datas[measurement] = data
+	}
+
+	return datas
+}
+
+func formatTime(seconds int64) string {
+	return time.Unix(seconds, 0).Local().Format("2006-01-02 15:04:05")
+}
+
+func TestWritePrecision(t *testing.T) {
+	tests := []struct {
+		precision string
+		query string
+		line string
+	}{
+		{"ns", "", "cpu usage=0.5 1700000000000000000"},
+		{"s", "", "cpu usage=0.5 1700000000"},
+		{"ns", "?precision=ms", "cpu usage=0.5 1700000000000"},
+		{"s", "?precision=u", "cpu usage=0.5 1700000000000000"},
+		{"ms", "?precision=h", "cpu usage=0.5 472222"},
+	}
+
+	for _, test := range tests {
+		url := initTest(t, test.precision)
+
+		code := write(t, url + test.query, []byte(test.line), false)
+
+		if code != http.StatusNoContent {
+			t.Errorf("%s %s: got status %d", test.precision, test.query, code)
+			continue
+		}
+
+		want := formatTime(1700000000)
+
+		if test.query == "?precision=h" {
+			want = formatTime(472222 * 3600)
+		}
+
+		data, ok := collect(t)["cpu"]
+
+		if !ok || data.Time != want || data.Field["usage"] != 0.5 || data.Tag["node_name"] != "node" {
+			t.Errorf("%s %s: got %+v, want time %s", test.precision, test.query, data, want)
+		}
+	}
+
+	url := initTest(t, "ns")
+
+	code := write(t, url + "?precision=d", []byte("cpu usage=0.5 1"), false)
+
+	if code != http.StatusBadRequest {
+		t.Errorf("invalid precision: got status %d", code)
+	}
+}
+
+func TestWriteGzip(t *testing.T) {
+	url := initTest(t, "s")
+
+	var body bytes.Buffer
+
+	writer := gzip.NewWriter(&body)
+	writer.Write([]byte("cpu,host=a usage=0.5 1700000000\nmem,node_name=b used=3i 1700000000\n"))
+	writer.Close()
+
+	code := write(t, url, body.Bytes(), true)
+
+	if code != http.StatusNoContent {
+		t.Fatalf("got status %d", code)
+	}
+
+	datas := collect(t)
+
+	if datas["cpu"].Tag["host"] != "a" || datas["cpu"].Field["usage"] != 0.5 || datas["cpu"].Time != formatTime(1700000000) {
+		t.Errorf("cpu: got %+v", datas["cpu"])
+	}
+
+	//Node tags sent by clients are kept
+	if datas["mem"].Tag["node_name"] != "b" || datas["mem"].Field["used"] != int64(3) {
+		t.Errorf("mem: got %+v", datas["mem"])
+	}
+
+	if datas["status"].Field["points_received"] != uint64(2) {
+		t.Errorf("status: got %+v", datas["status"])
+	}
+
+	//Body not gzipped
+	code = write(t, url, []byte("cpu usage=0.5"), true)
+
+	if code != http.StatusBadRequest {
+		t.Errorf("invalid gzip: got status %d", code)
+	}
+}
+
+func TestWritePartial(t *testing.T) {
+	url := initTest(t, "ns")
+
+	body := strings.Join([]string{
+		"# comment",
+		"cpu usage=0.5",
+		"cpu usage=NaN",
+		"mem used=",
+		"disk free=1i",
+	}, "\n")
+
+	code := write(t, url, []byte(body), false)
+
+	if code != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", code, http.StatusBadRequest)
+	}
+
+	datas := collect(t)
+
+	//Lines parsed are kept
+	if len(datas) != 3 || datas["status"].Field["parse_errors"] != uint64(2) || datas["status"].Field["points_received"] != uint64(2) {
+		t.Errorf("got %+v", datas)
+	}
+
+	request, _ := http.NewRequest("GET", url, nil)
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d", response.StatusCode)
+	}
+}
@@ -1,53 +1,113 @@
 package main
 
 import(
+	"net"
 	"time"
 	"errors"
 	"strings"
+	"path/filepath"
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+	"github.com/DarkMetrix/monitor/agent/src/filter"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
-var GlobalIncludes map[string]bool
+var GlobalFS *procfs.FS
+var GlobalFilter *filter.Filter
 
-func Init(nodeInfo config.NodeInfo, config map[string]string) error {
-	GlobalIncludes = make(map[string]bool)
+//Interfaces of last collect, used to count link flaps
+var GlobalLastInterfaces map[string]procfs.NetInterface
 
-	_, ok := config["include"]
+//Addresses are read from the agent's network namespace, so they are not reported when root_path is set
+var GlobalReadAddresses bool
 
-	if ok {
-		includes := strings.Split(config["include"], ";")
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	var err error
 
-		for _, include := range includes {
-			GlobalIncludes[include] = true
-		}
+	GlobalFilter, err = filter.NewAnchoredFilter(config["include"], config["exclude"])
+
+	if err != nil {
+		return err
 	}
 
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
+	GlobalLastInterfaces = make(map[string]procfs.NetInterface)
+	GlobalReadAddresses = filepath.Clean(GlobalFS.Root()) == "/"
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	return nil
+}
+
+//Get ipv4 and ipv6 addresses of the interface separated by ','
+func getAddresses(name string) (string, string) {
+	if !GlobalReadAddresses {
+		return "", ""
 	}
 
-	return nil
+	netInterface, err := net.InterfaceByName(name)
+
+	if err != nil {
+		return "", ""
+	}
+
+	addrs, err := netInterface.Addrs()
+
+	if err != nil {
+		return "", ""
+	}
+
+	ipv4 := []string{}
+	ipv6 := []string{}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+
+		if !ok {
+			continue
+		}
+
+		if ipNet.IP.To4() != nil {
+			ipv4 = append(ipv4, ipNet.IP.String())
+		} else {
+			ipv6 = append(ipv6, ipNet.IP.String())
+		}
+	}
+
+	return strings.Join(ipv4, ","), strings.Join(ipv6, ",")
+}
+
+//Count link flaps since last collect
+func getLinkFlaps(info procfs.NetInterface) uint64 {
+	last, ok := GlobalLastInterfaces[info.Name]
+
+	if !ok {
+		return 0
+	}
+
+	//Carrier changes catches flaps between collects, a flap is a down and an up
+	if info.CarrierChanges > last.CarrierChanges {
+		return (info.CarrierChanges - last.CarrierChanges + 1) / 2
+	}
+
+	if info.Up != last.Up || info.OperState != last.OperState || info.Carrier != last.Carrier {
+		return 1
+	}
+
+	return 0
 }
 
 func Collect()(*protocol.Proto, error) {
-	interfaceInfos := GlobalStat.InteraceInfos()
+	interfaceInfos, err := GlobalFS.NetInterfaces()
 
-	if interfaceInfos == nil {
-		return nil, errors.New("InterfaceInfos failed! error:got nil")
+	if err != nil {
+		return nil, errors.New("Read net interfaces failed! error:" + err.Error())
 	}
 
 	proto := protocol.NewProto(1)
@@ -55,15 +115,23 @@ func Collect()(*protocol.Proto, error) {
 	curTime := time.Now()
 	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
 
+	lastInterfaces := make(map[string]procfs.NetInterface)
+
 	for _, info := range interfaceInfos {
-		if len(GlobalIncludes) != 0 {
-			_, ok := GlobalIncludes[info.Name]
+		if !GlobalFilter.Match(info.Name) {
+			continue
+		}
 
-			if !ok {
-				continue
-			}
+		lastInterfaces[info.Name] = info
+
+		state := "down"
+
+		if info.Up {
+			state = "up"
 		}
 
+		ipv4, ipv6 := getAddresses(info.Name)
+
 		data := protocol.NewData()
 		data.Time = currentTime
 
@@ -71,14 +139,23 @@ func Collect()(*protocol.Proto, error) {
 		data.Tag["node_ip"] = GlobalNodeInfo.IP
 
 		data.Tag["interface"] = info.Name
-		data.Tag["factor"] = info.Factor
+		data.Tag["factor"] = 1000000
 		data.Tag["duplex"] = info.Duplex
-		data.Tag["state"] = info.State
+		data.Tag["state"] = state
+		data.Tag["operstate"] = info.OperState
+		data.Tag["mac"] = info.Address
+		data.Tag["ipv4"] = ipv4
+		data.Tag["ipv6"] = ipv6
 
 		data.Field["speed"] = info.Speed
+		data.Field["mtu"] = info.MTU
+		data.Field["carrier_changes"] = info.CarrierChanges
+		data.Field["link_flaps"] = getLinkFlaps(info)
 
 		proto.DataList = append(proto.DataList, *data)
 	}
 
+	GlobalLastInterfaces = lastInterfaces
+
 	return proto, nil
 }
@@ -0,0 +1,81 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test interfaces.go interfaces_test.go
+
+import(
+	"os"
+	"strings"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+)
+
+//Same patterns select the same interfaces as the net input, see net_test.go
+var GlobalInterfaceNames = []string{"bond0", "eth0", "eth1", "lo", "veth0abc"}
+
+var GlobalInterfaceTests = []struct {
+	include string
+	exclude string
+	want string
+}{
+	{"", "", "bond0;eth0;eth1;lo;veth0abc"},
+	{"eth0", "", "eth0"},
+	{"eth[0-9]+;bond.*", "eth1", "bond0;eth0"},
+	{"", "veth.*;lo", "bond0;eth0;eth1"},
+}
+
+//Write /sys/class/net of the interfaces under a root path
+func writeClassNet(t *testing.T) string {
+	root := t.TempDir()
+
+	for _, name := range GlobalInterfaceNames {
+		dir := filepath.Join(root, "sys", "class", "net", name)
+
+		err := os.MkdirAll(dir, 0755)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dir, "mtu"), []byte("1500\n"), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestInterfacesFilter(t *testing.T) {
+	root := writeClassNet(t)
+
+	for _, test := range GlobalInterfaceTests {
+		err := Init(config.NodeInfo{}, map[string]string{"root_path": root, "include": test.include, "exclude": test.exclude})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proto, err := Collect()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := []string{}
+
+		for _, data := range proto.DataList {
+			names = append(names, data.Tag["interface"].(string))
+		}
+
+		got := strings.Join(names, ";")
+
+		if got != test.want {
+			t.Errorf("include %q exclude %q: got %s, want %s", test.include, test.exclude, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import(
+	"os"
+	"time"
+	"errors"
+	"regexp"
+	"strings"
+	"strconv"
+	"syscall"
+	"io/ioutil"
+	"path/filepath"
+	"encoding/json"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/tail"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Rule applied to each line
+type Rule struct {
+	Name string
+	Type string                 //"count" counts matched lines, "extract" also extracts named captures as numbers
+	Pattern *regexp.Regexp
+}
+
+//Values of a rule of a file in one collect
+type Result struct {
+	count uint64
+	sums map[string]float64
+	maxs map[string]float64
+	mins map[string]float64
+	counts map[string]uint64
+}
+
+//Offset of a file saved in the state file
+type State struct {
+	Offset int64 `json:"offset"`
+	Inode uint64 `json:"inode"`
+	Device uint64 `json:"device"`
+}
+
+var GlobalFiles []string
+var GlobalRules []*Rule
+var GlobalStateFile string
+var GlobalFromBeginning bool
+
+//Tailers of files matched, keyed by path
+var GlobalTailers map[string]*tail.Tailer
+
+//Saved states of files not opened yet
+var GlobalStates map[string]State
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalFiles = []string{}
+
+	for _, file := range strings.Split(config["files"], ";") {
+		if len(file) == 0 {
+			continue
+		}
+
+		_, err := filepath.Match(file, "")
+
+		if err != nil {
+			return errors.New("Files pattern '" + file + "' invalid! error:" + err.Error())
+		}
+
+		GlobalFiles = append(GlobalFiles, file)
+	}
+
+	if len(GlobalFiles) == 0 {
+		return errors.New("No file is configured!")
+	}
+
+	GlobalRules = []*Rule{}
+
+	for _, name := range strings.Split(config["rules"], ";") {
+		if len(name) == 0 {
+			continue
+		}
+
+		rule, err := newRule(name)
+
+		if err != nil {
+			return err
+		}
+
+		GlobalRules = append(GlobalRules, rule)
+	}
+
+	if len(GlobalRules) == 0 {
+		return errors.New("No rule is configured!")
+	}
+
+	GlobalStateFile = "../log/logtail_state.json"
+
+	_, ok := config["state_file"]
+
+	if ok {
+		GlobalStateFile = config["state_file"]
+	}
+
+	//Relative path is resolved against the directory of the agent binary like "../conf" and "../log", not the working directory
+	if len(GlobalStateFile) != 0 && !filepath.IsAbs(GlobalStateFile) {
+		executable, err := os.Executable()
+
+		if err == nil {
+			GlobalStateFile = filepath.Join(filepath.Dir(executable), GlobalStateFile)
+		}
+	}
+
+	GlobalFromBeginning = config["from_beginning"] == "true"
+
+	GlobalStates = loadStates()
+	GlobalTailers = make(map[string]*tail.Tailer)
+
+	//Files matched when started are read from the end or the saved offset, files matched later are read from the beginning
+	//unless they are rotated from a file followed
+	paths, err := matchFiles()
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		tailer := newTailer(path, !GlobalFromBeginning)
+		tailer.Open()
+
+		GlobalTailers[path] = tailer
+	}
+
+	return nil
+}
+
+//Create rule from config
+func newRule(name string) (*Rule, error) {
+	pattern, ok := GlobalConfig[name + ":pattern"]
+
+	if !ok {
+		return nil, errors.New("Pattern of rule '" + name + "' is not configured!")
+	}
+
+	compiled, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return nil, errors.New("Compile pattern of rule '" + name + "' failed! error:" + err.Error())
+	}
+
+	rule := &Rule{
+		Name: name,
+		Type: "count",
+		Pattern: compiled,
+	}
+
+	_, ok = GlobalConfig[name + ":type"]
+
+	if ok {
+		rule.Type = GlobalConfig[name + ":type"]
+	}
+
+	switch rule.Type {
+	case "count":
+	case "extract":
+		if len(compiled.SubexpNames()) <= 1 {
+			return nil, errors.New("Pattern of extract rule '" + name + "' should have named captures, e.g.:(?P<cost>[0-9.]+)")
+		}
+	default:
+		return nil, errors.New("Type of rule '" + name + "' invalid! should be count or extract")
+	}
+
+	return rule, nil
+}
+
+//Get paths matched by the file patterns
+func matchFiles() ([]string, error) {
+	paths := []string{}
+
+	for _, pattern := range GlobalFiles {
+		matches, err := filepath.Glob(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			paths = append(paths, match)
+		}
+	}
+
+	return paths, nil
+}
+
+//Create tailer of the path, continue from the saved offset if the file is the same one
+func newTailer(path string, fromEnd bool) *tail.Tailer {
+	tailer := tail.NewTailer(path, fromEnd)
+
+	state, ok := GlobalStates[path]
+
+	if !ok {
+		return tailer
+	}
+
+	delete(GlobalStates, path)
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return tailer
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+
+	//The file is rotated while the agent is not running
+	if !ok || uint64(stat.Ino) != state.Inode || uint64(stat.Dev) != state.Device {
+		return tail.NewTailer(path, false)
+	}
+
+	tailer.SetPosition(state.Offset, info)
+
+	return tailer
+}
+
+//Is the file followed by a tailer of another path, e.g.:"app.log" rotated to "app.log.1" which is drained by the tailer of "app.log"
+func isFollowed(path string) bool {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return false
+	}
+
+	for _, tailer := range GlobalTailers {
+		_, followed := tailer.Position()
+
+		if followed != nil && os.SameFile(followed, info) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Load saved states, empty if not saved
+func loadStates() map[string]State {
+	states := make(map[string]State)
+
+	if len(GlobalStateFile) == 0 {
+		return states
+	}
+
+	content, err := ioutil.ReadFile(GlobalStateFile)
+
+	if err != nil {
+		return states
+	}
+
+	err = json.Unmarshal(content, &states)
+
+	if err != nil {
+		log.Warnf("Parse state file %s failed! error:%s", GlobalStateFile, err)
+		return make(map[string]State)
+	}
+
+	return states
+}
+
+//Save states of all tailers, the state file is replaced atomically
+func saveStates() error {
+	if len(GlobalStateFile) == 0 {
+		return nil
+	}
+
+	states := make(map[string]State)
+
+	for path, tailer := range GlobalTailers {
+		offset, info := tailer.Position()
+
+		if info == nil {
+			continue
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+
+		if !ok {
+			continue
+		}
+
+		states[path] = State{
+			Offset: offset,
+			Inode: uint64(stat.Ino),
+			Device: uint64(stat.Dev),
+		}
+	}
+
+	content, err := json.Marshal(states)
+
+	if err != nil {
+		return err
+	}
+
+	temp := GlobalStateFile + ".tmp"
+
+	err = ioutil.WriteFile(temp, content, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp, GlobalStateFile)
+}
+
+//Apply rules to the lines
+func applyRules(lines []string) []*Result {
+	results := make([]*Result, len(GlobalRules))
+
+	for index := range GlobalRules {
+		results[index] = &Result{
+			sums: make(map[string]float64),
+			maxs: make(map[string]float64),
+			mins: make(map[string]float64),
+			counts: make(map[string]uint64),
+		}
+	}
+
+	for _, line := range lines {
+		for index, rule := range GlobalRules {
+			result := results[index]
+
+			if rule.Type == "count" {
+				if rule.Pattern.MatchString(line) {
+					result.count++
+				}
+
+				continue
+			}
+
+			matches := rule.Pattern.FindStringSubmatch(line)
+
+			if matches == nil {
+				continue
+			}
+
+			result.count++
+
+			for captureIndex, name := range rule.Pattern.SubexpNames() {
+				if len(name) == 0 {
+					continue
+				}
+
+				value, err := strconv.ParseFloat(matches[captureIndex], 64)
+
+				if err != nil {
+					continue
+				}
+
+				if result.counts[name] == 0 || value > result.maxs[name] {
+					result.maxs[name] = value
+				}
+
+				if result.counts[name] == 0 || value < result.mins[name] {
+					result.mins[name] = value
+				}
+
+				result.sums[name] += value
+				result.counts[name]++
+			}
+		}
+	}
+
+	return results
+}
+
+func Collect()(*protocol.Proto, error) {
+	paths, err := matchFiles()
+
+	if err != nil {
+		return nil, errors.New("Match files failed! error:" + err.Error())
+	}
+
+	matched := make(map[string]bool)
+
+	for _, path := range paths {
+		matched[path] = true
+
+		_, ok := GlobalTailers[path]
+
+		//A rotated file is read from the end, its lines have been read by the tailer of the old path
+		if !ok {
+			GlobalTailers[path] = newTailer(path, isFollowed(path))
+		}
+	}
+
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	for path, tailer := range GlobalTailers {
+		lines, err := tailer.Read()
+
+		if err != nil && !os.IsNotExist(err) {
+			log.Warnf("Read %s failed! error:%s", path, err)
+		}
+
+		//The file is removed or renamed to a name not matched, it is drained and closed
+		if !matched[path] {
+			tailer.Close()
+			delete(GlobalTailers, path)
+		}
+
+		results := applyRules(lines)
+
+		for index, rule := range GlobalRules {
+			result := results[index]
+
+			data := protocol.NewData()
+			data.Time = currentTime
+
+			data.Tag["node_name"] = GlobalNodeInfo.Name
+			data.Tag["node_ip"] = GlobalNodeInfo.IP
+			data.Tag["file"] = path
+			data.Tag["rule"] = rule.Name
+
+			//All values are floats like the extracted values, so the types are not mixed in one measurement
+			data.Field["count"] = float64(result.count)
+
+			for name, count := range result.counts {
+				data.Field[name + "_sum"] = result.sums[name]
+				data.Field[name + "_avg"] = result.sums[name] / float64(count)
+				data.Field[name + "_max"] = result.maxs[name]
+				data.Field[name + "_min"] = result.mins[name]
+			}
+
+			proto.DataList = append(proto.DataList, *data)
+		}
+	}
+
+	err = saveStates()
+
+	if err != nil {
+		log.Warnf("Save state file %s failed! error:%s", GlobalStateFile, err)
+	}
+
+	return proto, nil
+}
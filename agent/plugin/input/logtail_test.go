@@ -0,0 +1,385 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test logtail.go logtail_test.go
+
+import(
+	"os"
+	"regexp"
+	"syscall"
+	"testing"
+	"io/ioutil"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+func appendLog(t *testing.T, path string, content string) {
+	file, err := os.OpenFile(path, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	_, err = file.WriteString(content)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+//Collect and get the count of the rule of each file
+func collectCounts(t *testing.T, rule string) map[string]interface{} {
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]interface{})
+
+	for _, data := range proto.DataList {
+		if data.Tag["rule"] == rule {
+			counts[filepath.Base(data.Tag["file"].(string))] = data.Field["count"]
+		}
+	}
+
+	return counts
+}
+
+func checkCounts(t *testing.T, name string, counts map[string]interface{}, want map[string]float64) {
+	if len(counts) != len(want) {
+		t.Errorf("%s: got %v, want %v", name, counts, want)
+	}
+
+	for file, count := range want {
+		if counts[file] != count {
+			t.Errorf("%s: %s got count %v, want %v", name, file, counts[file], count)
+		}
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	GlobalRules = []*Rule{
+		{Name: "errors", Type: "count", Pattern: regexp.MustCompile("ERROR")},
+		{Name: "cost", Type: "extract", Pattern: regexp.MustCompile(`cost=(?P<cost>[0-9.]+)ms(?: size=(?P<size>[0-9]+))?`)},
+	}
+
+	results := applyRules([]string{
+		"ERROR cost=5ms size=100",
+		"INFO cost=1.5ms",
+		"INFO cost=-1ms",
+		//Matched but not a number
+		"WARN cost=1.2.3ms",
+		"ERROR timeout",
+		"INFO cost=12.25ms size=20",
+	})
+
+	if results[0].count != 2 {
+		t.Errorf("errors: got count %d, want 2", results[0].count)
+	}
+
+	cost := results[1]
+
+	if cost.count != 4 {
+		t.Errorf("cost: got count %d, want 4", cost.count)
+	}
+
+	tests := []struct {
+		name string
+		got interface{}
+		want interface{}
+	}{
+		{"cost_count", cost.counts["cost"], uint64(3)},
+		{"cost_sum", cost.sums["cost"], 18.75},
+		{"cost_max", cost.maxs["cost"], 12.25},
+		{"cost_min", cost.mins["cost"], 1.5},
+		//Optional capture not matched is skipped
+		{"size_count", cost.counts["size"], uint64(2)},
+		{"size_max", cost.maxs["size"], float64(100)},
+		{"size_min", cost.mins["size"], float64(20)},
+	}
+
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestCollectExtract(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	appendLog(t, path, "cost=4ms\n")
+
+	err := Init(config.NodeInfo{}, map[string]string{
+		"files": path,
+		"rules": "cost",
+		"cost:pattern": `cost=(?P<cost>[0-9.]+)ms`,
+		"cost:type": "extract",
+		"state_file": "",
+		"from_beginning": "true",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The incomplete last line is read when completed
+	appendLog(t, path, "cost=1ms\ncost=")
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(proto.DataList) != 1 {
+		t.Fatalf("got %+v", proto.DataList)
+	}
+
+	fields := map[string]interface{}{
+		"count": float64(2),
+		"cost_sum": float64(5),
+		"cost_avg": 2.5,
+		"cost_max": float64(4),
+		"cost_min": float64(1),
+	}
+
+	data := proto.DataList[0]
+
+	for key, value := range fields {
+		if data.Field[key] != value {
+			t.Errorf("field %s got %v(%T), want %v(%T)", key, data.Field[key], data.Field[key], value, value)
+		}
+	}
+
+	appendLog(t, path, "7ms\n")
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proto.DataList[0].Field["cost_avg"] != float64(7) {
+		t.Errorf("got %+v, want cost_avg 7", proto.DataList[0].Field)
+	}
+}
+
+//Write the state of the file with the offset, the inode is changed if rotated
+func writeState(t *testing.T, stateFile string, path string, offset int64, rotated bool) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat := info.Sys().(*syscall.Stat_t)
+
+	state := State{
+		Offset: offset,
+		Inode: uint64(stat.Ino),
+		Device: uint64(stat.Dev),
+	}
+
+	if rotated {
+		state.Inode++
+	}
+
+	content, err := json.Marshal(map[string]State{path: state})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(stateFile, content, 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	stateFile := filepath.Join(dir, "state.json")
+
+	options := map[string]string{
+		"files": path,
+		"rules": "all",
+		"all:pattern": ".",
+		"state_file": stateFile,
+	}
+
+	//Lines 'b' and 'c' are written after the saved offset while the agent is not running
+	appendLog(t, path, "a\nb\nc\n")
+
+	tests := []struct {
+		name string
+		state bool
+		rotated bool
+		want float64
+	}{
+		{"no_state", false, false, 1},
+		{"same_file", true, false, 3},
+		//The inode or device does not match, the file is read from the beginning
+		{"rotated", true, true, 4},
+	}
+
+	for _, test := range tests {
+		os.Remove(stateFile)
+
+		if test.state {
+			writeState(t, stateFile, path, 2, test.rotated)
+		}
+
+		err := Init(config.NodeInfo{}, options)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		appendLog(t, path, "d\n")
+
+		checkCounts(t, test.name, collectCounts(t, "all"), map[string]float64{"app.log": test.want})
+
+		//Restore the file
+		err = ioutil.WriteFile(path, []byte("a\nb\nc\n"), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//The state is saved every collect, lines written while the agent is stopped are read after restarted
+	os.Remove(stateFile)
+
+	err := Init(config.NodeInfo{}, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCounts(t, "saved", collectCounts(t, "all"), map[string]float64{"app.log": 0})
+
+	appendLog(t, path, "e\nf\n")
+
+	err = Init(config.NodeInfo{}, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCounts(t, "restarted", collectCounts(t, "all"), map[string]float64{"app.log": 2})
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	appendLog(t, path, "a\n")
+
+	err := Init(config.NodeInfo{}, map[string]string{
+		"files": path + "*",
+		"rules": "all",
+		"all:pattern": ".",
+		"state_file": "",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Lines before started are not read
+	appendLog(t, path, "b\n")
+
+	checkCounts(t, "started", collectCounts(t, "all"), map[string]float64{"app.log": 1})
+
+	//Rotated, the old file is drained by the tailer of app.log and app.log.1 is read from the end
+	appendLog(t, path, "c\n")
+
+	err = os.Rename(path, path + ".1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendLog(t, path, "d\ne\n")
+
+	if !isFollowed(path + ".1") {
+		t.Errorf("app.log.1 should be followed by the tailer of app.log")
+	}
+
+	//A file matched later and not rotated from a file followed is read from the beginning
+	appendLog(t, path + ".2", "x\ny\n")
+
+	if isFollowed(path + ".2") {
+		t.Errorf("app.log.2 should not be followed")
+	}
+
+	checkCounts(t, "rotated", collectCounts(t, "all"), map[string]float64{"app.log": 3, "app.log.1": 0, "app.log.2": 2})
+
+	//Lines written to the old file by the logger not reopened yet
+	appendLog(t, path + ".1", "f\n")
+
+	checkCounts(t, "late", collectCounts(t, "all"), map[string]float64{"app.log": 0, "app.log.1": 1, "app.log.2": 0})
+
+	//Removed files are drained and no longer reported
+	appendLog(t, path + ".2", "z\n")
+
+	err = os.Remove(path + ".2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkCounts(t, "removed", collectCounts(t, "all"), map[string]float64{"app.log": 0, "app.log.1": 0, "app.log.2": 1})
+	checkCounts(t, "closed", collectCounts(t, "all"), map[string]float64{"app.log": 0, "app.log.1": 0})
+}
+
+//All values of a rule are floats in one measurement
+func TestFieldTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	appendLog(t, path, "")
+
+	err := Init(config.NodeInfo{}, map[string]string{
+		"files": path,
+		"rules": "errors;cost",
+		"errors:pattern": "ERROR",
+		"cost:pattern": `cost=(?P<cost>[0-9]+)`,
+		"cost:type": "extract",
+		"state_file": "",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendLog(t, path, "ERROR cost=3\n")
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFloats(t, proto)
+}
+
+func checkFloats(t *testing.T, proto *protocol.Proto) {
+	for _, data := range proto.DataList {
+		for key, value := range data.Field {
+			_, ok := value.(float64)
+
+			if !ok {
+				t.Errorf("%s: field %s got %T, want float64", data.Tag["rule"], key, value)
+			}
+		}
+	}
+}
@@ -3,39 +3,109 @@ package main
 import(
 	"time"
 	"errors"
+	"strings"
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
+var GlobalFS *procfs.FS
+
+//Counters in /proc/vmstat to report
+var GlobalVMStats []string
+
+//Fields reported directly from /proc/meminfo
+var GlobalMemInfoFields = map[string]string{
+	"buffers": "Buffers",
+	"shared": "Shmem",
+	"slab": "Slab",
+	"slab_reclaimable": "SReclaimable",
+	"slab_unreclaimable": "SUnreclaim",
+	"dirty": "Dirty",
+	"writeback": "Writeback",
+	"committed_as": "Committed_AS",
+	"hugepages_total": "HugePages_Total",
+	"hugepages_free": "HugePages_Free",
+	"hugepages_rsvd": "HugePages_Rsvd",
+	"hugepages_surp": "HugePages_Surp",
+	"hugepage_size": "Hugepagesize",
+}
 
 func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
+	GlobalVMStats = []string{"oom_kill", "pgmajfault", "pgfault", "pswpin", "pswpout"}
+
+	vmStats, ok := config["vmstat"]
+
+	if ok {
+		GlobalVMStats = []string{}
+
+		for _, vmStat := range strings.Split(vmStats, ";") {
+			if len(vmStat) == 0 {
+				continue
+			}
+
+			GlobalVMStats = append(GlobalVMStats, vmStat)
+		}
+	}
+
+	_, err := GlobalFS.MemInfo()
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	if err != nil {
+		return errors.New("Read meminfo failed! error:" + err.Error())
 	}
 
 	return nil
 }
 
+//Calculate percentage
+func percent(value uint64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(value) * 100 / float64(total)
+}
+
+//Subtract without underflow
+func subtract(value uint64, others ...uint64) uint64 {
+	for _, other := range others {
+		if value < other {
+			return 0
+		}
+
+		value -= other
+	}
+
+	return value
+}
+
 func Collect()(*protocol.Proto, error) {
-	memoryStat := GlobalStat.MemStats()
+	memInfo, err := GlobalFS.MemInfo()
+
+	if err != nil {
+		return nil, errors.New("Read meminfo failed! error:" + err.Error())
+	}
+
+	total := memInfo["MemTotal"]
 
-	if memoryStat == nil {
-		return nil, errors.New("MemStats failed! error:got nil")
+	//MemAvailable is estimated by kernel since 3.14, page cache and reclaimable slab are available for applications
+	available, ok := memInfo["MemAvailable"]
+
+	if !ok {
+		available = memInfo["MemFree"] + memInfo["Buffers"] + memInfo["Cached"] + memInfo["SReclaimable"]
 	}
 
+	used := subtract(total, available)
+
 	proto := protocol.NewProto(1)
 
 	curTime := time.Now()
@@ -46,15 +116,57 @@ func Collect()(*protocol.Proto, error) {
 
 	data.Tag["node_name"] = GlobalNodeInfo.Name
 	data.Tag["node_ip"] = GlobalNodeInfo.IP
-	data.Field["total"] = memoryStat.Total
-	data.Field["free"] = memoryStat.Free
-	data.Field["used"] = memoryStat.Used
-	data.Field["cache"] = memoryStat.Cache
-	data.Field["swap_total"] = memoryStat.SwapTotal
-	data.Field["swap_free"] = memoryStat.SwapFree
-	data.Field["swap_used"] = memoryStat.SwapUsed
+	data.Field["total"] = total
+	data.Field["free"] = memInfo["MemFree"]
+	data.Field["used"] = used
+	data.Field["cache"] = memInfo["Cached"]
+	data.Field["available"] = available
+	data.Field["swap_total"] = memInfo["SwapTotal"]
+	data.Field["swap_free"] = memInfo["SwapFree"]
+	data.Field["swap_used"] = subtract(memInfo["SwapTotal"], memInfo["SwapFree"])
+
+	for field, key := range GlobalMemInfoFields {
+		value, ok := memInfo[key]
+
+		if !ok {
+			continue
+		}
+
+		data.Field[field] = value
+	}
+
+	if len(GlobalVMStats) != 0 {
+		vmStat, err := GlobalFS.VMStat()
+
+		if err != nil {
+			return nil, errors.New("Read vmstat failed! error:" + err.Error())
+		}
+
+		//Some counters do not exist on older kernels, e.g.:oom_kill since 4.13
+		for _, key := range GlobalVMStats {
+			value, ok := vmStat[key]
+
+			if !ok {
+				continue
+			}
+
+			data.Field[key] = value
+		}
+	}
 
 	proto.DataList = append(proto.DataList, *data)
 
+	//Percentages are floats, so they are reported to the 'memory_percent' measurement instead of mixing with the integer counters
+	percentData := protocol.NewData()
+	percentData.Name = "percent"
+	percentData.Time = currentTime
+
+	percentData.Tag["node_name"] = GlobalNodeInfo.Name
+	percentData.Tag["node_ip"] = GlobalNodeInfo.IP
+	percentData.Field["used_percent"] = percent(used, total)
+	percentData.Field["available_percent"] = percent(available, total)
+
+	proto.DataList = append(proto.DataList, *percentData)
+
 	return proto, nil
 }
@@ -0,0 +1,525 @@
+package main
+
+import(
+	"time"
+	"errors"
+	"strings"
+	"strconv"
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/filter"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+var GlobalDB *sql.DB
+var GlobalAddress string
+
+//Metric groups to collect
+var GlobalGroups map[string]bool
+
+//Global status and global variables to report as they are, names are case insensitive
+var GlobalStatus []string
+var GlobalVariables []string
+
+//Schema filter of table sizes
+var GlobalSchemaFilter *filter.Filter
+
+//Global status and time of last status collected, used to calculate rates
+var GlobalLastStatus map[string]float64
+var GlobalLastTime time.Time
+
+const DefaultGroups = "global_status;global_variables;replication"
+const DefaultStatus = "Threads_connected;Threads_running;Threads_created;Max_used_connections;Connections;Aborted_connects;Aborted_clients;Questions;Slow_queries;Bytes_received;Bytes_sent;Created_tmp_disk_tables;Innodb_row_lock_waits;Innodb_row_lock_current_waits;Innodb_row_lock_time;Innodb_buffer_pool_pages_dirty;Innodb_buffer_pool_pages_free;Innodb_buffer_pool_pages_total;Innodb_buffer_pool_wait_free;Uptime"
+const DefaultVariables = "max_connections;innodb_buffer_pool_size;read_only;long_query_time;table_open_cache"
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	var err error
+
+	dsn, ok := config["dsn"]
+
+	if !ok {
+		return errors.New("dsn is not configured!")
+	}
+
+	mysqlConfig, err := mysql.ParseDSN(dsn)
+
+	if err != nil {
+		return errors.New("Parse dsn failed! error:" + err.Error())
+	}
+
+	timeout := 5
+
+	_, ok = config["timeout"]
+
+	if ok {
+		timeout, err = strconv.Atoi(config["timeout"])
+
+		if err != nil {
+			return errors.New("Parse timeout failed! error:" + err.Error())
+		}
+	}
+
+	//A hanging mysqld should not block the collect forever
+	if mysqlConfig.Timeout == 0 {
+		mysqlConfig.Timeout = time.Duration(timeout) * time.Second
+	}
+
+	if mysqlConfig.ReadTimeout == 0 {
+		mysqlConfig.ReadTimeout = time.Duration(timeout) * time.Second
+	}
+
+	connector, err := mysql.NewConnector(mysqlConfig)
+
+	if err != nil {
+		return errors.New("Create mysql connector failed! error:" + err.Error())
+	}
+
+	if GlobalDB != nil {
+		GlobalDB.Close()
+	}
+
+	GlobalDB = sql.OpenDB(connector)
+	GlobalDB.SetMaxOpenConns(1)
+	GlobalDB.SetMaxIdleConns(1)
+
+	GlobalAddress = mysqlConfig.Addr
+
+	groups, ok := config["groups"]
+
+	if !ok {
+		groups = DefaultGroups
+	}
+
+	GlobalGroups = make(map[string]bool)
+
+	for _, group := range strings.Split(groups, ";") {
+		switch group {
+		case "global_status", "global_variables", "replication", "table_sizes":
+			GlobalGroups[group] = true
+		case "":
+		default:
+			return errors.New("Group '" + group + "' invalid! should be global_status, global_variables, replication or table_sizes")
+		}
+	}
+
+	status, ok := config["status"]
+
+	if !ok {
+		status = DefaultStatus
+	}
+
+	GlobalStatus = splitNames(status)
+
+	variables, ok := config["variables"]
+
+	if !ok {
+		variables = DefaultVariables
+	}
+
+	GlobalVariables = splitNames(variables)
+
+	//System schemas are excluded by default
+	exclude, ok := config["exclude_schema"]
+
+	if !ok {
+		exclude = "^mysql$;^information_schema$;^performance_schema$;^sys$"
+	}
+
+	GlobalSchemaFilter, err = filter.NewFilter(config["include_schema"], exclude)
+
+	if err != nil {
+		return err
+	}
+
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalLastStatus = nil
+	GlobalLastTime = time.Now()
+
+	return nil
+}
+
+//Split names separated by ';' and convert to lower case
+func splitNames(names string) []string {
+	result := []string{}
+
+	for _, name := range strings.Split(names, ";") {
+		if len(name) == 0 {
+			continue
+		}
+
+		result = append(result, strings.ToLower(name))
+	}
+
+	return result
+}
+
+//Query 'name value' rows, e.g.:SHOW GLOBAL STATUS, names are converted to lower case
+func queryNameValues(query string) (map[string]string, error) {
+	rows, err := GlobalDB.Query(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	values := make(map[string]string)
+
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+
+		err = rows.Scan(&name, &value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[strings.ToLower(name)] = value.String
+	}
+
+	return values, rows.Err()
+}
+
+//Query rows of any columns as strings, column names are converted to lower case
+func queryRows(query string) ([]map[string]string, error) {
+	rows, err := GlobalDB.Query(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]string{}
+
+	for rows.Next() {
+		values := make([]sql.RawBytes, len(columns))
+		pointers := make([]interface{}, len(columns))
+
+		for index := range values {
+			pointers[index] = &values[index]
+		}
+
+		err = rows.Scan(pointers...)
+
+		if err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]string)
+
+		for index, column := range columns {
+			if values[index] != nil {
+				row[strings.ToLower(column)] = string(values[index])
+			}
+		}
+
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+//Convert value to number, ON/OFF and YES/NO are converted to 1 and 0
+func parseValue(value string) (float64, bool) {
+	switch strings.ToUpper(value) {
+	case "ON", "YES", "TRUE":
+		return 1, true
+	case "OFF", "NO", "FALSE":
+		return 0, true
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return number, true
+}
+
+//Create data with common tags
+func newData(currentTime string, dataType string) *protocol.Data {
+	data := protocol.NewData()
+	data.Time = currentTime
+
+	data.Tag["node_name"] = GlobalNodeInfo.Name
+	data.Tag["node_ip"] = GlobalNodeInfo.IP
+	data.Tag["server"] = GlobalAddress
+	data.Tag["type"] = dataType
+
+	return data
+}
+
+//Collect global status with rates and ratios since the last status collected
+func collectStatus(data *protocol.Data, curTime time.Time) error {
+	values, err := queryNameValues("SHOW GLOBAL STATUS")
+
+	if err != nil {
+		return errors.New("Show global status failed! error:" + err.Error())
+	}
+
+	status := make(map[string]float64)
+
+	for name, value := range values {
+		number, ok := parseValue(value)
+
+		if ok {
+			status[name] = number
+		}
+	}
+
+	for _, name := range GlobalStatus {
+		value, ok := status[name]
+
+		if ok {
+			data.Field[name] = value
+		}
+	}
+
+	//Counters are reset when mysqld restarts
+	last := GlobalLastStatus
+	seconds := curTime.Sub(GlobalLastTime).Seconds()
+
+	GlobalLastStatus = status
+	GlobalLastTime = curTime
+
+	if last == nil || seconds <= 0 || status["uptime"] < last["uptime"] {
+		return nil
+	}
+
+	delta := func(names ...string) float64 {
+		var sum float64
+
+		for _, name := range names {
+			sum += status[name] - last[name]
+		}
+
+		return sum
+	}
+
+	data.Field["qps"] = delta("questions") / seconds
+	data.Field["tps"] = delta("com_commit", "com_rollback") / seconds
+	data.Field["slow_queries_per_second"] = delta("slow_queries") / seconds
+	data.Field["connections_per_second"] = delta("connections") / seconds
+	data.Field["row_lock_waits_per_second"] = delta("innodb_row_lock_waits") / seconds
+
+	//Read requests not satisfied by the buffer pool read from disk
+	requests := delta("innodb_buffer_pool_read_requests")
+
+	if requests > 0 {
+		data.Field["innodb_buffer_pool_hit_ratio"] = (1 - delta("innodb_buffer_pool_reads") / requests) * 100
+	}
+
+	return nil
+}
+
+//Collect selected global variables
+func collectVariables(data *protocol.Data) error {
+	values, err := queryNameValues("SHOW GLOBAL VARIABLES")
+
+	if err != nil {
+		return errors.New("Show global variables failed! error:" + err.Error())
+	}
+
+	for _, name := range GlobalVariables {
+		number, ok := parseValue(values[name])
+
+		if ok {
+			data.Field[name] = number
+		}
+	}
+
+	return nil
+}
+
+//Collect replication status of each channel, nothing is reported if it is not a replica
+func collectReplication(currentTime string) ([]protocol.Data, error) {
+	//SHOW REPLICA STATUS is supported since 8.0.22, the columns are renamed from 'master' and 'slave' to 'source' and 'replica'
+	rows, err := queryRows("SHOW REPLICA STATUS")
+
+	if err != nil {
+		rows, err = queryRows("SHOW SLAVE STATUS")
+	}
+
+	if err != nil {
+		return nil, errors.New("Show replica status failed! error:" + err.Error())
+	}
+
+	datas := []protocol.Data{}
+
+	for _, row := range rows {
+		get := func(names ...string) string {
+			for _, name := range names {
+				value, ok := row[name]
+
+				if ok {
+					return value
+				}
+			}
+
+			return ""
+		}
+
+		data := newData(currentTime, "replication")
+
+		data.Tag["channel"] = get("channel_name")
+		data.Tag["source_host"] = get("source_host", "master_host")
+
+		ioRunning := get("replica_io_running", "slave_io_running")
+		sqlRunning := get("replica_sql_running", "slave_sql_running")
+
+		//All values are floats like the status and variables, so the types are not mixed in one measurement
+		data.Field["io_running"] = float64(0)
+		data.Field["sql_running"] = float64(0)
+
+		if ioRunning == "Yes" {
+			data.Field["io_running"] = float64(1)
+		}
+
+		if sqlRunning == "Yes" {
+			data.Field["sql_running"] = float64(1)
+		}
+
+		//Lag is NULL when replication is not running
+		lag, err := strconv.ParseFloat(get("seconds_behind_source", "seconds_behind_master"), 64)
+
+		if err == nil {
+			data.Field["lag"] = lag
+		}
+
+		errno, err := strconv.ParseFloat(get("last_errno"), 64)
+
+		if err == nil {
+			data.Field["last_errno"] = errno
+		}
+
+		datas = append(datas, *data)
+	}
+
+	return datas, nil
+}
+
+//Collect sizes of each table
+func collectTableSizes(currentTime string) ([]protocol.Data, error) {
+	rows, err := GlobalDB.Query("SELECT table_schema, table_name, IFNULL(table_rows, 0), IFNULL(data_length, 0), IFNULL(index_length, 0), IFNULL(data_free, 0) FROM information_schema.tables WHERE table_type = 'BASE TABLE'")
+
+	if err != nil {
+		return nil, errors.New("Query table sizes failed! error:" + err.Error())
+	}
+
+	defer rows.Close()
+
+	datas := []protocol.Data{}
+
+	for rows.Next() {
+		var schema, table string
+		var tableRows, dataLength, indexLength, dataFree uint64
+
+		err = rows.Scan(&schema, &table, &tableRows, &dataLength, &indexLength, &dataFree)
+
+		if err != nil {
+			return nil, errors.New("Scan table sizes failed! error:" + err.Error())
+		}
+
+		if !GlobalSchemaFilter.Match(schema) {
+			continue
+		}
+
+		data := newData(currentTime, "table")
+
+		data.Tag["schema"] = schema
+		data.Tag["table"] = table
+
+		data.Field["rows"] = float64(tableRows)
+		data.Field["data_length"] = float64(dataLength)
+		data.Field["index_length"] = float64(indexLength)
+		data.Field["data_free"] = float64(dataFree)
+
+		datas = append(datas, *data)
+	}
+
+	return datas, rows.Err()
+}
+
+//Groups are collected independently, a failed group is logged and the others are still reported
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	errs := []string{}
+
+	if GlobalGroups["global_status"] || GlobalGroups["global_variables"] {
+		data := newData(currentTime, "status")
+
+		if GlobalGroups["global_status"] {
+			err := collectStatus(data, curTime)
+
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		if GlobalGroups["global_variables"] {
+			err := collectVariables(data)
+
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		if len(data.Field) != 0 {
+			proto.DataList = append(proto.DataList, *data)
+		}
+	}
+
+	if GlobalGroups["replication"] {
+		datas, err := collectReplication(currentTime)
+
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+
+		proto.DataList = append(proto.DataList, datas...)
+	}
+
+	if GlobalGroups["table_sizes"] {
+		datas, err := collectTableSizes(currentTime)
+
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+
+		proto.DataList = append(proto.DataList, datas...)
+	}
+
+	if len(errs) != 0 && len(proto.DataList) == 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+
+	for _, err := range errs {
+		log.Warnf("%s", err)
+	}
+
+	return proto, nil
+}
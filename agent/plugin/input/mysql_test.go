@@ -0,0 +1,331 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test mysql.go mysql_test.go
+
+import(
+	"io"
+	"sync"
+	"errors"
+	"testing"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Result of a query of the fake driver
+type FakeResult struct {
+	columns []string
+	rows [][]driver.Value
+	err error
+}
+
+//Fake mysqld answers queries with the results set by tests
+type FakeServer struct {
+	sync.Mutex
+
+	results map[string]*FakeResult
+}
+
+func (server *FakeServer) set(query string, result *FakeResult) {
+	server.Lock()
+	defer server.Unlock()
+
+	server.results[query] = result
+}
+
+func (server *FakeServer) Open(name string) (driver.Conn, error) {
+	return &FakeConn{server: server}, nil
+}
+
+type FakeConn struct {
+	server *FakeServer
+}
+
+func (conn *FakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &FakeStmt{conn: conn, query: query}, nil
+}
+
+func (conn *FakeConn) Close() error {
+	return nil
+}
+
+func (conn *FakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("Transactions are not supported")
+}
+
+type FakeStmt struct {
+	conn *FakeConn
+	query string
+}
+
+func (stmt *FakeStmt) Close() error {
+	return nil
+}
+
+func (stmt *FakeStmt) NumInput() int {
+	return 0
+}
+
+func (stmt *FakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("Exec is not supported")
+}
+
+func (stmt *FakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	stmt.conn.server.Lock()
+	defer stmt.conn.server.Unlock()
+
+	result, ok := stmt.conn.server.results[stmt.query]
+
+	if !ok {
+		return nil, errors.New("Error 1064: You have an error in your SQL syntax")
+	}
+
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	return &FakeRows{result: result}, nil
+}
+
+type FakeRows struct {
+	result *FakeResult
+	index int
+}
+
+func (rows *FakeRows) Columns() []string {
+	return rows.result.columns
+}
+
+func (rows *FakeRows) Close() error {
+	return nil
+}
+
+func (rows *FakeRows) Next(dest []driver.Value) error {
+	if rows.index >= len(rows.result.rows) {
+		return io.EOF
+	}
+
+	copy(dest, rows.result.rows[rows.index])
+	rows.index++
+
+	return nil
+}
+
+//Name value rows of SHOW GLOBAL STATUS and SHOW GLOBAL VARIABLES
+func nameValues(pairs ...string) *FakeResult {
+	result := &FakeResult{columns: []string{"Variable_name", "Value"}}
+
+	for index := 0; index + 1 < len(pairs); index += 2 {
+		result.rows = append(result.rows, []driver.Value{pairs[index], pairs[index + 1]})
+	}
+
+	return result
+}
+
+var GlobalFakeServer = &FakeServer{results: make(map[string]*FakeResult)}
+
+func init() {
+	sql.Register("fakemysql", GlobalFakeServer)
+}
+
+//Init with the dsn and use the fake driver instead of connecting
+func initFake(t *testing.T, options map[string]string) {
+	options["dsn"] = "monitor:password@tcp(127.0.0.1:3306)/"
+
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	GlobalDB.Close()
+
+	GlobalDB, err = sql.Open("fakemysql", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getData(proto *protocol.Proto, dataType string) *protocol.Data {
+	for index := range proto.DataList {
+		if proto.DataList[index].Tag["type"] == dataType {
+			return &proto.DataList[index]
+		}
+	}
+
+	return nil
+}
+
+func TestCollect(t *testing.T) {
+	server := GlobalFakeServer
+
+	server.set("SHOW GLOBAL STATUS", nameValues("Questions", "1000", "Com_commit", "10", "Com_rollback", "0", "Uptime", "100", "Threads_connected", "5", "Innodb_buffer_pool_read_requests", "1000", "Innodb_buffer_pool_reads", "10"))
+	server.set("SHOW GLOBAL VARIABLES", nameValues("max_connections", "151", "read_only", "ON"))
+	server.set("SHOW REPLICA STATUS", &FakeResult{
+		columns: []string{"Channel_Name", "Source_Host", "Replica_IO_Running", "Replica_SQL_Running", "Seconds_Behind_Source", "Last_Errno"},
+		rows: [][]driver.Value{{"", "10.0.0.1", "Yes", "No", nil, "1062"}},
+	})
+
+	//No privilege on information_schema
+	server.set("SELECT table_schema, table_name, IFNULL(table_rows, 0), IFNULL(data_length, 0), IFNULL(index_length, 0), IFNULL(data_free, 0) FROM information_schema.tables WHERE table_type = 'BASE TABLE'", &FakeResult{
+		err: errors.New("Error 1142: SELECT command denied"),
+	})
+
+	initFake(t, map[string]string{
+		"groups": "global_status;global_variables;replication;table_sizes",
+	})
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := getData(proto, "status")
+
+	if status == nil {
+		t.Fatalf("status not reported: %+v", proto.DataList)
+	}
+
+	fields := map[string]interface{}{
+		"questions": float64(1000),
+		"threads_connected": float64(5),
+		"uptime": float64(100),
+		"max_connections": float64(151),
+		"read_only": float64(1),
+	}
+
+	for key, value := range fields {
+		if status.Field[key] != value {
+			t.Errorf("status: field %s got %v, want %v", key, status.Field[key], value)
+		}
+	}
+
+	//Rates need the last collect
+	_, ok := status.Field["qps"]
+
+	if ok {
+		t.Errorf("qps should not be reported in the first collect")
+	}
+
+	replication := getData(proto, "replication")
+
+	if replication == nil || replication.Tag["source_host"] != "10.0.0.1" || replication.Field["io_running"] != float64(1) || replication.Field["sql_running"] != float64(0) || replication.Field["last_errno"] != float64(1062) {
+		t.Errorf("replication: got %+v", replication)
+	}
+
+	//Lag is NULL when replication is not running
+	_, ok = replication.Field["lag"]
+
+	if ok {
+		t.Errorf("lag should not be reported when it is NULL")
+	}
+
+	//All groups are reported to one measurement, so all values are floats
+	for _, data := range proto.DataList {
+		for key, value := range data.Field {
+			_, ok := value.(float64)
+
+			if !ok {
+				t.Errorf("%s: field %s got %T, want float64", data.Tag["type"], key, value)
+			}
+		}
+	}
+
+	//The table sizes group failed, the other groups are still reported
+	if getData(proto, "table") != nil {
+		t.Errorf("table sizes should not be reported")
+	}
+
+	//Global status failed, the variables are still reported and the rates are calculated since the last status collected
+	server.set("SHOW GLOBAL STATUS", &FakeResult{err: errors.New("Error 2013: Lost connection")})
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status = getData(proto, "status")
+
+	if status == nil || status.Field["max_connections"] != float64(151) {
+		t.Errorf("variables should be reported when global status failed: %+v", status)
+	}
+
+	_, ok = status.Field["questions"]
+
+	if ok {
+		t.Errorf("questions should not be reported when global status failed")
+	}
+
+	if GlobalLastStatus["questions"] != 1000 {
+		t.Errorf("last status should be kept when global status failed")
+	}
+
+	lastTime := GlobalLastTime
+
+	server.set("SHOW GLOBAL STATUS", nameValues("Questions", "1500", "Com_commit", "20", "Com_rollback", "5", "Uptime", "110", "Innodb_buffer_pool_read_requests", "2000", "Innodb_buffer_pool_reads", "20"))
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status = getData(proto, "status")
+	seconds := GlobalLastTime.Sub(lastTime).Seconds()
+
+	qps, ok := status.Field["qps"].(float64)
+
+	if !ok || qps != 500 / seconds {
+		t.Errorf("qps: got %v, want %v", status.Field["qps"], 500 / seconds)
+	}
+
+	if status.Field["tps"] != 15 / seconds {
+		t.Errorf("tps: got %v, want %v", status.Field["tps"], 15 / seconds)
+	}
+
+	if status.Field["innodb_buffer_pool_hit_ratio"] != float64(99) {
+		t.Errorf("innodb_buffer_pool_hit_ratio: got %v", status.Field["innodb_buffer_pool_hit_ratio"])
+	}
+
+	//All groups failed
+	initFake(t, map[string]string{
+		"groups": "table_sizes",
+	})
+
+	_, err = Collect()
+
+	if err == nil {
+		t.Errorf("should fail when all groups failed")
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want float64
+		ok bool
+	}{
+		{"ON", 1, true},
+		{"off", 0, true},
+		{"Yes", 1, true},
+		{"NO", 0, true},
+		{"151", 151, true},
+		{"2.5", 2.5, true},
+		{"utf8mb4", 0, false},
+		{"", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseValue(test.value)
+
+		if got != test.want || ok != test.ok {
+			t.Errorf("%q: got %v, %v, want %v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -6,34 +6,46 @@ import(
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+	"github.com/DarkMetrix/monitor/agent/src/filter"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
+var GlobalFS *procfs.FS
+var GlobalFilter *filter.Filter
 
 func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	var err error
+
+	//Same interfaces as the interfaces input with the same patterns
+	GlobalFilter, err = filter.NewAnchoredFilter(config["include"], config["exclude"])
+
+	if err != nil {
+		return err
+	}
+
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
+
+	_, err = GlobalFS.NetDev()
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	if err != nil {
+		return errors.New("Read net dev failed! error:" + err.Error())
 	}
 
 	return nil
 }
 
 func Collect()(*protocol.Proto, error) {
-	netStats := GlobalStat.NetIOStats()
+	netDevs, err := GlobalFS.NetDev()
 
-	if netStats == nil {
-		return nil, errors.New("NetIOStats failed! error:got nil")
+	if err != nil {
+		return nil, errors.New("Read net dev failed! error:" + err.Error())
 	}
 
 	proto := protocol.NewProto(1)
@@ -41,19 +53,23 @@ func Collect()(*protocol.Proto, error) {
 	curTime := time.Now()
 	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
 
-	for _, info := range netStats{
+	for _, info := range netDevs {
+		if !GlobalFilter.Match(info.Name) {
+			continue
+		}
+
 		data := protocol.NewData()
 		data.Time = currentTime
 
 		data.Tag["node_name"] = GlobalNodeInfo.Name
 		data.Tag["node_ip"] = GlobalNodeInfo.IP
-		data.Tag["instance"] = info.IntName
-		data.Field["tx"] = info.TX
-		data.Field["rx"] = info.RX
-		data.Field["ipackets"] = info.IPackets
-		data.Field["opackets"] = info.OPackets
-		data.Field["ierrors"] = info.IErrors
-		data.Field["oerrors"] = info.OErrors
+		data.Tag["instance"] = info.Name
+		data.Field["tx"] = info.TxBytes
+		data.Field["rx"] = info.RxBytes
+		data.Field["ipackets"] = info.RxPackets
+		data.Field["opackets"] = info.TxPackets
+		data.Field["ierrors"] = info.RxErrors
+		data.Field["oerrors"] = info.TxErrors
 		data.Field["collisions"] = info.Collisions
 
 		proto.DataList = append(proto.DataList, *data)
@@ -0,0 +1,510 @@
+package main
+
+import(
+	"os"
+	"net"
+	"sync"
+	"time"
+	"errors"
+	"regexp"
+	"strings"
+	"strconv"
+	"syscall"
+	"encoding/binary"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Max bytes of the response matched against expect regex
+const MaxResponseBytes = 64 * 1024
+
+var ErrExpectMismatch = errors.New("Response does not match expect!")
+
+//Target to check
+type Target struct {
+	Name string
+	Type string                 //"tcp", "udp" or "icmp"
+	Address string              //"host:port" of tcp and udp, "host" of icmp
+	Send string                 //Data to send after connected
+	Expect *regexp.Regexp       //Expected response regex, nil if not configured
+	Timeout time.Duration
+	Count int                   //Echo requests of icmp
+	Interval time.Duration      //Interval between echo requests of icmp
+
+	id int                      //Identifier of icmp echo requests
+}
+
+var GlobalTargets []*Target
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalTargets = []*Target{}
+
+	for index, name := range strings.Split(config["targets"], ";") {
+		if len(name) == 0 {
+			continue
+		}
+
+		target, err := newTarget(name)
+
+		if err != nil {
+			return err
+		}
+
+		target.id = (os.Getpid() + index) & 0xffff
+
+		GlobalTargets = append(GlobalTargets, target)
+	}
+
+	if len(GlobalTargets) == 0 {
+		return errors.New("No target is configured!")
+	}
+
+	return nil
+}
+
+//Get option of the target, '<target>:<option>' is used if configured, otherwise '<option>' as the default of all targets
+func getOption(name string, option string, defaultValue string) string {
+	value, ok := GlobalConfig[name + ":" + option]
+
+	if ok {
+		return value
+	}
+
+	value, ok = GlobalConfig[option]
+
+	if ok {
+		return value
+	}
+
+	return defaultValue
+}
+
+//Create target from config
+func newTarget(name string) (*Target, error) {
+	target := &Target{
+		Name: name,
+		Type: getOption(name, "type", "tcp"),
+		Address: getOption(name, "address", ""),
+	}
+
+	if len(target.Address) == 0 {
+		return nil, errors.New("Address of target '" + name + "' is not configured!")
+	}
+
+	//Escapes such as "\r\n" are supported
+	send, err := strconv.Unquote("\"" + strings.Replace(getOption(name, "send", ""), "\"", "\\\"", -1) + "\"")
+
+	if err != nil {
+		return nil, errors.New("Parse send of target '" + name + "' failed! error:" + err.Error())
+	}
+
+	target.Send = send
+
+	expect := getOption(name, "expect", "")
+
+	if len(expect) != 0 {
+		target.Expect, err = regexp.Compile(expect)
+
+		if err != nil {
+			return nil, errors.New("Compile expect of target '" + name + "' failed! error:" + err.Error())
+		}
+	}
+
+	timeout, err := strconv.ParseFloat(getOption(name, "timeout", "5"), 64)
+
+	if err != nil {
+		return nil, errors.New("Parse timeout of target '" + name + "' failed! error:" + err.Error())
+	}
+
+	target.Timeout = time.Duration(timeout * float64(time.Second))
+
+	target.Count, err = strconv.Atoi(getOption(name, "count", "3"))
+
+	if err != nil || target.Count <= 0 {
+		return nil, errors.New("Count of target '" + name + "' invalid! should be a positive number")
+	}
+
+	interval, err := strconv.ParseFloat(getOption(name, "interval", "0.2"), 64)
+
+	if err != nil {
+		return nil, errors.New("Parse interval of target '" + name + "' failed! error:" + err.Error())
+	}
+
+	target.Interval = time.Duration(interval * float64(time.Second))
+
+	switch target.Type {
+	case "tcp", "udp":
+		_, _, err = net.SplitHostPort(target.Address)
+
+		if err != nil {
+			return nil, errors.New("Address of target '" + name + "' invalid! should be 'host:port'")
+		}
+	case "icmp":
+	default:
+		return nil, errors.New("Type of target '" + name + "' invalid! should be tcp, udp or icmp")
+	}
+
+	if target.Type == "udp" && len(target.Send) == 0 {
+		return nil, errors.New("Send of udp target '" + name + "' is not configured!")
+	}
+
+	return target, nil
+}
+
+//Get the result of the network error
+func getErrorResult(err error) string {
+	netErr, ok := err.(net.Error)
+
+	if ok && netErr.Timeout() {
+		return "timeout"
+	}
+
+	var dnsErr *net.DNSError
+
+	if errors.As(err, &dnsErr) {
+		return "dns_failed"
+	}
+
+	return "connection_failed"
+}
+
+//Milliseconds since start
+func milliseconds(start time.Time) float64 {
+	return float64(time.Since(start)) / float64(time.Millisecond)
+}
+
+//Read response until the expected regex is matched
+func readExpect(conn net.Conn, expect *regexp.Regexp, isPacket bool) error {
+	response := []byte{}
+	buffer := make([]byte, MaxResponseBytes)
+
+	for {
+		n, err := conn.Read(buffer)
+
+		response = append(response, buffer[:n]...)
+
+		//Any reply is expected if no expect regex
+		if expect == nil && n > 0 {
+			return nil
+		}
+
+		if expect != nil && expect.Match(response) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if isPacket || len(response) >= MaxResponseBytes {
+			return ErrExpectMismatch
+		}
+	}
+}
+
+//Check tcp or udp target, latency of tcp is connect time, latency of udp is the time until the reply
+func checkConn(target *Target, data *protocol.Data) {
+	start := time.Now()
+
+	conn, err := net.DialTimeout(target.Type, target.Address, target.Timeout)
+
+	if err != nil {
+		data.Tag["result"] = getErrorResult(err)
+		return
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(start.Add(target.Timeout))
+
+	if target.Type == "tcp" {
+		data.Field["latency"] = milliseconds(start)
+	}
+
+	if len(target.Send) != 0 {
+		_, err = conn.Write([]byte(target.Send))
+
+		if err != nil {
+			data.Tag["result"] = getErrorResult(err)
+			return
+		}
+	}
+
+	if target.Type == "udp" || target.Expect != nil {
+		err = readExpect(conn, target.Expect, target.Type == "udp")
+
+		if err != nil {
+			if err == ErrExpectMismatch {
+				data.Tag["result"] = "expect_mismatch"
+			} else {
+				data.Tag["result"] = getErrorResult(err)
+			}
+
+			return
+		}
+
+		data.Field["response_time"] = milliseconds(start)
+
+		if target.Type == "udp" {
+			data.Field["latency"] = milliseconds(start)
+		}
+	}
+
+	data.Tag["result"] = "success"
+	data.Field["up"] = float64(1)
+}
+
+//Open icmp socket, raw socket needs root or CAP_NET_RAW, datagram socket needs the group in net.ipv4.ping_group_range
+func listenIcmp() (net.PacketConn, bool, error) {
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+
+	if err == nil {
+		return conn, true, nil
+	}
+
+	conn, err = listenIcmpDatagram()
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return conn, false, nil
+}
+
+//Open unprivileged icmp datagram socket, the kernel sets the identifier of echo requests
+func listenIcmpDatagram() (net.PacketConn, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_ICMP)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrInet4{})
+
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	file := os.NewFile(uintptr(fd), "icmp")
+
+	defer file.Close()
+
+	return net.FilePacketConn(file)
+}
+
+//Calculate internet checksum
+func checksum(packet []byte) uint16 {
+	var sum uint32
+
+	for index := 0; index + 1 < len(packet); index += 2 {
+		sum += uint32(binary.BigEndian.Uint16(packet[index:]))
+	}
+
+	if len(packet) % 2 == 1 {
+		sum += uint32(packet[len(packet) - 1]) << 8
+	}
+
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return ^uint16(sum)
+}
+
+//Check icmp target by echo requests, reports packet loss and round trip times
+func checkIcmp(target *Target, data *protocol.Data) {
+	addr, err := net.ResolveIPAddr("ip4", target.Address)
+
+	if err != nil {
+		data.Tag["result"] = "dns_failed"
+		return
+	}
+
+	conn, privileged, err := listenIcmp()
+
+	if err != nil {
+		data.Tag["result"] = "permission_denied"
+		return
+	}
+
+	defer conn.Close()
+
+	var dst net.Addr = addr
+
+	if !privileged {
+		dst = &net.UDPAddr{IP: addr.IP}
+	}
+
+	sendTimes := make(map[int]time.Time)
+	rtts := []float64{}
+
+	var mutex sync.Mutex
+
+	deadline := time.Now().Add(target.Timeout)
+
+	conn.SetReadDeadline(deadline)
+
+	//Replies are received while sending
+	done := make(chan bool)
+
+	go func() {
+		defer close(done)
+
+		buffer := make([]byte, 1500)
+
+		for len(rtts) < target.Count {
+			n, _, err := conn.ReadFrom(buffer)
+
+			if err != nil {
+				return
+			}
+
+			received := time.Now()
+
+			//Echo reply is type 0, identifier is checked on raw socket since all icmp packets are received
+			if n < 8 || buffer[0] != 0 {
+				continue
+			}
+
+			if privileged && int(binary.BigEndian.Uint16(buffer[4:])) != target.id {
+				continue
+			}
+
+			seq := int(binary.BigEndian.Uint16(buffer[6:]))
+
+			mutex.Lock()
+
+			sendTime, ok := sendTimes[seq]
+
+			if ok {
+				delete(sendTimes, seq)
+				rtts = append(rtts, float64(received.Sub(sendTime)) / float64(time.Millisecond))
+			}
+
+			mutex.Unlock()
+		}
+	}()
+
+	sent := 0
+
+	for seq := 0; seq < target.Count && time.Now().Before(deadline); seq++ {
+		if seq != 0 {
+			time.Sleep(target.Interval)
+		}
+
+		packet := make([]byte, 16)
+		packet[0] = 8
+
+		binary.BigEndian.PutUint16(packet[4:], uint16(target.id))
+		binary.BigEndian.PutUint16(packet[6:], uint16(seq))
+		binary.BigEndian.PutUint64(packet[8:], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint16(packet[2:], checksum(packet))
+
+		mutex.Lock()
+		sendTimes[seq] = time.Now()
+		mutex.Unlock()
+
+		_, err = conn.WriteTo(packet, dst)
+
+		if err != nil {
+			break
+		}
+
+		sent++
+	}
+
+	<-done
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	data.Field["packets_sent"] = float64(sent)
+	data.Field["packets_received"] = float64(len(rtts))
+
+	if sent != 0 {
+		data.Field["packet_loss"] = float64(sent - len(rtts)) / float64(sent) * 100
+	}
+
+	if len(rtts) == 0 {
+		data.Tag["result"] = "timeout"
+		return
+	}
+
+	min, max, sum := rtts[0], rtts[0], 0.0
+
+	for _, rtt := range rtts {
+		if rtt < min {
+			min = rtt
+		}
+
+		if rtt > max {
+			max = rtt
+		}
+
+		sum += rtt
+	}
+
+	data.Field["latency"] = sum / float64(len(rtts))
+	data.Field["rtt_min"] = min
+	data.Field["rtt_max"] = max
+
+	data.Tag["result"] = "success"
+	data.Field["up"] = float64(1)
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	datas := make([]*protocol.Data, len(GlobalTargets))
+
+	var wait sync.WaitGroup
+
+	//Targets are checked concurrently, a slow target does not delay the others
+	for index, target := range GlobalTargets {
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["target"] = target.Name
+		data.Tag["type"] = target.Type
+		data.Tag["address"] = target.Address
+
+		//All values are floats like the latencies, so the types are not mixed in one measurement
+		data.Field["up"] = float64(0)
+
+		datas[index] = data
+
+		wait.Add(1)
+
+		go func(target *Target, data *protocol.Data) {
+			defer wait.Done()
+
+			if target.Type == "icmp" {
+				checkIcmp(target, data)
+			} else {
+				checkConn(target, data)
+			}
+		}(target, data)
+	}
+
+	wait.Wait()
+
+	for _, data := range datas {
+		proto.DataList = append(proto.DataList, *data)
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,287 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test net_check.go net_check_test.go
+
+import(
+	"net"
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Tcp server replies "+PONG" to each line
+func startTcpServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				scanner := bufio.NewScanner(conn)
+
+				for scanner.Scan() {
+					conn.Write([]byte("+PONG\r\n"))
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+//Udp server echoes each packet in upper case
+func startUdpServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	go func() {
+		buffer := make([]byte, 1024)
+
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+
+			if err != nil {
+				return
+			}
+
+			conn.WriteTo([]byte(strings.ToUpper(string(buffer[:n]))), addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+//Get a local address nothing listens on
+func getClosedAddress(t *testing.T, network string) string {
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		return conn.LocalAddr().String()
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+func getTarget(proto *protocol.Proto, name string) *protocol.Data {
+	for index := range proto.DataList {
+		if proto.DataList[index].Tag["target"] == name {
+			return &proto.DataList[index]
+		}
+	}
+
+	return nil
+}
+
+func TestCollect(t *testing.T) {
+	tcpAddress := startTcpServer(t)
+	udpAddress := startUdpServer(t)
+
+	options := map[string]string{
+		"targets": "tcp_connect;tcp_expect;tcp_mismatch;tcp_closed;udp_echo;udp_mismatch;udp_closed;icmp_local",
+		"timeout": "1",
+
+		"tcp_connect:address": tcpAddress,
+
+		"tcp_expect:address": tcpAddress,
+		"tcp_expect:send": "PING\\r\\n",
+		"tcp_expect:expect": "^\\+PONG",
+
+		"tcp_mismatch:address": tcpAddress,
+		"tcp_mismatch:send": "PING\\r\\n",
+		"tcp_mismatch:expect": "^-ERR",
+		"tcp_mismatch:timeout": "0.2",
+
+		"tcp_closed:address": getClosedAddress(t, "tcp"),
+
+		"udp_echo:type": "udp",
+		"udp_echo:address": udpAddress,
+		"udp_echo:send": "ping",
+		"udp_echo:expect": "^PING$",
+
+		"udp_mismatch:type": "udp",
+		"udp_mismatch:address": udpAddress,
+		"udp_mismatch:send": "ping",
+		"udp_mismatch:expect": "^pong$",
+
+		//The kernel replies port unreachable to the loopback address
+		"udp_closed:type": "udp",
+		"udp_closed:address": getClosedAddress(t, "udp"),
+		"udp_closed:send": "ping",
+
+		"icmp_local:type": "icmp",
+		"icmp_local:address": "127.0.0.1",
+		"icmp_local:count": "3",
+		"icmp_local:interval": "0.01",
+	}
+
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		result string
+		up float64
+		fields []string             //Fields should be reported
+	}{
+		{"tcp_connect", "success", 1, []string{"latency"}},
+		{"tcp_expect", "success", 1, []string{"latency", "response_time"}},
+		{"tcp_mismatch", "timeout", 0, []string{"latency"}},
+		{"tcp_closed", "connection_failed", 0, nil},
+		{"udp_echo", "success", 1, []string{"latency", "response_time"}},
+		{"udp_mismatch", "expect_mismatch", 0, nil},
+		{"udp_closed", "connection_failed", 0, nil},
+	}
+
+	for _, test := range tests {
+		data := getTarget(proto, test.target)
+
+		if data == nil {
+			t.Errorf("%s: not reported", test.target)
+			continue
+		}
+
+		if data.Tag["result"] != test.result || data.Field["up"] != test.up {
+			t.Errorf("%s: got result %v up %v, want %s %v", test.target, data.Tag["result"], data.Field["up"], test.result, test.up)
+		}
+
+		if data.Tag["address"] != options[test.target + ":address"] {
+			t.Errorf("%s: got address %v", test.target, data.Tag["address"])
+		}
+
+		for _, field := range test.fields {
+			value, ok := data.Field[field].(float64)
+
+			if !ok || value < 0 {
+				t.Errorf("%s: field %s got %v", test.target, field, data.Field[field])
+			}
+		}
+
+		//All values are floats in one measurement
+		for key, value := range data.Field {
+			_, ok := value.(float64)
+
+			if !ok {
+				t.Errorf("%s: field %s got %T, want float64", test.target, key, value)
+			}
+		}
+	}
+
+	data := getTarget(proto, "icmp_local")
+
+	if data == nil {
+		t.Fatalf("icmp_local: not reported")
+	}
+
+	//Icmp needs CAP_NET_RAW or the group in net.ipv4.ping_group_range
+	if data.Tag["result"] == "permission_denied" {
+		t.Skip("icmp socket is not permitted")
+	}
+
+	if data.Tag["result"] != "success" || data.Field["up"] != float64(1) {
+		t.Fatalf("icmp_local: got %+v", data)
+	}
+
+	fields := map[string]interface{}{
+		"packets_sent": float64(3),
+		"packets_received": float64(3),
+		"packet_loss": float64(0),
+	}
+
+	for key, value := range fields {
+		if data.Field[key] != value {
+			t.Errorf("icmp_local: field %s got %v(%T), want %v(%T)", key, data.Field[key], data.Field[key], value, value)
+		}
+	}
+
+	min, _ := data.Field["rtt_min"].(float64)
+	max, _ := data.Field["rtt_max"].(float64)
+	latency, _ := data.Field["latency"].(float64)
+
+	if min <= 0 || min > latency || latency > max {
+		t.Errorf("icmp_local: got rtt_min %v latency %v rtt_max %v", min, latency, max)
+	}
+}
+
+func TestNewTarget(t *testing.T) {
+	tests := []struct {
+		options map[string]string
+		fail bool
+	}{
+		{map[string]string{"t:address": "127.0.0.1:22"}, false},
+		{map[string]string{"t:address": "127.0.0.1"}, true},
+		{map[string]string{"t:type": "udp", "t:address": "127.0.0.1:53"}, true},
+		{map[string]string{"t:type": "icmp", "t:address": "127.0.0.1"}, false},
+		{map[string]string{"t:type": "icmp", "t:address": "127.0.0.1", "t:count": "0"}, true},
+		{map[string]string{"t:type": "http", "t:address": "127.0.0.1:80"}, true},
+		{map[string]string{"t:address": "127.0.0.1:22", "t:expect": "("}, true},
+		{map[string]string{}, true},
+	}
+
+	for _, test := range tests {
+		GlobalConfig = test.options
+
+		_, err := newTarget("t")
+
+		if (err != nil) != test.fail {
+			t.Errorf("%v: got error %v, want fail %v", test.options, err, test.fail)
+		}
+	}
+
+	//Escapes in send
+	GlobalConfig = map[string]string{"t:address": "127.0.0.1:6379", "t:send": "PING\\r\\n\"x\""}
+
+	target, err := newTarget("t")
+
+	if err != nil || target.Send != "PING\r\n\"x\"" {
+		t.Errorf("send: got %q, %v", target.Send, err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test net.go net_test.go
+
+import(
+	"os"
+	"strings"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+)
+
+//Same patterns select the same interfaces as the interfaces input, see interfaces_test.go
+var GlobalInterfaceNames = []string{"bond0", "eth0", "eth1", "lo", "veth0abc"}
+
+var GlobalInterfaceTests = []struct {
+	include string
+	exclude string
+	want string
+}{
+	{"", "", "bond0;eth0;eth1;lo;veth0abc"},
+	{"eth0", "", "eth0"},
+	{"eth[0-9]+;bond.*", "eth1", "bond0;eth0"},
+	{"", "veth.*;lo", "bond0;eth0;eth1"},
+}
+
+//Write /proc/1/net/dev of the interfaces under a root path
+func writeNetDev(t *testing.T) string {
+	root := t.TempDir()
+	dir := filepath.Join(root, "proc", "1", "net")
+
+	err := os.MkdirAll(dir, 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{
+		"Inter-|   Receive                                                |  Transmit",
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed",
+	}
+
+	for _, name := range GlobalInterfaceNames {
+		lines = append(lines, name + ": 1000 10 0 0 0 0 0 0 2000 20 0 0 0 0 0 0")
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "dev"), []byte(strings.Join(lines, "\n") + "\n"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func TestNetFilter(t *testing.T) {
+	root := writeNetDev(t)
+
+	for _, test := range GlobalInterfaceTests {
+		err := Init(config.NodeInfo{}, map[string]string{"root_path": root, "include": test.include, "exclude": test.exclude})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proto, err := Collect()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names := []string{}
+
+		for _, data := range proto.DataList {
+			names = append(names, data.Tag["instance"].(string))
+		}
+
+		got := strings.Join(names, ";")
+
+		if got != test.want {
+			t.Errorf("include %q exclude %q: got %s, want %s", test.include, test.exclude, got, test.want)
+		}
+	}
+}
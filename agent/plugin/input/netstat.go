@@ -0,0 +1,221 @@
+package main
+
+import(
+	"time"
+	"errors"
+	"strings"
+	"strconv"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+var GlobalFS *procfs.FS
+
+//Counters in TcpExt of /proc/1/net/netstat to report
+var GlobalTcpExt []string
+
+//Udp ports to report drops of the sockets bound on
+var GlobalUdpPorts map[uint64]bool
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalFS = procfs.NewFS(config["root_path"])
+	GlobalTcpExt = []string{"ListenOverflows", "ListenDrops", "TCPTimeouts", "TCPSynRetrans", "TCPLostRetransmit", "TCPBacklogDrop", "TCPAbortOnMemory", "TCPAbortOnTimeout"}
+	GlobalUdpPorts = make(map[uint64]bool)
+
+	tcpExt, ok := config["tcp_ext"]
+
+	if ok {
+		GlobalTcpExt = []string{}
+
+		for _, name := range strings.Split(tcpExt, ";") {
+			if len(name) == 0 {
+				continue
+			}
+
+			GlobalTcpExt = append(GlobalTcpExt, name)
+		}
+	}
+
+	udpPorts, ok := config["udp_ports"]
+
+	if ok {
+		for _, udpPort := range strings.Split(udpPorts, ";") {
+			if len(udpPort) == 0 {
+				continue
+			}
+
+			port, err := strconv.ParseUint(udpPort, 10, 16)
+
+			if err != nil {
+				return errors.New("Config 'udp_ports' error, should be ports separated by ';', e.g.:5656;53")
+			}
+
+			GlobalUdpPorts[port] = true
+		}
+	}
+
+	_, err := GlobalFS.NetProtocolCounters("snmp")
+
+	if err != nil {
+		return errors.New("Read snmp failed! error:" + err.Error())
+	}
+
+	return nil
+}
+
+//Convert counter name to field name, e.g.:"RetransSegs" to "retrans_segs", "TCPSynRetrans" to "tcp_syn_retrans"
+func toFieldName(name string) string {
+	field := make([]byte, 0, len(name) + 4)
+
+	for index := 0; index < len(name); index++ {
+		char := name[index]
+
+		if char >= 'A' && char <= 'Z' {
+			if index > 0 {
+				previous := name[index - 1]
+				nextIsLower := index + 1 < len(name) && name[index + 1] >= 'a' && name[index + 1] <= 'z'
+
+				if (previous >= 'a' && previous <= 'z') || (previous >= '0' && previous <= '9') || (previous >= 'A' && previous <= 'Z' && nextIsLower) {
+					field = append(field, '_')
+				}
+			}
+
+			char += 'a' - 'A'
+		}
+
+		field = append(field, char)
+	}
+
+	return string(field)
+}
+
+//New data with node tags and protocol tag
+func newData(currentTime string, protocolName string) *protocol.Data {
+	data := protocol.NewData()
+	data.Time = currentTime
+
+	data.Tag["node_name"] = GlobalNodeInfo.Name
+	data.Tag["node_ip"] = GlobalNodeInfo.IP
+	data.Tag["protocol"] = protocolName
+
+	return data
+}
+
+func Collect()(*protocol.Proto, error) {
+	snmp, err := GlobalFS.NetProtocolCounters("snmp")
+
+	if err != nil {
+		return nil, errors.New("Read snmp failed! error:" + err.Error())
+	}
+
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	//Tcp connections count by state and tcp counters
+	tcpData := newData(currentTime, "tcp")
+
+	states := make(map[string]int)
+
+	for _, state := range procfs.TCPStates {
+		states[state] = 0
+	}
+
+	for _, name := range []string{"tcp", "tcp6"} {
+		//tcp6 does not exist if ipv6 is disabled
+		sockets, err := GlobalFS.NetSockets(name)
+
+		if err != nil {
+			continue
+		}
+
+		for _, socket := range sockets {
+			state, ok := procfs.TCPStates[socket.State]
+
+			if !ok {
+				continue
+			}
+
+			states[state] += 1
+		}
+	}
+
+	for state, count := range states {
+		tcpData.Field[strings.ToLower(state)] = count
+	}
+
+	for name, value := range snmp["Tcp"] {
+		tcpData.Field[toFieldName(name)] = value
+	}
+
+	//Netstat may not exist in some containers
+	netstat, err := GlobalFS.NetProtocolCounters("netstat")
+
+	if err == nil {
+		for _, name := range GlobalTcpExt {
+			value, ok := netstat["TcpExt"][name]
+
+			if !ok {
+				continue
+			}
+
+			tcpData.Field[toFieldName(name)] = value
+		}
+	}
+
+	proto.DataList = append(proto.DataList, *tcpData)
+
+	//Udp counters, RcvbufErrors means packets dropped because of receive buffer full
+	udpData := newData(currentTime, "udp")
+
+	for name, value := range snmp["Udp"] {
+		udpData.Field[toFieldName(name)] = value
+	}
+
+	proto.DataList = append(proto.DataList, *udpData)
+
+	//Drops of the sockets bound on the udp ports
+	if len(GlobalUdpPorts) != 0 {
+		drops := make(map[uint64]uint64)
+		rxQueues := make(map[uint64]uint64)
+
+		for _, name := range []string{"udp", "udp6"} {
+			sockets, err := GlobalFS.NetSockets(name)
+
+			if err != nil {
+				continue
+			}
+
+			for _, socket := range sockets {
+				if !GlobalUdpPorts[socket.LocalPort] {
+					continue
+				}
+
+				drops[socket.LocalPort] += socket.Drops
+				rxQueues[socket.LocalPort] += socket.RxQueue
+			}
+		}
+
+		for port := range GlobalUdpPorts {
+			data := newData(currentTime, "udp")
+
+			data.Tag["port"] = strconv.FormatUint(port, 10)
+			data.Field["drops"] = drops[port]
+			data.Field["rx_queue"] = rxQueues[port]
+
+			proto.DataList = append(proto.DataList, *data)
+		}
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,443 @@
+package main
+
+import(
+	"math"
+	"sort"
+	"time"
+	"errors"
+	"regexp"
+	"strings"
+	"strconv"
+	"net/http"
+	"io/ioutil"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/tail"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Nginx combined log format
+const CombinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+var GlobalClient *http.Client
+var GlobalStatusUrl string
+
+//Stub status counters and time of last status collected, used to calculate rates
+var GlobalLastStatus map[string]uint64
+var GlobalLastStatusTime time.Time
+
+//Time of last access log read
+var GlobalLastLogTime time.Time
+
+var GlobalTailer *tail.Tailer
+var GlobalLogPattern *regexp.Regexp
+var GlobalPercentiles []float64
+
+//Bytes sent includes the response header, it is counted instead of body bytes sent if both are in the format
+var GlobalHasBytesSent bool
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	var err error
+
+	GlobalStatusUrl = config["status_url"]
+
+	timeout := 5
+
+	_, ok := config["timeout"]
+
+	if ok {
+		timeout, err = strconv.Atoi(config["timeout"])
+
+		if err != nil {
+			return errors.New("Parse timeout failed! error:" + err.Error())
+		}
+	}
+
+	GlobalClient = &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+	}
+
+	GlobalTailer = nil
+
+	_, ok = config["access_log"]
+
+	if ok {
+		format, ok := config["log_format"]
+
+		if !ok {
+			format = CombinedFormat
+		}
+
+		GlobalLogPattern, err = compileLogFormat(format)
+
+		if err != nil {
+			return err
+		}
+
+		GlobalHasBytesSent = strings.Contains(format, "$bytes_sent")
+
+		GlobalPercentiles = []float64{}
+
+		percentiles, ok := config["percentiles"]
+
+		if !ok {
+			percentiles = "50;90;99"
+		}
+
+		for _, value := range strings.Split(percentiles, ";") {
+			percentile, err := strconv.ParseFloat(value, 64)
+
+			if err != nil || percentile <= 0 || percentile > 100 {
+				return errors.New("Percentile '" + value + "' invalid! should be in (0, 100]")
+			}
+
+			GlobalPercentiles = append(GlobalPercentiles, percentile)
+		}
+
+		//Only lines written after the agent started are counted
+		GlobalTailer = tail.NewTailer(config["access_log"], true)
+		GlobalTailer.Open()
+	}
+
+	if len(GlobalStatusUrl) == 0 && GlobalTailer == nil {
+		return errors.New("Neither status_url nor access_log is configured!")
+	}
+
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalLastStatus = nil
+	GlobalLastStatusTime = time.Now()
+	GlobalLastLogTime = time.Now()
+
+	return nil
+}
+
+//Compile nginx log_format to regex, each variable is captured by name
+func compileLogFormat(format string) (*regexp.Regexp, error) {
+	variable := regexp.MustCompile(`\$[a-zA-Z0-9_]+`)
+
+	pattern := "^"
+	last := 0
+	names := make(map[string]bool)
+
+	for _, loc := range variable.FindAllStringIndex(format, -1) {
+		name := format[loc[0] + 1:loc[1]]
+
+		pattern += regexp.QuoteMeta(format[last:loc[0]])
+
+		//Variables may appear more than once, only the first one is captured
+		if names[name] {
+			pattern += `.*?`
+		} else {
+			pattern += `(?P<` + name + `>.*?)`
+			names[name] = true
+		}
+
+		last = loc[1]
+	}
+
+	pattern += regexp.QuoteMeta(format[last:]) + "$"
+
+	if !names["status"] {
+		return nil, errors.New("Log format should contain $status!")
+	}
+
+	compiled, err := regexp.Compile(pattern)
+
+	if err != nil {
+		return nil, errors.New("Compile log format failed! error:" + err.Error())
+	}
+
+	return compiled, nil
+}
+
+//Get stub_status, format is like:
+//Active connections: 291
+//server accepts handled requests
+// 16630948 16630948 31070465
+//Reading: 6 Writing: 179 Waiting: 106
+func getStubStatus() (map[string]uint64, error) {
+	response, err := GlobalClient.Get(GlobalStatusUrl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New("Status " + response.Status)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+
+	if len(lines) != 4 {
+		return nil, errors.New("Parse stub_status failed! lines count should be 4")
+	}
+
+	status := make(map[string]uint64)
+
+	fields := strings.Fields(lines[0])
+	counters := strings.Fields(lines[2])
+	connections := strings.Fields(lines[3])
+
+	if len(fields) != 3 || len(counters) != 3 || len(connections) != 6 {
+		return nil, errors.New("Parse stub_status failed! content:" + string(body))
+	}
+
+	names := []string{"active", "accepts", "handled", "requests", "reading", "writing", "waiting"}
+	values := []string{fields[2], counters[0], counters[1], counters[2], connections[1], connections[3], connections[5]}
+
+	for index, name := range names {
+		value, err := strconv.ParseUint(values[index], 10, 64)
+
+		if err != nil {
+			return nil, errors.New("Parse stub_status failed! error:" + err.Error())
+		}
+
+		status[name] = value
+	}
+
+	return status, nil
+}
+
+//Get the value at percentile of sorted values, nearest rank
+func getPercentile(sorted []float64, percentile float64) float64 {
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+
+	if rank < 1 {
+		rank = 1
+	}
+
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+
+	return sorted[rank - 1]
+}
+
+//Count access log lines since last collect
+func collectAccessLog(data *protocol.Data, seconds float64) error {
+	lines, err := GlobalTailer.Read()
+
+	if err != nil {
+		return err
+	}
+
+	names := GlobalLogPattern.SubexpNames()
+
+	counts := make(map[string]uint64)
+	requestTimes := []float64{}
+
+	var bytes uint64
+	var malformed uint64
+
+	for _, line := range lines {
+		matches := GlobalLogPattern.FindStringSubmatch(line)
+
+		if matches == nil {
+			malformed++
+			continue
+		}
+
+		for index, name := range names {
+			value := matches[index]
+
+			switch name {
+			case "status":
+				if len(value) == 3 && value[0] >= '1' && value[0] <= '5' {
+					counts["status_" + value[:1] + "xx"]++
+				}
+			case "body_bytes_sent", "bytes_sent":
+				size, err := strconv.ParseUint(value, 10, 64)
+
+				if err == nil && (name == "bytes_sent" || !GlobalHasBytesSent) {
+					bytes += size
+				}
+			case "request_time":
+				requestTime, err := strconv.ParseFloat(value, 64)
+
+				if err == nil {
+					requestTimes = append(requestTimes, requestTime)
+				}
+			}
+		}
+	}
+
+	requests := uint64(len(lines)) - malformed
+
+	data.Field["requests"] = requests
+	data.Field["bytes"] = bytes
+	data.Field["malformed_lines"] = malformed
+
+	if seconds > 0 {
+		data.Field["requests_per_second"] = float64(requests) / seconds
+	}
+
+	for _, class := range []string{"1", "2", "3", "4", "5"} {
+		data.Field["status_" + class + "xx"] = counts["status_" + class + "xx"]
+	}
+
+	if len(requestTimes) != 0 {
+		sort.Float64s(requestTimes)
+
+		var sum float64
+
+		for _, requestTime := range requestTimes {
+			sum += requestTime
+		}
+
+		data.Field["request_time_avg"] = sum / float64(len(requestTimes))
+		data.Field["request_time_max"] = requestTimes[len(requestTimes) - 1]
+
+		for _, percentile := range GlobalPercentiles {
+			name := "request_time_p" + strings.Replace(strconv.FormatFloat(percentile, 'f', -1, 64), ".", "_", -1)
+			data.Field[name] = getPercentile(requestTimes, percentile)
+		}
+	}
+
+	return nil
+}
+
+//Collect stub_status, rates are calculated since the last status collected
+func collectStatus(curTime time.Time, data *protocol.Data) error {
+	status, err := getStubStatus()
+
+	if err != nil {
+		return err
+	}
+
+	for name, value := range status {
+		data.Field[name] = value
+	}
+
+	seconds := curTime.Sub(GlobalLastStatusTime).Seconds()
+
+	//Counters are reset when nginx restarts
+	if GlobalLastStatus != nil && seconds > 0 {
+		for _, name := range []string{"accepts", "handled", "requests"} {
+			if status[name] >= GlobalLastStatus[name] {
+				data.Field[name + "_per_second"] = float64(status[name] - GlobalLastStatus[name]) / seconds
+			}
+		}
+
+		accepts := status["accepts"] - GlobalLastStatus["accepts"]
+		handled := status["handled"] - GlobalLastStatus["handled"]
+
+		if status["handled"] >= GlobalLastStatus["handled"] && accepts >= handled {
+			data.Field["dropped"] = accepts - handled
+		}
+	}
+
+	GlobalLastStatus = status
+	GlobalLastStatusTime = curTime
+
+	return nil
+}
+
+//Stub_status and access log are collected independently, the one succeeded is reported if the other failed
+//Move the matched fields to a copy of the data reported to the measurement 'nginx_<name>',
+//so the float rates and request times are not mixed with the integer counters in one measurement
+func moveFields(proto *protocol.Proto, data *protocol.Data, name string, match func(field string) bool) {
+	moved := protocol.NewData()
+	moved.Name = name
+	moved.Time = data.Time
+
+	for key, value := range data.Tag {
+		moved.Tag[key] = value
+	}
+
+	for key, value := range data.Field {
+		if match(key) {
+			moved.Field[key] = value
+			delete(data.Field, key)
+		}
+	}
+
+	if len(moved.Field) != 0 {
+		proto.DataList = append(proto.DataList, *moved)
+	}
+}
+
+//Is the field a rate, e.g.:"requests_per_second"
+func isRate(field string) bool {
+	return strings.HasSuffix(field, "_per_second")
+}
+
+//Is the field a request time, e.g.:"request_time_p99"
+func isRequestTime(field string) bool {
+	return strings.HasPrefix(field, "request_time_")
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	errs := []string{}
+
+	if len(GlobalStatusUrl) != 0 {
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["type"] = "status"
+
+		err := collectStatus(curTime, data)
+
+		if err != nil {
+			errs = append(errs, "Get stub_status failed! error:" + err.Error())
+		} else {
+			moveFields(proto, data, "rate", isRate)
+			proto.DataList = append(proto.DataList, *data)
+		}
+	}
+
+	if GlobalTailer != nil {
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["type"] = "access_log"
+		data.Tag["access_log"] = GlobalTailer.Path()
+
+		//Rate is calculated since the last successful read
+		err := collectAccessLog(data, curTime.Sub(GlobalLastLogTime).Seconds())
+
+		if err != nil {
+			errs = append(errs, "Read access log failed! error:" + err.Error())
+		} else {
+			GlobalLastLogTime = curTime
+
+			moveFields(proto, data, "rate", isRate)
+			moveFields(proto, data, "request_time", isRequestTime)
+			proto.DataList = append(proto.DataList, *data)
+		}
+	}
+
+	if len(proto.DataList) == 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+
+	for _, err := range errs {
+		log.Warnf("%s", err)
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test nginx.go nginx_test.go
+
+import(
+	"os"
+	"sync"
+	"testing"
+	"net/http"
+	"path/filepath"
+	"net/http/httptest"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Fake stub_status, counters are increased by each request
+type FakeStatus struct {
+	sync.Mutex
+
+	requests int
+	failed bool
+}
+
+func (status *FakeStatus) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	status.Lock()
+	defer status.Unlock()
+
+	if status.failed {
+		http.Error(writer, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	status.requests++
+
+	if status.requests == 1 {
+		writer.Write([]byte("Active connections: 291 \nserver accepts handled requests\n 100 100 200 \nReading: 6 Writing: 179 Waiting: 106 \n"))
+	} else {
+		writer.Write([]byte("Active connections: 10 \nserver accepts handled requests\n 150 140 300 \nReading: 1 Writing: 2 Waiting: 7 \n"))
+	}
+}
+
+//Sample lines in the format '... $status $body_bytes_sent ... $request_time'
+var GlobalSampleLines = []string{
+	`127.0.0.1 - - [10/Oct/2023:13:55:36 +0800] "GET / HTTP/1.1" 200 612 "-" "curl/7.68.0" 0.010`,
+	`127.0.0.1 - - [10/Oct/2023:13:55:37 +0800] "GET /missing HTTP/1.1" 404 153 "-" "curl/7.68.0" 0.002`,
+	`127.0.0.1 - - [10/Oct/2023:13:55:38 +0800] "POST /api HTTP/1.1" 502 157 "-" "curl/7.68.0" 1.500`,
+	`127.0.0.1 - - [10/Oct/2023:13:55:39 +0800] "GET / HTTP/1.1" 200 612 "-" "curl/7.68.0" 0.020`,
+	`not an access log line`,
+}
+
+func appendLines(t *testing.T, path string, lines []string) {
+	file, err := os.OpenFile(path, os.O_APPEND | os.O_CREATE | os.O_WRONLY, 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	for _, line := range lines {
+		file.WriteString(line + "\n")
+	}
+}
+
+//Get the data of the type, the measurement is 'nginx' if name is empty or 'nginx_<name>'
+func getTypeData(proto *protocol.Proto, dataType string, name string) *protocol.Data {
+	for index := range proto.DataList {
+		if proto.DataList[index].Tag["type"] == dataType && proto.DataList[index].Name == name {
+			return &proto.DataList[index]
+		}
+	}
+
+	return nil
+}
+
+func getType(proto *protocol.Proto, dataType string) *protocol.Data {
+	return getTypeData(proto, dataType, "")
+}
+
+func checkFields(t *testing.T, name string, data *protocol.Data, fields map[string]interface{}) {
+	if data == nil {
+		t.Errorf("%s: not reported", name)
+		return
+	}
+
+	for key, value := range fields {
+		if data.Field[key] != value {
+			t.Errorf("%s: field %s got %v(%T), want %v(%T)", name, key, data.Field[key], data.Field[key], value, value)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	status := &FakeStatus{}
+	server := httptest.NewServer(status)
+
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	//Lines written before the agent started are not counted
+	appendLines(t, path, GlobalSampleLines[:1])
+
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"status_url": server.URL,
+		"access_log": path,
+		"log_format": CombinedFormat + " $request_time",
+		"percentiles": "50;99.9",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appendLines(t, path, GlobalSampleLines)
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFields(t, "status", getType(proto, "status"), map[string]interface{}{
+		"active": uint64(291),
+		"accepts": uint64(100),
+		"handled": uint64(100),
+		"requests": uint64(200),
+		"reading": uint64(6),
+		"writing": uint64(179),
+		"waiting": uint64(106),
+	})
+
+	checkFields(t, "access_log", getType(proto, "access_log"), map[string]interface{}{
+		"requests": uint64(4),
+		"malformed_lines": uint64(1),
+		"bytes": uint64(612 + 153 + 157 + 612),
+		"status_2xx": uint64(2),
+		"status_4xx": uint64(1),
+		"status_5xx": uint64(1),
+	})
+
+	//Float request times and rates are not mixed with the integer counters
+	checkFields(t, "access_log request_time", getTypeData(proto, "access_log", "request_time"), map[string]interface{}{
+		"request_time_max": 1.5,
+		"request_time_p50": 0.01,
+		"request_time_p99_9": 1.5,
+	})
+
+	for _, data := range proto.DataList {
+		for key, value := range data.Field {
+			_, isFloat := value.(float64)
+
+			if isFloat != (data.Name == "rate" || data.Name == "request_time") {
+				t.Errorf("field %s of %s: %T reported to nginx_%s", key, data.Tag["type"], value, data.Name)
+			}
+		}
+	}
+
+	//Access log is still reported when stub_status fails
+	status.Lock()
+	status.failed = true
+	status.Unlock()
+
+	appendLines(t, path, GlobalSampleLines[:2])
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getType(proto, "status") != nil {
+		t.Errorf("status should not be reported when stub_status fails")
+	}
+
+	checkFields(t, "access_log", getType(proto, "access_log"), map[string]interface{}{
+		"requests": uint64(2),
+		"status_4xx": uint64(1),
+	})
+
+	//Rates are calculated since the last status collected
+	status.Lock()
+	status.failed = false
+	status.Unlock()
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFields(t, "status", getType(proto, "status"), map[string]interface{}{
+		"active": uint64(10),
+		"dropped": uint64(10),
+	})
+
+	_, ok := getTypeData(proto, "status", "rate").Field["requests_per_second"].(float64)
+
+	if !ok {
+		t.Errorf("requests_per_second not reported")
+	}
+
+	//Status is still reported when the access log could not be opened
+	err = Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, map[string]string{
+		"status_url": server.URL,
+		"access_log": filepath.Join(path, "missing.log"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if getType(proto, "status") == nil || getType(proto, "access_log") != nil {
+		t.Errorf("only status should be reported when the access log fails: %+v", proto.DataList)
+	}
+
+	//Both failed
+	status.Lock()
+	status.failed = true
+	status.Unlock()
+
+	_, err = Collect()
+
+	if err == nil {
+		t.Errorf("should fail when both stub_status and access log fail")
+	}
+}
+
+func TestCompileLogFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		line string
+		want map[string]string
+	}{
+		{CombinedFormat, GlobalSampleLines[0][:len(GlobalSampleLines[0]) - 6], map[string]string{"status": "200", "body_bytes_sent": "612", "request": "GET / HTTP/1.1"}},
+		{`$remote_addr [$time_local] $status $bytes_sent $request_time`, `10.0.0.1 [10/Oct/2023:13:55:36 +0800] 301 0 0.000`, map[string]string{"remote_addr": "10.0.0.1", "status": "301", "bytes_sent": "0", "request_time": "0.000"}},
+	}
+
+	for _, test := range tests {
+		pattern, err := compileLogFormat(test.format)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.format, err)
+			continue
+		}
+
+		matches := pattern.FindStringSubmatch(test.line)
+
+		if matches == nil {
+			t.Errorf("%s: %q not matched", test.format, test.line)
+			continue
+		}
+
+		for index, name := range pattern.SubexpNames() {
+			want, ok := test.want[name]
+
+			if ok && matches[index] != want {
+				t.Errorf("%s: %s got %q, want %q", test.format, name, matches[index], want)
+			}
+		}
+	}
+
+	_, err := compileLogFormat(`$remote_addr $body_bytes_sent`)
+
+	if err == nil {
+		t.Errorf("format without $status should fail")
+	}
+}
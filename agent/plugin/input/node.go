@@ -1,42 +1,167 @@
 package main
 
 import(
+	"os"
 	"time"
 	"errors"
+	"strings"
+	"strconv"
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
-var GlobalHostInfo *statgo.HostInfos
+var GlobalFS *procfs.FS
+var GlobalHostInfo *procfs.HostInfo
+
+//Static node information read once in Init
+var GlobalInventory map[string]string
+
+//Hypervisors detected by dmi vendor or product name
+var GlobalHypervisors = []struct {
+	Keyword string
+	Name string
+}{
+	{"KVM", "kvm"},
+	{"QEMU", "kvm"},
+	{"Amazon EC2", "kvm"},
+	{"Google Compute Engine", "kvm"},
+	{"VMware", "vmware"},
+	{"VirtualBox", "virtualbox"},
+	{"Xen", "xen"},
+	{"HVM domU", "xen"},
+	{"Virtual Machine", "hyperv"},
+	{"Parallels", "parallels"},
+	{"Bochs", "bochs"},
+}
 
 func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
+
+	hostInfo, err := GlobalFS.HostInfo()
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	if err != nil {
+		return errors.New("Read host info failed! error:" + err.Error())
 	}
 
-	GlobalHostInfo = GlobalStat.HostInfos()
+	GlobalHostInfo = hostInfo
 
-	if GlobalHostInfo == nil {
-		return errors.New("HostInfos failed! error:got nil")
+	GlobalInventory, err = readInventory()
+
+	if err != nil {
+		return err
 	}
 
 	return nil
 }
 
+//Read static node information
+func readInventory() (map[string]string, error) {
+	inventory := make(map[string]string)
+
+	stat, err := GlobalFS.Stat()
+
+	if err != nil {
+		return nil, errors.New("Read stat failed! error:" + err.Error())
+	}
+
+	memInfo, err := GlobalFS.MemInfo()
+
+	if err != nil {
+		return nil, errors.New("Read meminfo failed! error:" + err.Error())
+	}
+
+	inventory["boot_time"] = time.Unix(stat.BootTime, 0).Local().Format("2006-01-02 15:04:05")
+	inventory["kernel_version"] = GlobalHostInfo.OSRelease
+	inventory["mem_total"] = strconv.FormatUint(memInfo["MemTotal"], 10)
+	inventory["agent_version"] = config.Version
+	inventory["config_hash"] = GlobalNodeInfo.ConfigHash
+
+	//Machine id may be in either place depends on the distribution
+	machineId, err := GlobalFS.ReadString("etc", "machine-id")
+
+	if err != nil {
+		machineId, _ = GlobalFS.ReadString("var", "lib", "dbus", "machine-id")
+	}
+
+	inventory["machine_id"] = machineId
+
+	//Dmi may be unreadable, e.g.:on arm boards or in some containers
+	vendor, _ := GlobalFS.ReadString("sys", "class", "dmi", "id", "sys_vendor")
+	product, _ := GlobalFS.ReadString("sys", "class", "dmi", "id", "product_name")
+
+	inventory["vendor"] = vendor
+	inventory["product"] = product
+	inventory["virtualization"] = detectVirtualization(vendor, product)
+
+	return inventory, nil
+}
+
+//Detect virtualization type, container is detected before hypervisor, "none" if not detected
+func detectVirtualization(vendor string, product string) string {
+	//Cgroup of the init process shows the container it runs in
+	cgroups, err := GlobalFS.ProcessCgroups(1)
+
+	if err == nil {
+		for _, cgroup := range cgroups {
+			switch {
+			case strings.Contains(cgroup, "kubepods"):
+				return "kubernetes"
+			case strings.Contains(cgroup, "docker"):
+				return "docker"
+			case strings.Contains(cgroup, "lxc"):
+				return "lxc"
+			}
+		}
+	}
+
+	_, err = os.Stat(GlobalFS.Path(".dockerenv"))
+
+	if err == nil {
+		return "docker"
+	}
+
+	hypervisor, err := GlobalFS.ReadString("sys", "hypervisor", "type")
+
+	if err == nil && len(hypervisor) != 0 {
+		return hypervisor
+	}
+
+	for _, item := range GlobalHypervisors {
+		if strings.Contains(vendor, item.Keyword) || strings.Contains(product, item.Keyword) {
+			return item.Name
+		}
+	}
+
+	//Cpu flag 'hypervisor' is set in all virtual machines
+	lines, err := GlobalFS.ReadLines("proc", "cpuinfo")
+
+	if err == nil {
+		for _, line := range lines {
+			if strings.HasPrefix(line, "flags") && strings.Contains(line, " hypervisor") {
+				return "vm"
+			}
+		}
+	}
+
+	return "none"
+}
+
 func Collect()(*protocol.Proto, error) {
+	uptime, err := GlobalFS.Uptime()
+
+	if err != nil {
+		return nil, errors.New("Read uptime failed! error:" + err.Error())
+	}
+
 	proto := protocol.NewProto(1)
 
 	data := protocol.NewData()
@@ -55,7 +180,13 @@ func Collect()(*protocol.Proto, error) {
 	data.Tag["ncpus"] = GlobalHostInfo.NCPUs
 	data.Tag["max_cpus"] = GlobalHostInfo.MaxCPUs
 	data.Tag["bitwidth"] = GlobalHostInfo.BitWidth
+
+	for key, value := range GlobalInventory {
+		data.Tag[key] = value
+	}
+
 	data.Field["heartbeat"] = 1
+	data.Field["uptime"] = int64(uptime)
 
 	proto.DataList = append(proto.DataList, *data)
 
@@ -6,34 +6,35 @@ import(
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
+var GlobalFS *procfs.FS
 
 func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
+
+	_, err := GlobalFS.VMStat()
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	if err != nil {
+		return errors.New("Read vmstat failed! error:" + err.Error())
 	}
 
 	return nil
 }
 
 func Collect()(*protocol.Proto, error) {
-	pageStat := GlobalStat.PageStats()
+	vmStat, err := GlobalFS.VMStat()
 
-	if pageStat == nil {
-		return nil, errors.New("PageStats failed! error:got nil")
+	if err != nil {
+		return nil, errors.New("Read vmstat failed! error:" + err.Error())
 	}
 
 	proto := protocol.NewProto(1)
@@ -46,8 +47,8 @@ func Collect()(*protocol.Proto, error) {
 
 	data.Tag["node_name"] = GlobalNodeInfo.Name
 	data.Tag["node_ip"] = GlobalNodeInfo.IP
-	data.Field["page_in"] = pageStat.PageIn
-	data.Field["page_out"] = pageStat.PageOut
+	data.Field["page_in"] = vmStat["pgpgin"]
+	data.Field["page_out"] = vmStat["pgpgout"]
 
 	proto.DataList = append(proto.DataList, *data)
 
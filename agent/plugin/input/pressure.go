@@ -0,0 +1,80 @@
+package main
+
+import(
+	"time"
+	"errors"
+	"strings"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+var GlobalFS *procfs.FS
+var GlobalResources []string
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalFS = procfs.NewFS(config["root_path"])
+
+	GlobalResources = []string{"cpu", "memory", "io"}
+
+	_, ok := config["resources"]
+
+	if ok {
+		GlobalResources = strings.Split(config["resources"], ";")
+	}
+
+	//Pressure stall information needs kernel 4.20+ with CONFIG_PSI enabled
+	for _, resource := range GlobalResources {
+		_, err := GlobalFS.Pressure(resource)
+
+		if err != nil {
+			return errors.New("Read pressure of " + resource + " failed! error:" + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	for _, resource := range GlobalResources {
+		pressures, err := GlobalFS.Pressure(resource)
+
+		if err != nil {
+			return nil, errors.New("Read pressure of " + resource + " failed! error:" + err.Error())
+		}
+
+		//The 'full' line of cpu is always zero before kernel 5.13
+		for kind, pressure := range pressures {
+			data := protocol.NewData()
+			data.Time = currentTime
+
+			data.Tag["node_name"] = GlobalNodeInfo.Name
+			data.Tag["node_ip"] = GlobalNodeInfo.IP
+			data.Tag["resource"] = resource
+			data.Tag["type"] = kind
+
+			data.Field["avg10"] = pressure.Avg10
+			data.Field["avg60"] = pressure.Avg60
+			data.Field["avg300"] = pressure.Avg300
+			//All fields are floats in one measurement
+			data.Field["total"] = float64(pressure.Total)
+
+			proto.DataList = append(proto.DataList, *data)
+		}
+	}
+
+	return proto, nil
+}
@@ -6,34 +6,59 @@ import(
 
 	"github.com/DarkMetrix/monitor/agent/src/config"
 	"github.com/DarkMetrix/monitor/agent/src/protocol"
-
-	"github.com/akhenakh/statgo"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
 )
 
 var GlobalNodeInfo config.NodeInfo
 var GlobalConfig map[string]string
 
-var GlobalStat *statgo.Stat
+var GlobalFS *procfs.FS
 
 func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 	GlobalConfig = make(map[string]string)
 	GlobalConfig = config
 	GlobalNodeInfo = nodeInfo
 
-	GlobalStat = statgo.NewStat()
+	GlobalFS = procfs.NewFS(config["root_path"])
+
+	_, err := GlobalFS.Pids()
 
-	if GlobalStat == nil {
-		return errors.New("NewStat failed! error:got nil")
+	if err != nil {
+		return errors.New("Read pids failed! error:" + err.Error())
 	}
 
 	return nil
 }
 
 func Collect()(*protocol.Proto, error) {
-	processStat := GlobalStat.ProcessStats()
+	pids, err := GlobalFS.Pids()
+
+	if err != nil {
+		return nil, errors.New("Read pids failed! error:" + err.Error())
+	}
+
+	total, running, sleeping, stopped, zombie := 0, 0, 0, 0, 0
+
+	for _, pid := range pids {
+		//Process may exit while reading
+		stat, err := GlobalFS.ProcessStat(pid)
+
+		if err != nil {
+			continue
+		}
+
+		total += 1
 
-	if processStat == nil {
-		return nil, errors.New("ProcessStats failed! error:got nil")
+		switch stat.State {
+		case "R":
+			running += 1
+		case "T", "t":
+			stopped += 1
+		case "Z":
+			zombie += 1
+		default:
+			sleeping += 1
+		}
 	}
 
 	proto := protocol.NewProto(1)
@@ -46,11 +71,11 @@ func Collect()(*protocol.Proto, error) {
 
 	data.Tag["node_name"] = GlobalNodeInfo.Name
 	data.Tag["node_ip"] = GlobalNodeInfo.IP
-	data.Field["total"] = processStat.Total
-	data.Field["running"] = processStat.Running
-	data.Field["sleeping"] = processStat.Sleeping
-	data.Field["stopped"] = processStat.Stopped
-	data.Field["zombie"] = processStat.Zombie
+	data.Field["total"] = total
+	data.Field["running"] = running
+	data.Field["sleeping"] = sleeping
+	data.Field["stopped"] = stopped
+	data.Field["zombie"] = zombie
 
 	proto.DataList = append(proto.DataList, *data)
 
@@ -0,0 +1,383 @@
+package main
+
+import(
+	"os"
+	"os/user"
+	"time"
+	"errors"
+	"regexp"
+	"strings"
+	"strconv"
+	"path/filepath"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/procfs"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+var GlobalFS *procfs.FS
+
+//Process selector
+type Selector struct {
+	Type string                 //Selector type, "exe", "pattern", "pidfile", "user" or "systemd_unit"
+	Value string                //Selector value in config
+
+	pattern *regexp.Regexp      //Compiled pattern of "pattern" selector
+	uid string                  //Uid of "user" selector
+	pid int                     //Pid read from pidfile of "pidfile" selector, 0 if not read
+}
+
+//Process information shared by all selectors in one collect
+type Process struct {
+	stat *procfs.ProcessStat    //Process stat
+	cmdline string              //Command line joined by space
+	uid string                  //Real uid
+	cgroups []string            //Cgroup paths
+}
+
+var GlobalSelectors []*Selector
+
+//Pid and start time identify a process, a pid could be reused by another process between collects
+type ProcessKey struct {
+	pid int
+	startTime uint64
+}
+
+//Cpu times and time of last collect, used to calculate cpu percentage
+var GlobalLastCPUTimes map[ProcessKey]uint64
+var GlobalLastTime time.Time
+
+//Read cmdline, uid or cgroups of each process or not, only when there are selectors need them
+var GlobalNeedCmdline bool
+var GlobalNeedUid bool
+var GlobalNeedCgroups bool
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	//Users are resolved under the root path
+	GlobalFS = procfs.NewFS(config["root_path"])
+	GlobalSelectors = []*Selector{}
+	GlobalNeedCmdline = false
+	GlobalNeedUid = false
+	GlobalNeedCgroups = false
+
+	for _, selectorType := range []string{"exe", "pattern", "pidfile", "user", "systemd_unit"} {
+		values, ok := config[selectorType]
+
+		if !ok {
+			continue
+		}
+
+		for _, value := range strings.Split(values, ";") {
+			if len(value) == 0 {
+				continue
+			}
+
+			selector := &Selector{
+				Type: selectorType,
+				Value: value,
+			}
+
+			switch selectorType {
+			case "pattern":
+				pattern, err := regexp.Compile(value)
+
+				if err != nil {
+					return errors.New("Compile pattern '" + value + "' failed! error:" + err.Error())
+				}
+
+				selector.pattern = pattern
+				GlobalNeedCmdline = true
+			case "user":
+				_, err := strconv.Atoi(value)
+
+				if err == nil {
+					selector.uid = value
+				} else {
+					uid, err := lookupUid(value)
+
+					if err != nil {
+						return errors.New("Lookup user '" + value + "' failed! error:" + err.Error())
+					}
+
+					selector.uid = uid
+				}
+
+				GlobalNeedUid = true
+			case "systemd_unit":
+				GlobalNeedCgroups = true
+			case "exe":
+				GlobalNeedCmdline = true
+			}
+
+			GlobalSelectors = append(GlobalSelectors, selector)
+		}
+	}
+
+	if len(GlobalSelectors) == 0 {
+		return errors.New("Missing config 'exe', 'pattern', 'pidfile', 'user' or 'systemd_unit'")
+	}
+
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalLastCPUTimes = make(map[ProcessKey]uint64)
+	GlobalLastTime = time.Now()
+
+	return nil
+}
+
+//Lookup uid of the user in /etc/passwd under the root path, the uids of processes are the uids of the root path's users.
+//Users not in /etc/passwd(e.g.:LDAP) are looked up by the agent's name service when the root path is "/".
+func lookupUid(name string) (string, error) {
+	uid, err := GlobalFS.LookupUid(name)
+
+	if err == nil || GlobalFS.Root() != "/" {
+		return uid, err
+	}
+
+	userInfo, lookupErr := user.Lookup(name)
+
+	if lookupErr != nil {
+		return "", err
+	}
+
+	return userInfo.Uid, nil
+}
+
+//Read pid from pidfile under the root path
+func readPidFile(path string) int {
+	content, err := GlobalFS.ReadString(path)
+
+	if err != nil {
+		return 0
+	}
+
+	pid, err := strconv.Atoi(content)
+
+	if err != nil {
+		return 0
+	}
+
+	return pid
+}
+
+//Is the process selected by the selector
+func (selector *Selector) Match(process *Process) bool {
+	switch selector.Type {
+	case "exe":
+		//Process name in stat is truncated to 15 characters
+		if process.stat.Comm == selector.Value || (len(selector.Value) > 15 && process.stat.Comm == selector.Value[:15]) {
+			return true
+		}
+
+		args := strings.SplitN(process.cmdline, " ", 2)
+
+		return filepath.Base(args[0]) == selector.Value
+	case "pattern":
+		return selector.pattern.MatchString(process.cmdline)
+	case "pidfile":
+		return selector.pid != 0 && selector.pid == process.stat.Pid
+	case "user":
+		return selector.uid == process.uid
+	case "systemd_unit":
+		for _, cgroup := range process.cgroups {
+			if strings.HasSuffix(cgroup, "/" + selector.Value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+//Read process information needed by selectors
+func readProcess(pid int) (*Process, error) {
+	stat, err := GlobalFS.ProcessStat(pid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	process := &Process{
+		stat: stat,
+	}
+
+	if GlobalNeedCmdline {
+		args, err := GlobalFS.ProcessCmdline(pid)
+
+		if err != nil {
+			return nil, err
+		}
+
+		process.cmdline = strings.Join(args, " ")
+	}
+
+	if GlobalNeedUid {
+		status, err := GlobalFS.ProcessStatus(pid)
+
+		if err != nil {
+			return nil, err
+		}
+
+		//Format is 'real effective saved filesystem'
+		uids := strings.Fields(status["Uid"])
+
+		if len(uids) != 0 {
+			process.uid = uids[0]
+		}
+	}
+
+	if GlobalNeedCgroups {
+		process.cgroups, err = GlobalFS.ProcessCgroups(pid)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return process, nil
+}
+
+func Collect()(*protocol.Proto, error) {
+	pids, err := GlobalFS.Pids()
+
+	if err != nil {
+		return nil, errors.New("Read pids failed! error:" + err.Error())
+	}
+
+	stat, err := GlobalFS.Stat()
+
+	if err != nil {
+		return nil, errors.New("Read stat failed! error:" + err.Error())
+	}
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	elapsed := curTime.Sub(GlobalLastTime).Seconds()
+	GlobalLastTime = curTime
+
+	lastCPUTimes := GlobalLastCPUTimes
+	GlobalLastCPUTimes = make(map[ProcessKey]uint64)
+
+	for _, selector := range GlobalSelectors {
+		if selector.Type == "pidfile" {
+			selector.pid = readPidFile(selector.Value)
+		}
+	}
+
+	//Match all processes with all selectors
+	matches := make(map[*Selector][]*Process)
+
+	for _, pid := range pids {
+		//Process may exit while reading
+		process, err := readProcess(pid)
+
+		if err != nil {
+			continue
+		}
+
+		for _, selector := range GlobalSelectors {
+			if selector.Match(process) {
+				matches[selector] = append(matches[selector], process)
+			}
+		}
+	}
+
+	proto := protocol.NewProto(1)
+
+	pageSize := uint64(os.Getpagesize())
+
+	for _, selector := range GlobalSelectors {
+		//Running processes count of the selector, 0 means the process disappeared
+		data := protocol.NewData()
+		data.Time = currentTime
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag[selector.Type] = selector.Value
+		data.Field["running"] = len(matches[selector])
+
+		proto.DataList = append(proto.DataList, *data)
+
+		for _, process := range matches[selector] {
+			pid := process.stat.Pid
+			cpuTimes := process.stat.UTime + process.stat.STime
+			key := ProcessKey{pid: pid, startTime: process.stat.StartTime}
+
+			GlobalLastCPUTimes[key] = cpuTimes
+
+			data := protocol.NewData()
+			data.Time = currentTime
+
+			data.Tag["node_name"] = GlobalNodeInfo.Name
+			data.Tag["node_ip"] = GlobalNodeInfo.IP
+			data.Tag[selector.Type] = selector.Value
+			data.Tag["process_name"] = process.stat.Comm
+			data.Tag["pid"] = strconv.Itoa(pid)
+
+			data.Field["memory_rss"] = uint64(process.stat.RSS) * pageSize
+			data.Field["memory_vms"] = process.stat.VSize
+			data.Field["num_threads"] = process.stat.NumThreads
+			data.Field["uptime"] = curTime.Unix() - (stat.BootTime + int64(process.stat.StartTime / procfs.ClockTicks))
+
+			//Fds and io are only readable by the owner of the process or root
+			fds, err := GlobalFS.ProcessFDCount(pid)
+
+			if err == nil {
+				data.Field["num_fds"] = fds
+			}
+
+			io, err := GlobalFS.ProcessIO(pid)
+
+			if err == nil {
+				data.Field["read_bytes"] = io["read_bytes"]
+				data.Field["write_bytes"] = io["write_bytes"]
+			}
+
+			status, err := GlobalFS.ProcessStatus(pid)
+
+			if err == nil {
+				voluntary, err := strconv.ParseUint(status["voluntary_ctxt_switches"], 10, 64)
+
+				if err == nil {
+					data.Field["voluntary_context_switches"] = voluntary
+				}
+
+				involuntary, err := strconv.ParseUint(status["nonvoluntary_ctxt_switches"], 10, 64)
+
+				if err == nil {
+					data.Field["involuntary_context_switches"] = involuntary
+				}
+			}
+
+			proto.DataList = append(proto.DataList, *data)
+
+			//Cpu percentage is a float, so it is reported to the 'procstat_percent' measurement instead of mixing with the integer counters
+			percentData := protocol.NewData()
+			percentData.Name = "percent"
+			percentData.Time = currentTime
+
+			for name, value := range data.Tag {
+				percentData.Tag[name] = value
+			}
+
+			//Cpu percentage needs the last sample, a new process reports 0
+			lastCPUTime, ok := lastCPUTimes[key]
+
+			if ok && elapsed > 0 && cpuTimes >= lastCPUTime {
+				percentData.Field["cpu_percent"] = float64(cpuTimes - lastCPUTime) / float64(procfs.ClockTicks) / elapsed * 100
+			} else {
+				percentData.Field["cpu_percent"] = float64(0)
+			}
+
+			proto.DataList = append(proto.DataList, *percentData)
+		}
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test procstat.go procstat_test.go
+
+import(
+	"os"
+	"fmt"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+func writeRootFile(t *testing.T, root string, path string, content string) {
+	path = filepath.Join(root, path)
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+//Write /proc/<pid> files of a fake process under the root path
+func writeProcess(t *testing.T, root string, pid int, comm string, cmdline string, uid int, unit string, utime int, startTime int) {
+	dir := filepath.Join("proc", fmt.Sprint(pid))
+
+	writeRootFile(t, root, filepath.Join(dir, "stat"), fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4194560 100 0 0 0 %d 0 0 0 20 0 2 0 %d 1048576 256 18446744073709551615\n", pid, comm, pid, pid, utime, startTime))
+	writeRootFile(t, root, filepath.Join(dir, "cmdline"), cmdline)
+	writeRootFile(t, root, filepath.Join(dir, "status"), fmt.Sprintf("Name:\t%s\nUid:\t%d\t%d\t%d\t%d\nvoluntary_ctxt_switches:\t10\nnonvoluntary_ctxt_switches:\t2\n", comm, uid, uid, uid, uid))
+	writeRootFile(t, root, filepath.Join(dir, "io"), "rchar: 100\nwchar: 200\nread_bytes: 4096\nwrite_bytes: 8192\n")
+	writeRootFile(t, root, filepath.Join(dir, "cgroup"), "0::" + unit + "\n")
+	writeRootFile(t, root, filepath.Join(dir, "fd", "0"), "")
+}
+
+//Fake root path with users and processes unknown to the agent's own /etc/passwd
+func writeProcRoot(t *testing.T) string {
+	root := t.TempDir()
+
+	writeRootFile(t, root, "proc/stat", "cpu  100 0 100 1000 0 0 0 0 0 0\nbtime 1700000000\n")
+	writeRootFile(t, root, "etc/passwd", "root:x:0:0:root:/root:/bin/bash\nnginx:x:101:101::/nonexistent:/usr/sbin/nologin\nkafka:x:4242:4242::/opt/kafka:/bin/sh\n")
+	writeRootFile(t, root, "run/nginx.pid", "100\n")
+
+	writeProcess(t, root, 100, "nginx", "nginx: master process /usr/sbin/nginx\x00", 0, "/system.slice/nginx.service", 10, 1000)
+	writeProcess(t, root, 101, "nginx", "nginx: worker process\x00", 101, "/system.slice/nginx.service", 20, 1001)
+	writeProcess(t, root, 200, "java", "/usr/bin/java\x00-cp\x00kafka.jar\x00kafka.Kafka\x00", 4242, "/system.slice/kafka.service", 300, 2000)
+	//Process name is truncated to 15 characters
+	writeProcess(t, root, 300, "postgres_export", "/usr/local/bin/postgres_exporter\x00", 4242, "/system.slice/exporter.service", 0, 3000)
+
+	return root
+}
+
+//Get the running count of each selector, the data of each pid and the cpu percentage of each pid
+func splitProcstat(proto *protocol.Proto) (map[string]interface{}, map[string]protocol.Data, map[string]interface{}) {
+	running := make(map[string]interface{})
+	processes := make(map[string]protocol.Data)
+	percents := make(map[string]interface{})
+
+	for _, data := range proto.DataList {
+		for _, selectorType := range []string{"exe", "pattern", "pidfile", "user", "systemd_unit"} {
+			value, ok := data.Tag[selectorType]
+
+			if !ok {
+				continue
+			}
+
+			pid, ok := data.Tag["pid"]
+
+			if ok && data.Name == "percent" {
+				percents[selectorType + ":" + fmt.Sprint(value) + ":" + fmt.Sprint(pid)] = data.Field["cpu_percent"]
+			} else if ok {
+				processes[selectorType + ":" + fmt.Sprint(value) + ":" + fmt.Sprint(pid)] = data
+			} else {
+				running[selectorType + ":" + fmt.Sprint(value)] = data.Field["running"]
+			}
+		}
+	}
+
+	return running, processes, percents
+}
+
+func TestProcstatSelectors(t *testing.T) {
+	root := writeProcRoot(t)
+
+	err := Init(config.NodeInfo{}, map[string]string{
+		"root_path": root,
+		"exe": "nginx;postgres_exporter;missing",
+		"pattern": `kafka\.Kafka`,
+		"pidfile": "/run/nginx.pid",
+		"user": "kafka;101",
+		"systemd_unit": "nginx.service",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running, processes, percents := splitProcstat(proto)
+
+	want := map[string]interface{}{
+		"exe:nginx": 2,
+		"exe:postgres_exporter": 1,
+		"exe:missing": 0,
+		"pattern:kafka\\.Kafka": 1,
+		"pidfile:/run/nginx.pid": 1,
+		//Kafka is only in the passwd of the root path
+		"user:kafka": 2,
+		"user:101": 1,
+		"systemd_unit:nginx.service": 2,
+	}
+
+	for key, value := range want {
+		if running[key] != value {
+			t.Errorf("%s: got running %v, want %v", key, running[key], value)
+		}
+	}
+
+	for _, key := range []string{"exe:nginx:100", "exe:nginx:101", "pidfile:/run/nginx.pid:100", "user:101:101", "user:kafka:200", "user:kafka:300", "systemd_unit:nginx.service:101"} {
+		_, ok := processes[key]
+
+		if !ok {
+			t.Errorf("%s: not selected", key)
+		}
+	}
+
+	data := processes["pattern:kafka\\.Kafka:200"]
+
+	if data.Tag["process_name"] != "java" || data.Field["memory_rss"] != uint64(256 * os.Getpagesize()) || data.Field["read_bytes"] != uint64(4096) || data.Field["num_fds"] != 1 {
+		t.Errorf("got %+v", data)
+	}
+
+	//Float percentages are not mixed with the integer counters
+	_, ok := data.Field["cpu_percent"]
+
+	if ok || percents["pattern:kafka\\.Kafka:200"] != float64(0) {
+		t.Errorf("got %+v, want cpu_percent 0 in procstat_percent only", data)
+	}
+
+	//Unknown users fail even if they are known to the agent
+	err = Init(config.NodeInfo{}, map[string]string{"root_path": root, "user": "nobody"})
+
+	if err == nil {
+		t.Errorf("unknown user should fail")
+	}
+}
+
+func TestProcstatCPUPercent(t *testing.T) {
+	root := writeProcRoot(t)
+
+	err := Init(config.NodeInfo{}, map[string]string{"root_path": root, "exe": "java"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//A new process reports 0
+	_, _, percents := splitProcstat(proto)
+
+	if percents["exe:java:200"] != float64(0) {
+		t.Errorf("got %v, want cpu_percent 0", percents["exe:java:200"])
+	}
+
+	writeProcess(t, root, 200, "java", "/usr/bin/java\x00", 4242, "/", 100000, 2000)
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, percents = splitProcstat(proto)
+
+	percent, ok := percents["exe:java:200"].(float64)
+
+	if !ok || percent <= 0 {
+		t.Errorf("got %v, want cpu_percent > 0", percents["exe:java:200"])
+	}
+
+	//The pid is reused by another process with a different start time
+	writeProcess(t, root, 200, "java", "/usr/bin/java\x00", 4242, "/", 200000, 5000)
+
+	proto, err = Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, percents = splitProcstat(proto)
+
+	if percents["exe:java:200"] != float64(0) {
+		t.Errorf("got %v, want cpu_percent 0 of the new process", percents["exe:java:200"])
+	}
+}
@@ -0,0 +1,675 @@
+package main
+
+import(
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"math"
+	"bufio"
+	"errors"
+	"strings"
+	"strconv"
+	"net/http"
+	"net/url"
+	"io/ioutil"
+	"encoding/json"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+	"github.com/DarkMetrix/monitor/agent/src/filter"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Max bytes of a scrape
+const MaxBodyBytes = 16 * 1024 * 1024
+
+//Target to scrape
+type Target struct {
+	Url string
+	Labels map[string]string     //Labels of the target list file added as tags
+}
+
+//Sample of a metric, e.g.:'http_requests_total{method="get"} 1027 1395066363000'
+type Sample struct {
+	Name string
+	Labels map[string]string
+	Value float64
+	Time time.Time               //Zero if no timestamp
+}
+
+//Metric family, samples of a histogram or summary are in the family without suffix
+type Family struct {
+	Name string
+	Type string                  //"counter", "gauge", "histogram", "summary" or "untyped"
+	Samples []Sample
+}
+
+var GlobalUrls []string
+var GlobalTargetsFile string
+var GlobalMetricsPath string
+var GlobalScheme string
+var GlobalMapping string
+var GlobalFilter *filter.Filter
+var GlobalClient *http.Client
+
+//Tags set by the plugin, scraped labels of the same names are prefixed with "exported_"
+var GlobalReservedTags = map[string]bool{"url": true, "node_name": true, "node_ip": true, "instance": true}
+
+//Tags set by measurement mapping
+var GlobalMeasurementTags = map[string]bool{"measurement": true, "type": true}
+
+//Targets scraped, re-read if the target list file changed
+var GlobalTargets []*Target
+var GlobalTargetsModTime time.Time
+var GlobalTargetsSize int64
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	GlobalUrls = []string{}
+
+	for _, targetUrl := range strings.Split(config["urls"], ";") {
+		if len(targetUrl) == 0 {
+			continue
+		}
+
+		_, err := url.Parse(targetUrl)
+
+		if err != nil {
+			return errors.New("Url '" + targetUrl + "' invalid! error:" + err.Error())
+		}
+
+		GlobalUrls = append(GlobalUrls, targetUrl)
+	}
+
+	GlobalTargetsFile = config["targets_file"]
+
+	if len(GlobalUrls) == 0 && len(GlobalTargetsFile) == 0 {
+		return errors.New("No url or targets_file is configured!")
+	}
+
+	GlobalMetricsPath = "/metrics"
+
+	_, ok := config["metrics_path"]
+
+	if ok {
+		GlobalMetricsPath = config["metrics_path"]
+	}
+
+	GlobalScheme = "http"
+
+	_, ok = config["scheme"]
+
+	if ok {
+		GlobalScheme = config["scheme"]
+	}
+
+	GlobalMapping = "field"
+
+	_, ok = config["mapping"]
+
+	if ok {
+		GlobalMapping = config["mapping"]
+	}
+
+	if GlobalMapping != "field" && GlobalMapping != "measurement" {
+		return errors.New("Mapping invalid! should be field or measurement")
+	}
+
+	var err error
+
+	GlobalFilter, err = filter.NewFilter(config["include"], config["exclude"])
+
+	if err != nil {
+		return err
+	}
+
+	timeout := 10.0
+
+	_, ok = config["timeout"]
+
+	if ok {
+		timeout, err = strconv.ParseFloat(config["timeout"], 64)
+
+		if err != nil {
+			return errors.New("Parse timeout failed! error:" + err.Error())
+		}
+	}
+
+	GlobalClient = &http.Client{
+		Timeout: time.Duration(timeout * float64(time.Second)),
+	}
+
+	GlobalTargets = []*Target{}
+	GlobalTargetsModTime = time.Time{}
+	GlobalTargetsSize = 0
+
+	if len(GlobalTargetsFile) != 0 {
+		err = loadTargets()
+
+		if err != nil {
+			return errors.New("Load targets_file failed! error:" + err.Error())
+		}
+	} else {
+		GlobalTargets = newTargets(nil)
+	}
+
+	return nil
+}
+
+//Create targets of the urls configured and the urls of the target list file
+func newTargets(fileTargets []*Target) []*Target {
+	targets := []*Target{}
+
+	for _, targetUrl := range GlobalUrls {
+		targets = append(targets, &Target{
+			Url: targetUrl,
+			Labels: make(map[string]string),
+		})
+	}
+
+	return append(targets, fileTargets...)
+}
+
+//Get url of the target address, "host:port" is expanded with scheme and metrics_path
+func getTargetUrl(address string) string {
+	if strings.Contains(address, "://") {
+		return address
+	}
+
+	return GlobalScheme + "://" + address + GlobalMetricsPath
+}
+
+//Get tag name of the scraped label, labels conflicting with the tags set by the plugin are renamed, e.g.:"instance" to "exported_instance"
+func getLabelTag(name string) string {
+	if GlobalReservedTags[name] || (GlobalMapping == "measurement" && GlobalMeasurementTags[name]) {
+		return "exported_" + name
+	}
+
+	return name
+}
+
+//Load the target list file if changed, it is urls one per line, or json of prometheus file_sd_configs, e.g.:'[{"targets":["10.0.0.1:9100"],"labels":{"job":"node"}}]'
+func loadTargets() error {
+	info, err := os.Stat(GlobalTargetsFile)
+
+	if err != nil {
+		return err
+	}
+
+	if info.ModTime().Equal(GlobalTargetsModTime) && info.Size() == GlobalTargetsSize {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(GlobalTargetsFile)
+
+	if err != nil {
+		return err
+	}
+
+	fileTargets := []*Target{}
+
+	text := strings.TrimSpace(string(content))
+
+	if strings.HasPrefix(text, "[") {
+		groups := []struct {
+			Targets []string `json:"targets"`
+			Labels map[string]string `json:"labels"`
+		}{}
+
+		err = json.Unmarshal(content, &groups)
+
+		if err != nil {
+			return err
+		}
+
+		for _, group := range groups {
+			for _, address := range group.Targets {
+				target := &Target{
+					Url: getTargetUrl(address),
+					Labels: make(map[string]string),
+				}
+
+				for key, value := range group.Labels {
+					target.Labels[key] = value
+				}
+
+				fileTargets = append(fileTargets, target)
+			}
+		}
+	} else {
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+
+			if len(line) == 0 || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			fileTargets = append(fileTargets, &Target{
+				Url: getTargetUrl(line),
+				Labels: make(map[string]string),
+			})
+		}
+	}
+
+	GlobalTargets = newTargets(fileTargets)
+	GlobalTargetsModTime = info.ModTime()
+	GlobalTargetsSize = info.Size()
+
+	return nil
+}
+
+//Parse a sample line, e.g.:'name{label="value",...} value [timestamp]'
+func parseSample(line string) (*Sample, error) {
+	sample := &Sample{
+		Labels: make(map[string]string),
+	}
+
+	index := strings.IndexAny(line, "{ \t")
+
+	if index <= 0 {
+		return nil, errors.New("Metric name not found!")
+	}
+
+	sample.Name = line[:index]
+
+	rest := line[index:]
+
+	if rest[0] == '{' {
+		rest = rest[1:]
+
+		for {
+			rest = strings.TrimLeft(rest, " \t,")
+
+			if len(rest) == 0 {
+				return nil, errors.New("Labels are not closed!")
+			}
+
+			if rest[0] == '}' {
+				rest = rest[1:]
+				break
+			}
+
+			equal := strings.Index(rest, "=")
+
+			if equal <= 0 || len(rest) < equal + 2 || rest[equal + 1] != '"' {
+				return nil, errors.New("Label invalid!")
+			}
+
+			name := strings.TrimSpace(rest[:equal])
+			rest = rest[equal + 2:]
+
+			//Escapes in label values are '\\', '\"' and '\n'
+			value := []byte{}
+			closed := false
+
+			for index = 0; index < len(rest); index++ {
+				if rest[index] == '\\' && index + 1 < len(rest) {
+					index++
+
+					if rest[index] == 'n' {
+						value = append(value, '\n')
+					} else {
+						value = append(value, rest[index])
+					}
+
+					continue
+				}
+
+				if rest[index] == '"' {
+					closed = true
+					break
+				}
+
+				value = append(value, rest[index])
+			}
+
+			if !closed {
+				return nil, errors.New("Label value is not closed!")
+			}
+
+			sample.Labels[name] = string(value)
+			rest = rest[index + 1:]
+		}
+	}
+
+	parts := strings.Fields(rest)
+
+	if len(parts) < 1 || len(parts) > 2 {
+		return nil, errors.New("Value invalid!")
+	}
+
+	//"NaN", "+Inf" and "-Inf" are parsed too
+	value, err := strconv.ParseFloat(parts[0], 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sample.Value = value
+
+	if len(parts) == 2 {
+		timestamp, err := strconv.ParseInt(parts[1], 10, 64)
+
+		if err != nil {
+			return nil, errors.New("Timestamp invalid!")
+		}
+
+		sample.Time = time.Unix(0, timestamp * int64(time.Millisecond))
+	}
+
+	return sample, nil
+}
+
+//Get the family of the sample, suffixes of histograms and summaries are removed
+func getFamily(name string, types map[string]string) (string, string) {
+	typ, ok := types[name]
+
+	if ok {
+		return name, typ
+	}
+
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total", "_created"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		base := strings.TrimSuffix(name, suffix)
+
+		typ, ok = types[base]
+
+		if ok {
+			return base, typ
+		}
+	}
+
+	return name, "untyped"
+}
+
+//Parse text exposition format, lines could not be parsed are counted
+func parse(reader io.Reader) ([]*Family, int, error) {
+	families := []*Family{}
+	familyMap := make(map[string]*Family)
+	types := make(map[string]string)
+
+	failed := 0
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64 * 1024), 1024 * 1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 {
+			continue
+		}
+
+		//Comments other than '# TYPE name type' are ignored
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+
+			if len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = strings.ToLower(fields[3])
+			}
+
+			continue
+		}
+
+		sample, err := parseSample(line)
+
+		if err != nil {
+			failed++
+			continue
+		}
+
+		name, typ := getFamily(sample.Name, types)
+
+		if GlobalFilter.Excluded(name) || !GlobalFilter.Included(name) {
+			continue
+		}
+
+		family, ok := familyMap[name]
+
+		if !ok {
+			family = &Family{
+				Name: name,
+				Type: typ,
+			}
+
+			familyMap[name] = family
+			families = append(families, family)
+		}
+
+		family.Samples = append(family.Samples, *sample)
+	}
+
+	return families, failed, scanner.Err()
+}
+
+//Key of the labels, labels in ignores are not included
+func labelsKey(labels map[string]string, ignores ...string) string {
+	keys := []string{}
+
+	for key, value := range labels {
+		ignored := false
+
+		for _, ignore := range ignores {
+			if key == ignore {
+				ignored = true
+			}
+		}
+
+		if !ignored {
+			keys = append(keys, key + "=" + strconv.Quote(value))
+		}
+	}
+
+	sort.Strings(keys)
+
+	return strings.Join(keys, ",")
+}
+
+//Convert families to data, samples with the same labels are in the same data
+func convert(currentTime string, target *Target, families []*Family) []protocol.Data {
+	datas := []*protocol.Data{}
+	dataMap := make(map[string]*protocol.Data)
+
+	getData := func(key string, sample *Sample, ignores ...string) *protocol.Data {
+		data, ok := dataMap[key]
+
+		if ok {
+			return data
+		}
+
+		data = protocol.NewData()
+		data.Time = currentTime
+
+		if !sample.Time.IsZero() {
+			data.Time = sample.Time.Local().Format("2006-01-02 15:04:05")
+		}
+
+		for name, value := range sample.Labels {
+			ignored := false
+
+			for _, ignore := range ignores {
+				if name == ignore {
+					ignored = true
+				}
+			}
+
+			if !ignored {
+				data.Tag[getLabelTag(name)] = value
+			}
+		}
+
+		//Labels of the target override the labels of the sample like prometheus
+		for name, value := range target.Labels {
+			data.Tag[getLabelTag(name)] = value
+		}
+
+		data.Tag["node_name"] = GlobalNodeInfo.Name
+		data.Tag["node_ip"] = GlobalNodeInfo.IP
+		data.Tag["url"] = target.Url
+
+		dataMap[key] = data
+		datas = append(datas, data)
+
+		return data
+	}
+
+	for _, family := range families {
+		for index := range family.Samples {
+			sample := &family.Samples[index]
+
+			//NaN and Inf could not be written
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+
+			if GlobalMapping == "field" {
+				data := getData(labelsKey(sample.Labels), sample)
+				data.Field[sample.Name] = sample.Value
+				continue
+			}
+
+			//Measurement mapping, buckets and quantiles are fields of the family
+			key := family.Name + "{" + labelsKey(sample.Labels, "le", "quantile") + "}"
+
+			data := getData(key, sample, "le", "quantile")
+			data.Tag["measurement"] = family.Name
+			data.Tag["type"] = family.Type
+
+			switch {
+			case family.Type == "histogram" && sample.Name == family.Name + "_bucket":
+				data.Field["bucket_" + sample.Labels["le"]] = sample.Value
+			case family.Type == "summary" && sample.Name == family.Name:
+				data.Field["quantile_" + sample.Labels["quantile"]] = sample.Value
+			case sample.Name == family.Name:
+				data.Field["value"] = sample.Value
+			default:
+				data.Field[strings.TrimPrefix(sample.Name, family.Name + "_")] = sample.Value
+			}
+		}
+	}
+
+	result := []protocol.Data{}
+
+	for _, data := range datas {
+		result = append(result, *data)
+	}
+
+	return result
+}
+
+//Scrape the target, the scrape status is reported as the first data
+func scrape(currentTime string, target *Target) []protocol.Data {
+	status := protocol.NewData()
+	status.Time = currentTime
+
+	for name, value := range target.Labels {
+		status.Tag[getLabelTag(name)] = value
+	}
+
+	status.Tag["node_name"] = GlobalNodeInfo.Name
+	status.Tag["node_ip"] = GlobalNodeInfo.IP
+	status.Tag["url"] = target.Url
+
+	//All values are floats like the samples, so the types are not mixed in one measurement
+	status.Field["up"] = float64(0)
+
+	start := time.Now()
+
+	families, failed, err := get(target)
+
+	status.Field["scrape_duration"] = float64(time.Since(start)) / float64(time.Millisecond)
+
+	if err != nil {
+		log.Warnf("Scrape %s failed! error:%s", target.Url, err)
+		return []protocol.Data{*status}
+	}
+
+	samples := 0
+
+	for _, family := range families {
+		samples += len(family.Samples)
+	}
+
+	status.Field["up"] = float64(1)
+	status.Field["scrape_samples"] = float64(samples)
+	status.Field["parse_errors"] = float64(failed)
+
+	return append([]protocol.Data{*status}, convert(currentTime, target, families)...)
+}
+
+//Get and parse the metrics of the target
+func get(target *Target) ([]*Family, int, error) {
+	request, err := http.NewRequest("GET", target.Url, nil)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	request.Header.Set("Accept", "text/plain;version=0.0.4;q=1,*/*;q=0.1")
+
+	response, err := GlobalClient.Do(request)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, 0, errors.New("Status code is " + strconv.Itoa(response.StatusCode))
+	}
+
+	return parse(io.LimitReader(response.Body, MaxBodyBytes))
+}
+
+func Collect()(*protocol.Proto, error) {
+	if len(GlobalTargetsFile) != 0 {
+		err := loadTargets()
+
+		//Targets loaded last time are scraped
+		if err != nil {
+			log.Warnf("Load targets_file %s failed! error:%s", GlobalTargetsFile, err)
+		}
+	}
+
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	targets := GlobalTargets
+	results := make([][]protocol.Data, len(targets))
+
+	var wait sync.WaitGroup
+
+	//Targets are scraped concurrently, a slow target does not delay the others
+	for index, target := range targets {
+		wait.Add(1)
+
+		go func(index int, target *Target) {
+			defer wait.Done()
+
+			results[index] = scrape(currentTime, target)
+		}(index, target)
+	}
+
+	wait.Wait()
+
+	for _, datas := range results {
+		proto.DataList = append(proto.DataList, datas...)
+	}
+
+	return proto, nil
+}
@@ -0,0 +1,421 @@
+package main
+
+//Each plugin is a single file, run with:
+//    go test prometheus.go prometheus_test.go
+
+import(
+	"os"
+	"net"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"net/http"
+	"path/filepath"
+	"net/http/httptest"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+func initTest(t *testing.T, options map[string]string) {
+	_, ok := options["urls"]
+
+	if !ok {
+		_, ok = options["targets_file"]
+	}
+
+	if !ok {
+		options["urls"] = "http://127.0.0.1:9100/metrics"
+	}
+
+	err := Init(config.NodeInfo{Name: "node", IP: "127.0.0.1"}, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		line string
+		want *Sample
+	}{
+		{`up 1`, &Sample{Name: "up", Labels: map[string]string{}, Value: 1}},
+		{`http_requests_total{method="post",code="200"} 1027 1395066363000`, &Sample{
+			Name: "http_requests_total",
+			Labels: map[string]string{"method": "post", "code": "200"},
+			Value: 1027,
+		}},
+		//Escapes are '\\', '\"' and '\n', ',' and '}' in quotes are not separators
+		{`msdos_file_access_time_seconds{path="C:\\DIR\\FILE.TXT",error="Cannot find file:\n\"FILE.TXT\"",list="a,b}"} 1.458255915e9`, &Sample{
+			Name: "msdos_file_access_time_seconds",
+			Labels: map[string]string{"path": `C:\DIR\FILE.TXT`, "error": "Cannot find file:\n\"FILE.TXT\"", "list": "a,b}"},
+			Value: 1.458255915e9,
+		}},
+		{`metric_without_timestamp_and_labels 12.47`, &Sample{Name: "metric_without_timestamp_and_labels", Labels: map[string]string{}, Value: 12.47}},
+		{`trailing_comma{a="1",} -3`, &Sample{Name: "trailing_comma", Labels: map[string]string{"a": "1"}, Value: -3}},
+		{`bucket{le="+Inf"} +Inf`, &Sample{Name: "bucket", Labels: map[string]string{"le": "+Inf"}, Value: math.Inf(1)}},
+	}
+
+	for _, test := range tests {
+		sample, err := parseSample(test.line)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+
+		//Timestamp is checked separately
+		sample.Time = test.want.Time
+
+		if !reflect.DeepEqual(sample, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.line, sample, test.want)
+		}
+	}
+
+	sample, err := parseSample(`http_requests_total{method="post"} 1027 1395066363000`)
+
+	if err != nil || sample.Time.UnixNano() != 1395066363000 * 1000000 {
+		t.Errorf("timestamp: got %v, %v", sample, err)
+	}
+
+	invalids := []string{
+		`{a="1"} 1`,
+		`name{a="1" 1`,
+		`name{a=1} 1`,
+		`name{a="1} 1`,
+		`name`,
+		`name abc`,
+		`name 1 2 3`,
+	}
+
+	for _, line := range invalids {
+		_, err := parseSample(line)
+
+		if err == nil {
+			t.Errorf("%s: should fail", line)
+		}
+	}
+}
+
+func TestGetFamily(t *testing.T) {
+	types := map[string]string{
+		"http_requests": "counter",
+		"process_cpu_seconds_total": "counter",
+		"request_duration_seconds": "histogram",
+		"rpc_latency": "summary",
+	}
+
+	tests := []struct {
+		name string
+		family string
+		typ string
+	}{
+		//OpenMetrics style counter family without the '_total' suffix
+		{"http_requests_total", "http_requests", "counter"},
+		{"http_requests_created", "http_requests", "counter"},
+		//Counter typed with the suffix
+		{"process_cpu_seconds_total", "process_cpu_seconds_total", "counter"},
+		{"request_duration_seconds_bucket", "request_duration_seconds", "histogram"},
+		{"request_duration_seconds_sum", "request_duration_seconds", "histogram"},
+		{"request_duration_seconds_count", "request_duration_seconds", "histogram"},
+		{"rpc_latency", "rpc_latency", "summary"},
+		{"rpc_latency_count", "rpc_latency", "summary"},
+		{"unknown_total", "unknown_total", "untyped"},
+	}
+
+	for _, test := range tests {
+		family, typ := getFamily(test.name, types)
+
+		if family != test.family || typ != test.typ {
+			t.Errorf("%s: got %s %s, want %s %s", test.name, family, typ, test.family, test.typ)
+		}
+	}
+}
+
+//Exposition with a histogram and a summary
+const GlobalExposition = `# HELP request_duration_seconds Request duration.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{path="/",le="0.1"} 5
+request_duration_seconds_bucket{path="/",le="+Inf"} 8
+request_duration_seconds_sum{path="/"} 1.5
+request_duration_seconds_count{path="/"} 8
+request_duration_seconds_bucket{path="/api",le="0.1"} 1
+request_duration_seconds_bucket{path="/api",le="+Inf"} 2
+request_duration_seconds_sum{path="/api"} 0.3
+request_duration_seconds_count{path="/api"} 2
+# TYPE rpc_latency summary
+rpc_latency{quantile="0.5"} 0.02
+rpc_latency{quantile="0.99"} NaN
+rpc_latency_sum 10
+rpc_latency_count 400
+# TYPE jobs counter
+jobs_total{instance="worker1",url="/jobs",type="batch"} 3
+this is not a sample
+`
+
+func getMeasurement(datas []protocol.Data, measurement string, tag string, value string) *protocol.Data {
+	for index := range datas {
+		if datas[index].Tag["measurement"] == measurement && (len(tag) == 0 || datas[index].Tag[tag] == value) {
+			return &datas[index]
+		}
+	}
+
+	return nil
+}
+
+func TestConvertMeasurement(t *testing.T) {
+	initTest(t, map[string]string{"mapping": "measurement"})
+
+	families, failed, err := parse(strings.NewReader(GlobalExposition))
+
+	if err != nil || failed != 1 || len(families) != 3 {
+		t.Fatalf("parse: got %d families, %d failed, %v", len(families), failed, err)
+	}
+
+	target := &Target{Url: "http://10.0.0.1:9100/metrics", Labels: map[string]string{"job": "node"}}
+	datas := convert("2024-01-01 00:00:00", target, families)
+
+	tests := []struct {
+		measurement string
+		tag string
+		value string
+		tags map[string]interface{}
+		fields map[string]interface{}
+	}{
+		//Buckets, sum and count with the same labels are grouped
+		{"request_duration_seconds", "path", "/", map[string]interface{}{"type": "histogram", "job": "node", "url": target.Url}, map[string]interface{}{
+			"bucket_0.1": float64(5), "bucket_+Inf": float64(8), "sum": 1.5, "count": float64(8),
+		}},
+		{"request_duration_seconds", "path", "/api", map[string]interface{}{"type": "histogram"}, map[string]interface{}{
+			"bucket_0.1": float64(1), "bucket_+Inf": float64(2), "sum": 0.3, "count": float64(2),
+		}},
+		//NaN quantile is dropped
+		{"rpc_latency", "", "", map[string]interface{}{"type": "summary"}, map[string]interface{}{
+			"quantile_0.5": 0.02, "sum": float64(10), "count": float64(400),
+		}},
+		//Labels conflicting with the tags are exported
+		{"jobs", "", "", map[string]interface{}{"type": "counter", "url": target.Url, "exported_url": "/jobs", "exported_instance": "worker1", "exported_type": "batch"}, map[string]interface{}{
+			"total": float64(3),
+		}},
+	}
+
+	for _, test := range tests {
+		data := getMeasurement(datas, test.measurement, test.tag, test.value)
+
+		if data == nil {
+			t.Errorf("%s %s: not reported", test.measurement, test.value)
+			continue
+		}
+
+		for key, value := range test.tags {
+			if data.Tag[key] != value {
+				t.Errorf("%s %s: tag %s got %v, want %v", test.measurement, test.value, key, data.Tag[key], value)
+			}
+		}
+
+		if !reflect.DeepEqual(data.Field, test.fields) {
+			t.Errorf("%s %s: got fields %v, want %v", test.measurement, test.value, data.Field, test.fields)
+		}
+
+		_, ok := data.Tag["le"]
+
+		if ok {
+			t.Errorf("%s %s: le should not be tagged", test.measurement, test.value)
+		}
+	}
+
+	if len(datas) != len(tests) {
+		t.Errorf("got %d data, want %d", len(datas), len(tests))
+	}
+}
+
+func TestConvertField(t *testing.T) {
+	initTest(t, map[string]string{})
+
+	families, _, err := parse(strings.NewReader(GlobalExposition))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := &Target{Url: "http://10.0.0.1:9100/metrics", Labels: map[string]string{}}
+	datas := convert("2024-01-01 00:00:00", target, families)
+
+	for _, data := range datas {
+		value, ok := data.Field["jobs_total"]
+
+		if !ok {
+			continue
+		}
+
+		//Type is not set by field mapping
+		if value != float64(3) || data.Tag["type"] != "batch" || data.Tag["exported_instance"] != "worker1" || data.Tag["exported_url"] != "/jobs" || data.Tag["url"] != target.Url {
+			t.Errorf("jobs_total: got %+v", data)
+		}
+
+		return
+	}
+
+	t.Errorf("jobs_total not reported")
+}
+
+func TestTargetsFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		content string
+		want []string
+		labels map[string]string
+	}{
+		{"# node exporters\n10.0.0.1:9100\nhttps://10.0.0.2:9100/custom\n", []string{"https://10.0.0.1:9100/probe", "https://10.0.0.2:9100/custom"}, map[string]string{}},
+		{`[{"targets":["10.0.0.3:9100"],"labels":{"job":"node"}}]`, []string{"https://10.0.0.3:9100/probe"}, map[string]string{"job": "node"}},
+	}
+
+	for index, test := range tests {
+		path := filepath.Join(dir, "targets" + string(rune('0' + index)))
+
+		err := os.WriteFile(path, []byte(test.content), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		initTest(t, map[string]string{
+			"targets_file": path,
+			"scheme": "https",
+			"metrics_path": "/probe",
+		})
+
+		urls := []string{}
+
+		for _, target := range GlobalTargets {
+			urls = append(urls, target.Url)
+
+			if !reflect.DeepEqual(target.Labels, test.labels) {
+				t.Errorf("%s: got labels %v, want %v", target.Url, target.Labels, test.labels)
+			}
+		}
+
+		if !reflect.DeepEqual(urls, test.want) {
+			t.Errorf("%q: got %v, want %v", test.content, urls, test.want)
+		}
+	}
+}
+
+//Get the scrape status of the url
+func getStatus(proto *protocol.Proto, url string) *protocol.Data {
+	for index := range proto.DataList {
+		data := &proto.DataList[index]
+
+		_, ok := data.Field["up"]
+
+		if ok && data.Tag["url"] == url {
+			return data
+		}
+	}
+
+	return nil
+}
+
+func TestCollect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(GlobalExposition))
+	}))
+	defer server.Close()
+
+	//Address nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := "http://" + listener.Addr().String() + "/metrics"
+	listener.Close()
+
+	//Labels of the target conflicting with the tags are exported like the labels of samples
+	path := filepath.Join(t.TempDir(), "targets.json")
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	err = os.WriteFile(path, []byte(`[{"targets":["` + address + `"],"labels":{"job":"node","instance":"web1","measurement":"app","type":"service"}}]`), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initTest(t, map[string]string{
+		"urls": closed,
+		"targets_file": path,
+		"mapping": "measurement",
+		"timeout": "2",
+	})
+
+	proto, err := Collect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url string
+		fields map[string]interface{}
+	}{
+		{closed, map[string]interface{}{"up": float64(0)}},
+		{server.URL + "/metrics", map[string]interface{}{"up": float64(1), "scrape_samples": float64(13), "parse_errors": float64(1)}},
+	}
+
+	for _, test := range tests {
+		status := getStatus(proto, test.url)
+
+		if status == nil {
+			t.Errorf("%s: not reported", test.url)
+			continue
+		}
+
+		for key, value := range test.fields {
+			if status.Field[key] != value {
+				t.Errorf("%s: field %s got %v, want %v", test.url, key, status.Field[key], value)
+			}
+		}
+
+		//All values are floats in one measurement
+		for key, value := range status.Field {
+			_, ok := value.(float64)
+
+			if !ok {
+				t.Errorf("%s: field %s got %T, want float64", test.url, key, value)
+			}
+		}
+	}
+
+	tags := map[string]interface{}{"job": "node", "exported_instance": "web1", "exported_measurement": "app", "exported_type": "service", "url": server.URL + "/metrics"}
+
+	status := getStatus(proto, server.URL + "/metrics")
+	data := getMeasurement(proto.DataList, "jobs", "", "")
+
+	for _, tagged := range []*protocol.Data{status, data} {
+		if tagged == nil {
+			t.Errorf("not reported")
+			continue
+		}
+
+		for key, value := range tags {
+			if tagged.Tag[key] != value {
+				t.Errorf("tag %s got %v, want %v", key, tagged.Tag[key], value)
+			}
+		}
+
+		_, ok := tagged.Tag["instance"]
+
+		if ok {
+			t.Errorf("instance should not be tagged, got %+v", tagged.Tag)
+		}
+	}
+
+	//The measurement and type of the samples are not overwritten
+	if data != nil && (data.Tag["measurement"] != "jobs" || data.Tag["type"] != "counter") {
+		t.Errorf("got %+v", data.Tag)
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import(
+	"io"
+	"net"
+	"sync"
+	"time"
+	"bufio"
+	"errors"
+	"strings"
+	"strconv"
+	"net/url"
+
+	"github.com/DarkMetrix/monitor/agent/src/config"
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+
+	log "github.com/cihub/seelog"
+)
+
+var GlobalNodeInfo config.NodeInfo
+var GlobalConfig map[string]string
+
+//Redis server to collect
+type Server struct {
+	Address string                //Address to tag, password is not included
+	Network string                //"tcp" or "unix"
+	Addr string                   //Address to dial
+	User string                   //User of redis 6 ACL, empty for the default user
+	Password string               //Password, empty if no AUTH
+
+	lastHits float64              //Keyspace hits and misses of last collect, used to calculate hit ratio
+	lastMisses float64
+	hasLast bool
+}
+
+var GlobalServers []*Server
+var GlobalTimeout time.Duration
+
+//INFO fields to report
+var GlobalFields []string
+
+const DefaultFields = "uptime_in_seconds;connected_clients;blocked_clients;rejected_connections;used_memory;used_memory_rss;used_memory_peak;maxmemory;mem_fragmentation_ratio;instantaneous_ops_per_sec;total_commands_processed;keyspace_hits;keyspace_misses;evicted_keys;expired_keys;total_net_input_bytes;total_net_output_bytes;rdb_changes_since_last_save;rdb_last_bgsave_status;aof_last_bgrewrite_status;used_cpu_sys;used_cpu_user;connected_slaves;master_repl_offset;slave_repl_offset;master_link_status;master_last_io_seconds_ago;master_sync_in_progress"
+
+func Init(nodeInfo config.NodeInfo, config map[string]string) error {
+	servers, ok := config["servers"]
+
+	if !ok {
+		servers = "tcp://127.0.0.1:6379"
+	}
+
+	GlobalServers = []*Server{}
+
+	for _, address := range strings.Split(servers, ";") {
+		if len(address) == 0 {
+			continue
+		}
+
+		server, err := parseServer(address, config["password"])
+
+		if err != nil {
+			return err
+		}
+
+		GlobalServers = append(GlobalServers, server)
+	}
+
+	if len(GlobalServers) == 0 {
+		return errors.New("No server is configured!")
+	}
+
+	timeout := 5
+
+	_, ok = config["timeout"]
+
+	if ok {
+		var err error
+
+		timeout, err = strconv.Atoi(config["timeout"])
+
+		if err != nil {
+			return errors.New("Parse timeout failed! error:" + err.Error())
+		}
+	}
+
+	GlobalTimeout = time.Duration(timeout) * time.Second
+
+	fields, ok := config["fields"]
+
+	if !ok {
+		fields = DefaultFields
+	}
+
+	GlobalFields = []string{}
+
+	for _, field := range strings.Split(fields, ";") {
+		if len(field) == 0 {
+			continue
+		}
+
+		GlobalFields = append(GlobalFields, field)
+	}
+
+	GlobalConfig = make(map[string]string)
+	GlobalConfig = config
+	GlobalNodeInfo = nodeInfo
+
+	return nil
+}
+
+//Parse server address, e.g.:"tcp://:password@127.0.0.1:6379", "unix:///var/run/redis.sock" or "127.0.0.1:6379"
+func parseServer(address string, password string) (*Server, error) {
+	if !strings.Contains(address, "://") {
+		address = "tcp://" + address
+	}
+
+	serverUrl, err := url.Parse(address)
+
+	if err != nil {
+		return nil, errors.New("Parse server '" + address + "' failed! error:" + err.Error())
+	}
+
+	server := &Server{
+		Password: password,
+	}
+
+	switch serverUrl.Scheme {
+	case "tcp":
+		server.Network = "tcp"
+		server.Addr = serverUrl.Host
+		server.Address = serverUrl.Host
+	case "unix":
+		server.Network = "unix"
+		server.Addr = serverUrl.Path
+		server.Address = serverUrl.Path
+	default:
+		return nil, errors.New("Server '" + address + "' invalid! should be tcp:// or unix://")
+	}
+
+	if len(server.Addr) == 0 {
+		return nil, errors.New("Server '" + address + "' invalid! address is empty")
+	}
+
+	if serverUrl.User != nil {
+		server.User = serverUrl.User.Username()
+
+		userPassword, ok := serverUrl.User.Password()
+
+		if ok {
+			server.Password = userPassword
+		}
+	}
+
+	return server, nil
+}
+
+//Send a command in RESP and read the reply, only simple string, error and bulk string replies are supported
+func command(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	request := "*" + strconv.Itoa(len(args)) + "\r\n"
+
+	for _, arg := range args {
+		request += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+
+	_, err := conn.Write([]byte(request))
+
+	if err != nil {
+		return "", err
+	}
+
+	line, err := reader.ReadString('\n')
+
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+
+	if len(line) == 0 {
+		return "", errors.New("Empty reply!")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", errors.New(line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+
+		if err != nil {
+			return "", errors.New("Parse bulk length failed! error:" + err.Error())
+		}
+
+		if length < 0 {
+			return "", nil
+		}
+
+		buffer := make([]byte, length + 2)
+
+		_, err = io.ReadFull(reader, buffer)
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(buffer[:length]), nil
+	}
+
+	return "", errors.New("Unsupported reply '" + line + "'")
+}
+
+//Get INFO ALL of the server
+func getInfo(server *Server) (string, error) {
+	conn, err := net.DialTimeout(server.Network, server.Addr, GlobalTimeout)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(GlobalTimeout))
+
+	reader := bufio.NewReader(conn)
+
+	if len(server.Password) != 0 {
+		args := []string{"AUTH", server.Password}
+
+		if len(server.User) != 0 {
+			args = []string{"AUTH", server.User, server.Password}
+		}
+
+		_, err = command(conn, reader, args...)
+
+		if err != nil {
+			return "", errors.New("AUTH failed! error:" + err.Error())
+		}
+	}
+
+	return command(conn, reader, "INFO", "ALL")
+}
+
+//Parse INFO into 'key:value' map, sections are not kept
+func parseInfo(info string) map[string]string {
+	values := make(map[string]string)
+
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pair := strings.SplitN(line, ":", 2)
+
+		if len(pair) != 2 {
+			continue
+		}
+
+		values[pair[0]] = pair[1]
+	}
+
+	return values
+}
+
+//Parse 'key=value,key=value' of keyspace and replica lines
+func parseSubValues(value string) map[string]string {
+	values := make(map[string]string)
+
+	for _, item := range strings.Split(value, ",") {
+		pair := strings.SplitN(item, "=", 2)
+
+		if len(pair) != 2 {
+			continue
+		}
+
+		values[pair[0]] = pair[1]
+	}
+
+	return values
+}
+
+//Convert value to number, status strings such as "ok" and "up" are converted to 1, others to 0
+func parseValue(value string) (float64, bool) {
+	switch value {
+	case "ok", "up":
+		return 1, true
+	case "err", "down":
+		return 0, true
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return number, true
+}
+
+//Create data with common tags
+func newData(currentTime string, server *Server) *protocol.Data {
+	data := protocol.NewData()
+	data.Time = currentTime
+
+	data.Tag["node_name"] = GlobalNodeInfo.Name
+	data.Tag["node_ip"] = GlobalNodeInfo.IP
+	data.Tag["server"] = server.Address
+
+	return data
+}
+
+//Collect a server, a server could not be connected is reported with up:0
+func collectServer(currentTime string, server *Server) []protocol.Data {
+	data := newData(currentTime, server)
+
+	info, err := getInfo(server)
+
+	if err != nil {
+		log.Warnf("Get info of %s failed! error:%s", server.Address, err)
+
+		data.Field["up"] = float64(0)
+
+		server.hasLast = false
+
+		return []protocol.Data{*data}
+	}
+
+	values := parseInfo(info)
+
+	data.Tag["role"] = values["role"]
+	data.Tag["version"] = values["redis_version"]
+	//All values are floats like the INFO fields, so the types are not mixed in one measurement
+	data.Field["up"] = float64(1)
+
+	for _, field := range GlobalFields {
+		value, ok := parseValue(values[field])
+
+		if ok {
+			data.Field[field] = value
+		}
+	}
+
+	//Hit ratio since last collect
+	hits, _ := parseValue(values["keyspace_hits"])
+	misses, _ := parseValue(values["keyspace_misses"])
+
+	if server.hasLast && hits >= server.lastHits && misses >= server.lastMisses && hits + misses > server.lastHits + server.lastMisses {
+		data.Field["hit_ratio"] = (hits - server.lastHits) / (hits + misses - server.lastHits - server.lastMisses) * 100
+	}
+
+	server.lastHits = hits
+	server.lastMisses = misses
+	server.hasLast = true
+
+	datas := []protocol.Data{*data}
+
+	masterOffset, _ := parseValue(values["master_repl_offset"])
+
+	for key, value := range values {
+		switch {
+		//Keyspace, e.g.:"db0:keys=1,expires=0,avg_ttl=0"
+		case strings.HasPrefix(key, "db") && strings.Contains(value, "keys="):
+			dbData := newData(currentTime, server)
+			dbData.Tag["db"] = key
+
+			for name, subValue := range parseSubValues(value) {
+				number, ok := parseValue(subValue)
+
+				if ok {
+					dbData.Field[name] = number
+				}
+			}
+
+			datas = append(datas, *dbData)
+		//Replicas of master, e.g.:"slave0:ip=10.0.0.2,port=6379,state=online,offset=1000,lag=0"
+		case strings.HasPrefix(key, "slave") && strings.Contains(value, "offset="):
+			subValues := parseSubValues(value)
+
+			replicaData := newData(currentTime, server)
+			replicaData.Tag["replica"] = subValues["ip"] + ":" + subValues["port"]
+			replicaData.Tag["state"] = subValues["state"]
+
+			offset, ok := parseValue(subValues["offset"])
+
+			if ok {
+				replicaData.Field["offset"] = offset
+				replicaData.Field["offset_lag"] = masterOffset - offset
+			}
+
+			lag, ok := parseValue(subValues["lag"])
+
+			if ok {
+				replicaData.Field["lag"] = lag
+			}
+
+			datas = append(datas, *replicaData)
+		}
+	}
+
+	return datas
+}
+
+func Collect()(*protocol.Proto, error) {
+	proto := protocol.NewProto(1)
+
+	curTime := time.Now()
+	currentTime := curTime.Local().Format("2006-01-02 15:04:05")
+
+	results := make([][]protocol.Data, len(GlobalServers))
+
+	var wait sync.WaitGroup
+
+	//Servers are collected concurrently, a slow server does not delay the others
+	for index, server := range GlobalServers {
+		wait.Add(1)
+
+		go func(index int, server *Server) {
+			defer wait.Done()
+
+			results[index] = collectServer(currentTime, server)
+		}(index, server)
+	}
+
+	wait.Wait()
+
+	for _, datas := range results {
+		proto.DataList = append(proto.DataList, datas...)
+	}
+
+	return proto, nil
+}
@@ -73,7 +73,7 @@ func Send(proto *protocol.Proto) error {
 			tags["instance"] = key
 			field := map[string]interface{}{"value":value}
 
-			point, err := client.NewPoint(proto.Name, tags, field, time.Now())
+			point, err := client.NewPoint(proto.Measurement(&data), tags, field, time.Now())
 
 			if err != nil {
 				continue
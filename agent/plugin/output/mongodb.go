@@ -51,9 +51,9 @@ func Init(nodeInfo config.NodeInfo, config map[string]string) error {
 }
 
 func Send(proto *protocol.Proto) error {
-	collection := GlobalMongoDB.C(proto.Name)
-
 	for _, data := range proto.DataList {
+		collection := GlobalMongoDB.C(proto.Measurement(&data))
+
 		//_, err := collection.Upsert(
 		//	bson.M{"node":GlobalNodeInfo.Name, "ip":GlobalNodeInfo.IP},
 		//	bson.M{"node":GlobalNodeInfo.Name, "ip":GlobalNodeInfo.IP, "info":data})
@@ -1,6 +1,10 @@
 package config
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+
 	"github.com/spf13/viper"
 )
 
@@ -16,6 +20,7 @@ type NodeInfo struct {
 	Name string `mapstructure:"name" json:"name"`
 	IP string `mapstructure:"ip" json:"ip"`
 	TransferQueue TransferQueueInfo `mapstructure:"transfer_queue" json:"transfer_queue"`
+	ConfigHash string `mapstructure:"config_hash" json:"config_hash"`
 }
 
 //Input plugin information
@@ -85,5 +90,15 @@ func (config *Config) Init (path string) error {
 		return err
 	}
 
+	//Hash config file, so the config version of each node could be told
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	hash := md5.Sum(content)
+	config.Node.ConfigHash = hex.EncodeToString(hash[:])
+
 	return nil
 }
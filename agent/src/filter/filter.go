@@ -0,0 +1,109 @@
+package filter
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+//Regex include and exclude filter, patterns in config are separated by ';'
+type Filter struct {
+	includes []*regexp.Regexp   //Include patterns, empty means all names are included
+	excludes []*regexp.Regexp   //Exclude patterns
+}
+
+func NewFilter(include string, exclude string) (*Filter, error) {
+	includes, err := compile(include)
+
+	if err != nil {
+		return nil, err
+	}
+
+	excludes, err := compile(exclude)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Filter{
+		includes: includes,
+		excludes: excludes,
+	}, nil
+}
+
+//Filter with each pattern anchored to match the whole name, e.g.:"eth0" does not match "veth0abc"
+func NewAnchoredFilter(include string, exclude string) (*Filter, error) {
+	return NewFilter(anchor(include), anchor(exclude))
+}
+
+//Anchor patterns separated by ';' to match the whole name
+func anchor(patterns string) string {
+	anchored := []string{}
+
+	for _, pattern := range strings.Split(patterns, ";") {
+		if len(pattern) == 0 {
+			continue
+		}
+
+		anchored = append(anchored, "^(?:" + pattern + ")$")
+	}
+
+	return strings.Join(anchored, ";")
+}
+
+//Compile patterns separated by ';'
+func compile(patterns string) ([]*regexp.Regexp, error) {
+	regexps := []*regexp.Regexp{}
+
+	for _, pattern := range strings.Split(patterns, ";") {
+		if len(pattern) == 0 {
+			continue
+		}
+
+		compiled, err := regexp.Compile(pattern)
+
+		if err != nil {
+			return nil, errors.New("Compile pattern '" + pattern + "' failed! error:" + err.Error())
+		}
+
+		regexps = append(regexps, compiled)
+	}
+
+	return regexps, nil
+}
+
+//Has include patterns or not
+func (filter *Filter) HasIncludes() bool {
+	return len(filter.includes) != 0
+}
+
+//Is the name included, true if no include pattern
+func (filter *Filter) Included(name string) bool {
+	if len(filter.includes) == 0 {
+		return true
+	}
+
+	for _, include := range filter.includes {
+		if include.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Is the name excluded
+func (filter *Filter) Excluded(name string) bool {
+	for _, exclude := range filter.excludes {
+		if exclude.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Is the name included and not excluded
+func (filter *Filter) Match(name string) bool {
+	return filter.Included(name) && !filter.Excluded(name)
+}
@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	names := []string{"lo", "eth0", "eth1", "veth0abc", "bond0"}
+
+	tests := []struct {
+		include string
+		exclude string
+		anchored bool
+		want string
+	}{
+		{"", "", false, "lo;eth0;eth1;veth0abc;bond0"},
+		{"eth0", "", false, "eth0;veth0abc"},
+		{"", "^veth", false, "lo;eth0;eth1;bond0"},
+		//Anchored patterns match the whole name
+		{"eth0", "", true, "eth0"},
+		{"eth[0-9]+;bond.*", "eth1", true, "eth0;bond0"},
+		{"", "veth", true, "lo;eth0;eth1;veth0abc;bond0"},
+		{"", "veth.*;lo", true, "eth0;eth1;bond0"},
+	}
+
+	for _, test := range tests {
+		var filter *Filter
+		var err error
+
+		if test.anchored {
+			filter, err = NewAnchoredFilter(test.include, test.exclude)
+		} else {
+			filter, err = NewFilter(test.include, test.exclude)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matched := []string{}
+
+		for _, name := range names {
+			if filter.Match(name) {
+				matched = append(matched, name)
+			}
+		}
+
+		got := strings.Join(matched, ";")
+
+		if got != test.want {
+			t.Errorf("include %q exclude %q anchored %v: got %s, want %s", test.include, test.exclude, test.anchored, got, test.want)
+		}
+	}
+
+	_, err := NewAnchoredFilter("eth(", "")
+
+	if err == nil {
+		t.Errorf("invalid pattern should fail")
+	}
+}
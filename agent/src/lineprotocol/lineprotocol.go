@@ -0,0 +1,189 @@
+package lineprotocol
+
+import (
+	"math"
+	"time"
+	"errors"
+	"strings"
+	"strconv"
+
+	"github.com/DarkMetrix/monitor/agent/src/protocol"
+)
+
+//Point of influxdb line protocol, e.g.:'cpu,host=a usage=0.5,count=3i 1465839830100400200'
+type Point struct {
+	Measurement string
+	Tags map[string]string
+	Fields map[string]interface{}
+	Time time.Time              //Zero if no timestamp
+}
+
+//Parse a line, precision is the unit of the timestamp, e.g.:time.Nanosecond
+func ParseLine(line string, precision time.Duration) (*Point, error) {
+	sections := split(strings.TrimSpace(line), ' ', true)
+
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, errors.New("Line should be 'measurement[,tag=value...] field=value[,field=value...] [timestamp]'")
+	}
+
+	point := &Point{
+		Tags: make(map[string]string),
+		Fields: make(map[string]interface{}),
+	}
+
+	keys := split(sections[0], ',', false)
+
+	point.Measurement = unescape(keys[0])
+
+	if len(point.Measurement) == 0 {
+		return nil, errors.New("Measurement is empty!")
+	}
+
+	for _, tag := range keys[1:] {
+		pair := split(tag, '=', false)
+
+		if len(pair) != 2 || len(pair[0]) == 0 || len(pair[1]) == 0 {
+			return nil, errors.New("Tag '" + tag + "' invalid!")
+		}
+
+		point.Tags[unescape(pair[0])] = unescape(pair[1])
+	}
+
+	for _, field := range split(sections[1], ',', true) {
+		pair := split(field, '=', true)
+
+		if len(pair) != 2 || len(pair[0]) == 0 {
+			return nil, errors.New("Field '" + field + "' invalid!")
+		}
+
+		value, err := parseValue(pair[1])
+
+		if err != nil {
+			return nil, errors.New("Field '" + field + "' invalid! error:" + err.Error())
+		}
+
+		point.Fields[unescape(pair[0])] = value
+	}
+
+	if len(sections) == 3 {
+		timestamp, err := strconv.ParseInt(sections[2], 10, 64)
+
+		if err != nil {
+			return nil, errors.New("Timestamp '" + sections[2] + "' invalid!")
+		}
+
+		point.Time = time.Unix(0, timestamp * int64(precision))
+	}
+
+	return point, nil
+}
+
+//Parse field value, integers end with 'i', unsigned integers end with 'u', strings are quoted
+func parseValue(value string) (interface{}, error) {
+	if len(value) == 0 {
+		return nil, errors.New("Value is empty!")
+	}
+
+	switch {
+	case value[0] == '"':
+		if len(value) < 2 || value[len(value) - 1] != '"' {
+			return nil, errors.New("String is not closed!")
+		}
+
+		return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1:len(value) - 1]), nil
+	case strings.HasSuffix(value, "i"):
+		return strconv.ParseInt(value[:len(value) - 1], 10, 64)
+	case strings.HasSuffix(value, "u"):
+		return strconv.ParseUint(value[:len(value) - 1], 10, 64)
+	}
+
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	//NaN and Inf are not valid in line protocol and could not be stored
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return nil, errors.New("Float '" + value + "' is not a number!")
+	}
+
+	return number, nil
+}
+
+//Split by separator not escaped by '\', and not in quoted strings if quotes is true
+func split(text string, separator byte, quotes bool) []string {
+	parts := []string{}
+
+	start := 0
+	quoted := false
+
+	for index := 0; index < len(text); index++ {
+		switch {
+		case text[index] == '\\':
+			index++
+		case text[index] == '"' && quotes:
+			quoted = !quoted
+		case text[index] == separator && !quoted:
+			//Spaces between sections may be repeated
+			if separator == ' ' && index == start {
+				start = index + 1
+				continue
+			}
+
+			parts = append(parts, text[start:index])
+			start = index + 1
+		}
+	}
+
+	if start < len(text) || separator != ' ' {
+		parts = append(parts, text[start:])
+	}
+
+	return parts
+}
+
+//Remove '\' before escaped characters of measurement, tag and field keys and tag values
+func unescape(text string) string {
+	if !strings.Contains(text, "\\") {
+		return text
+	}
+
+	return strings.NewReplacer(`\,`, `,`, `\=`, `=`, `\ `, ` `, `\"`, `"`, `\\`, `\`).Replace(text)
+}
+
+//Convert to data, the measurement is tagged by 'measurement' and the tag named 'measurement' is tagged by 'exported_measurement'
+func (point *Point) Data() *protocol.Data {
+	data := protocol.NewData()
+
+	curTime := point.Time
+
+	if curTime.IsZero() {
+		curTime = time.Now()
+	}
+
+	data.Time = curTime.Local().Format("2006-01-02 15:04:05")
+	data.Tag["measurement"] = point.Measurement
+
+	//Tag named 'measurement' is renamed so the measurement is not overwritten
+	for key, value := range point.Tags {
+		if key == "measurement" {
+			key = "exported_measurement"
+		}
+
+		data.Tag[key] = value
+	}
+
+	for key, value := range point.Fields {
+		data.Field[key] = value
+	}
+
+	return data
+}
@@ -0,0 +1,122 @@
+package lineprotocol
+
+import (
+	"time"
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		precision time.Duration
+		want *Point
+	}{
+		{`cpu usage=0.5`, time.Nanosecond, &Point{
+			Measurement: "cpu",
+			Tags: map[string]string{},
+			Fields: map[string]interface{}{"usage": 0.5},
+		}},
+		{`cpu,host=a,region=us usage=0.5,count=3i,total=18446744073709551615u,up=t,down=FALSE 1465839830100400200`, time.Nanosecond, &Point{
+			Measurement: "cpu",
+			Tags: map[string]string{"host": "a", "region": "us"},
+			Fields: map[string]interface{}{"usage": 0.5, "count": int64(3), "total": uint64(18446744073709551615), "up": true, "down": false},
+			Time: time.Unix(0, 1465839830100400200),
+		}},
+		//Escaped commas, spaces and equal signs in measurement, tag keys, tag values and field keys
+		{`disk\ io,path=C:\\dir,dev\,name=sd\ a\=1 read\ bytes=1i`, time.Nanosecond, &Point{
+			Measurement: "disk io",
+			Tags: map[string]string{"path": `C:\dir`, "dev,name": "sd a=1"},
+			Fields: map[string]interface{}{"read bytes": int64(1)},
+		}},
+		//Spaces, commas and escaped quotes in quoted strings
+		{`log,level=info message="disk full, retry later",quote="say \"hi\"",path="C:\\tmp" 1700000000`, time.Second, &Point{
+			Measurement: "log",
+			Tags: map[string]string{"level": "info"},
+			Fields: map[string]interface{}{"message": "disk full, retry later", "quote": `say "hi"`, "path": `C:\tmp`},
+			Time: time.Unix(1700000000, 0),
+		}},
+		{`mem free=-12i,used=1e3   1700000000000`, time.Millisecond, &Point{
+			Measurement: "mem",
+			Tags: map[string]string{},
+			Fields: map[string]interface{}{"free": int64(-12), "used": float64(1000)},
+			Time: time.Unix(1700000000, 0),
+		}},
+		{`empty text="" 1700000000000000`, time.Microsecond, &Point{
+			Measurement: "empty",
+			Tags: map[string]string{},
+			Fields: map[string]interface{}{"text": ""},
+			Time: time.Unix(1700000000, 0),
+		}},
+	}
+
+	for _, test := range tests {
+		point, err := ParseLine(test.line, test.precision)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.line, err)
+			continue
+		}
+
+		if !point.Time.Equal(test.want.Time) {
+			t.Errorf("%s: got time %v, want %v", test.line, point.Time, test.want.Time)
+		}
+
+		point.Time = test.want.Time
+
+		if !reflect.DeepEqual(point, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.line, point, test.want)
+		}
+	}
+}
+
+func TestParseLineInvalid(t *testing.T) {
+	invalids := []string{
+		`cpu`,
+		`,host=a usage=1`,
+		`cpu,host usage=1`,
+		`cpu,host= usage=1`,
+		`cpu usage`,
+		`cpu =1`,
+		`cpu usage=abc`,
+		`cpu usage=1.5i`,
+		`cpu usage=-1u`,
+		`cpu message="not closed`,
+		`cpu usage=1 abc`,
+		`cpu usage=1 1 1`,
+		//NaN and Inf are not valid floats
+		`cpu usage=NaN`,
+		`cpu usage=Inf`,
+		`cpu usage=-inf`,
+		`cpu usage=+Infinity`,
+	}
+
+	for _, line := range invalids {
+		_, err := ParseLine(line, time.Nanosecond)
+
+		if err == nil {
+			t.Errorf("%s: should fail", line)
+		}
+	}
+}
+
+func TestData(t *testing.T) {
+	point, err := ParseLine(`cpu,host=a,measurement=b usage=0.5 1700000000`, time.Second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := point.Data()
+
+	//Tag named 'measurement' does not overwrite the measurement
+	tags := map[string]interface{}{"measurement": "cpu", "exported_measurement": "b", "host": "a"}
+
+	if !reflect.DeepEqual(data.Tag, tags) || !reflect.DeepEqual(data.Field, map[string]interface{}{"usage": 0.5}) {
+		t.Errorf("got %+v, want tags %+v", data, tags)
+	}
+
+	if data.Time != time.Unix(1700000000, 0).Local().Format("2006-01-02 15:04:05") {
+		t.Errorf("got time %s", data.Time)
+	}
+}
@@ -0,0 +1,284 @@
+package procfs
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"path/filepath"
+)
+
+//Resource usage of a cgroup, read from either cgroup v1 or v2 and converted to the v2 units
+type CgroupStat struct {
+	Path string
+	CPUUsage uint64           //Total cpu time in microseconds
+	CPUUser uint64            //User cpu time in microseconds
+	CPUSystem uint64          //System cpu time in microseconds
+	NrPeriods uint64          //Enforcement periods elapsed
+	NrThrottled uint64        //Enforcement periods throttled
+	ThrottledTime uint64      //Time throttled in microseconds
+	MemoryCurrent uint64      //Memory usage in bytes
+	MemoryMax uint64          //Memory limit in bytes, 0 means no limit
+	MemoryEvents map[string]uint64      //Memory events, e.g.:oom, oom_kill
+	IOReadBytes uint64        //Bytes read of all devices
+	IOWriteBytes uint64       //Bytes written of all devices
+	IOReads uint64            //Read operations of all devices
+	IOWrites uint64           //Write operations of all devices
+}
+
+//Is the cgroup hierarchy unified(cgroup v2) or not
+func (fs *FS) CgroupUnified() bool {
+	_, err := os.Stat(fs.Path("sys", "fs", "cgroup", "cgroup.controllers"))
+
+	return err == nil
+}
+
+//List cgroup paths matching the glob pattern, e.g.:"/docker/*"
+func (fs *FS) CgroupGlob(pattern string) ([]string, error) {
+	base := fs.cgroupBase("memory")
+
+	matches, err := filepath.Glob(filepath.Join(base, pattern))
+
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+
+	for _, match := range matches {
+		info, err := os.Stat(match)
+
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		paths = append(paths, "/" + strings.TrimPrefix(strings.TrimPrefix(match, base), "/"))
+	}
+
+	return paths, nil
+}
+
+//List cgroup paths of all systemd slices and services
+func (fs *FS) CgroupSystemdUnits() ([]string, error) {
+	base := fs.cgroupBase("systemd")
+
+	paths := []string{}
+
+	err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			//Cgroups may be removed while walking
+			return nil
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(info.Name(), ".slice") || strings.HasSuffix(info.Name(), ".service") {
+			paths = append(paths, "/" + strings.TrimPrefix(strings.TrimPrefix(path, base), "/"))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+//Get the directory of the controller's hierarchy, all controllers are in one hierarchy in cgroup v2
+func (fs *FS) cgroupBase(controller string) string {
+	if fs.CgroupUnified() {
+		return fs.Path("sys", "fs", "cgroup")
+	}
+
+	return fs.Path("sys", "fs", "cgroup", controller)
+}
+
+//Read resource usage of the cgroup path, e.g.:"/system.slice/docker.service"
+func (fs *FS) CgroupStat(path string) (*CgroupStat, error) {
+	stat := &CgroupStat{
+		Path: path,
+		MemoryEvents: make(map[string]uint64),
+	}
+
+	if fs.CgroupUnified() {
+		dir := filepath.Join("sys", "fs", "cgroup", path)
+
+		_, err := os.Stat(fs.Path(dir))
+
+		if err != nil {
+			return nil, err
+		}
+
+		fs.readCgroupV2(dir, stat)
+
+		return stat, nil
+	}
+
+	//A cgroup may not exist in all controllers' hierarchies in cgroup v1
+	var err error
+
+	for _, controller := range []string{"cpuacct", "memory", "blkio"} {
+		_, err = os.Stat(fs.Path("sys", "fs", "cgroup", controller, path))
+
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	fs.readCgroupV1(path, stat)
+
+	return stat, nil
+}
+
+//Read cgroup v2 files, files of disabled controllers are skipped
+func (fs *FS) readCgroupV2(dir string, stat *CgroupStat) {
+	cpuStat := readKeyValues(fs, dir, "cpu.stat")
+
+	stat.CPUUsage = cpuStat["usage_usec"]
+	stat.CPUUser = cpuStat["user_usec"]
+	stat.CPUSystem = cpuStat["system_usec"]
+	stat.NrPeriods = cpuStat["nr_periods"]
+	stat.NrThrottled = cpuStat["nr_throttled"]
+	stat.ThrottledTime = cpuStat["throttled_usec"]
+
+	stat.MemoryCurrent, _ = fs.ReadUint(dir, "memory.current")
+	stat.MemoryMax, _ = fs.ReadUint(dir, "memory.max")
+	stat.MemoryEvents = readKeyValues(fs, dir, "memory.events")
+
+	//Format is '8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0'
+	lines, _ := fs.ReadLines(dir, "io.stat")
+
+	for _, line := range lines {
+		for _, field := range strings.Fields(line)[1:] {
+			pair := strings.SplitN(field, "=", 2)
+
+			if len(pair) != 2 {
+				continue
+			}
+
+			value, err := strconv.ParseUint(pair[1], 10, 64)
+
+			if err != nil {
+				continue
+			}
+
+			switch pair[0] {
+			case "rbytes":
+				stat.IOReadBytes += value
+			case "wbytes":
+				stat.IOWriteBytes += value
+			case "rios":
+				stat.IOReads += value
+			case "wios":
+				stat.IOWrites += value
+			}
+		}
+	}
+}
+
+//Read cgroup v1 files of cpu, cpuacct, memory and blkio controllers
+func (fs *FS) readCgroupV1(path string, stat *CgroupStat) {
+	cpuacct := filepath.Join("sys", "fs", "cgroup", "cpuacct", path)
+
+	usage, err := fs.ReadUint(cpuacct, "cpuacct.usage")
+
+	if err == nil {
+		stat.CPUUsage = usage / 1000
+	}
+
+	//User and system time are in clock ticks
+	cpuacctStat := readKeyValues(fs, cpuacct, "cpuacct.stat")
+
+	stat.CPUUser = cpuacctStat["user"] * 1000000 / ClockTicks
+	stat.CPUSystem = cpuacctStat["system"] * 1000000 / ClockTicks
+
+	cpuStat := readKeyValues(fs, filepath.Join("sys", "fs", "cgroup", "cpu", path), "cpu.stat")
+
+	stat.NrPeriods = cpuStat["nr_periods"]
+	stat.NrThrottled = cpuStat["nr_throttled"]
+	stat.ThrottledTime = cpuStat["throttled_time"] / 1000
+
+	memory := filepath.Join("sys", "fs", "cgroup", "memory", path)
+
+	stat.MemoryCurrent, _ = fs.ReadUint(memory, "memory.usage_in_bytes")
+
+	//No limit is a huge number rounded down to the page size
+	limit, err := fs.ReadUint(memory, "memory.limit_in_bytes")
+
+	if err == nil && limit < 1 << 62 {
+		stat.MemoryMax = limit
+	}
+
+	oomControl := readKeyValues(fs, memory, "memory.oom_control")
+
+	stat.MemoryEvents["oom_kill"] = oomControl["oom_kill"]
+	stat.MemoryEvents["max"], _ = fs.ReadUint(memory, "memory.failcnt")
+
+	//Format is '8:0 Read 1459200', the last line is 'Total 1459200'
+	blkio := filepath.Join("sys", "fs", "cgroup", "blkio", path)
+
+	for _, file := range []string{"blkio.throttle.io_service_bytes", "blkio.throttle.io_serviced"} {
+		lines, _ := fs.ReadLines(blkio, file)
+
+		for _, line := range lines {
+			fields := strings.Fields(line)
+
+			if len(fields) != 3 {
+				continue
+			}
+
+			value, err := strconv.ParseUint(fields[2], 10, 64)
+
+			if err != nil {
+				continue
+			}
+
+			switch {
+			case file == "blkio.throttle.io_service_bytes" && fields[1] == "Read":
+				stat.IOReadBytes += value
+			case file == "blkio.throttle.io_service_bytes" && fields[1] == "Write":
+				stat.IOWriteBytes += value
+			case file == "blkio.throttle.io_serviced" && fields[1] == "Read":
+				stat.IOReads += value
+			case file == "blkio.throttle.io_serviced" && fields[1] == "Write":
+				stat.IOWrites += value
+			}
+		}
+	}
+}
+
+//Read 'key value' lines of the file under dir relative to the root path, empty if the file could not be read
+func readKeyValues(fs *FS, dir string, file string) map[string]uint64 {
+	values := make(map[string]uint64)
+
+	lines, err := fs.ReadLines(dir, file)
+
+	if err != nil {
+		return values
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		values[fields[0]] = value
+	}
+
+	return values
+}
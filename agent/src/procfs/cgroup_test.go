@@ -0,0 +1,136 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+//Fixtures of a unified hierarchy, docker.service has all controllers enabled and nginx.service has cpu and memory only
+var GlobalCgroupV2FS = NewFS("testdata/cgroupv2")
+
+//Fixtures of controller hierarchies, /docker/def456 is only in the memory hierarchy
+var GlobalCgroupV1FS = NewFS("testdata/cgroupv1")
+
+func TestCgroupUnified(t *testing.T) {
+	if !GlobalCgroupV2FS.CgroupUnified() {
+		t.Errorf("cgroup v2 should be unified")
+	}
+
+	if GlobalCgroupV1FS.CgroupUnified() {
+		t.Errorf("cgroup v1 should not be unified")
+	}
+}
+
+func TestCgroupPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		fs *FS
+		pattern string
+		want []string
+	}{
+		{"v2_glob", GlobalCgroupV2FS, "/system.slice/*.service", []string{"/system.slice/docker.service", "/system.slice/nginx.service"}},
+		//Files are skipped
+		{"v2_glob_dirs", GlobalCgroupV2FS, "/*", []string{"/init.scope", "/system.slice", "/user.slice"}},
+		{"v2_systemd", GlobalCgroupV2FS, "", []string{"/system.slice", "/system.slice/docker.service", "/system.slice/nginx.service", "/user.slice", "/user.slice/user-1000.slice"}},
+		//Globs are expanded in the memory hierarchy and units are listed in the systemd hierarchy
+		{"v1_glob", GlobalCgroupV1FS, "/docker/*", []string{"/docker/abc123", "/docker/def456"}},
+		{"v1_systemd", GlobalCgroupV1FS, "", []string{"/system.slice", "/system.slice/sshd.service", "/user.slice"}},
+	}
+
+	for _, test := range tests {
+		var paths []string
+		var err error
+
+		if len(test.pattern) == 0 {
+			paths, err = test.fs.CgroupSystemdUnits()
+		} else {
+			paths, err = test.fs.CgroupGlob(test.pattern)
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if !reflect.DeepEqual(paths, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, paths, test.want)
+		}
+	}
+}
+
+func TestCgroupStat(t *testing.T) {
+	tests := []struct {
+		name string
+		fs *FS
+		path string
+		want *CgroupStat
+	}{
+		{"v2", GlobalCgroupV2FS, "/system.slice/docker.service", &CgroupStat{
+			Path: "/system.slice/docker.service",
+			CPUUsage: 52000000,
+			CPUUser: 40000000,
+			CPUSystem: 12000000,
+			NrPeriods: 1000,
+			NrThrottled: 25,
+			ThrottledTime: 350000,
+			MemoryCurrent: 209715200,
+			MemoryMax: 536870912,
+			MemoryEvents: map[string]uint64{"low": 0, "high": 3, "max": 7, "oom": 1, "oom_kill": 1},
+			IOReadBytes: 1500160,
+			IOWriteBytes: 314777600,
+			IOReads: 202,
+			IOWrites: 354,
+		}},
+		//Files of disabled controllers are skipped and "max" means no limit
+		{"v2_partial", GlobalCgroupV2FS, "/system.slice/nginx.service", &CgroupStat{
+			Path: "/system.slice/nginx.service",
+			CPUUsage: 1000,
+			CPUUser: 600,
+			CPUSystem: 400,
+			MemoryCurrent: 4096000,
+			MemoryEvents: map[string]uint64{},
+		}},
+		//Values are converted to the units of v2
+		{"v1", GlobalCgroupV1FS, "/docker/abc123", &CgroupStat{
+			Path: "/docker/abc123",
+			CPUUsage: 52000000,
+			CPUUser: 4000 * 1000000 / ClockTicks,
+			CPUSystem: 1200 * 1000000 / ClockTicks,
+			NrPeriods: 1000,
+			NrThrottled: 25,
+			ThrottledTime: 350000,
+			MemoryCurrent: 209715200,
+			MemoryMax: 536870912,
+			MemoryEvents: map[string]uint64{"oom_kill": 1, "max": 7},
+			IOReadBytes: 1500160,
+			IOWriteBytes: 314777600,
+			IOReads: 202,
+			IOWrites: 354,
+		}},
+		//Only in the memory hierarchy, the huge limit means no limit
+		{"v1_partial", GlobalCgroupV1FS, "/docker/def456", &CgroupStat{
+			Path: "/docker/def456",
+			MemoryCurrent: 1048576,
+			MemoryEvents: map[string]uint64{"oom_kill": 0, "max": 0},
+		}},
+	}
+
+	for _, test := range tests {
+		stat, err := test.fs.CgroupStat(test.path)
+
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if !reflect.DeepEqual(stat, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, stat, test.want)
+		}
+	}
+
+	for _, fs := range []*FS{GlobalCgroupV2FS, GlobalCgroupV1FS} {
+		_, err := fs.CgroupStat("/missing")
+
+		if err == nil {
+			t.Errorf("%s: missing cgroup should fail", fs.Root())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package procfs
+
+import (
+	"strings"
+)
+
+//Block device I/O statistics from /proc/diskstats
+type DiskStats struct {
+	Major uint64
+	Minor uint64
+	Name string
+	Reads uint64              //Reads completed
+	ReadMerged uint64         //Reads merged
+	ReadSectors uint64        //Sectors read, a sector is 512 bytes
+	ReadTime uint64           //Time spent reading in milliseconds
+	Writes uint64             //Writes completed
+	WriteMerged uint64        //Writes merged
+	WriteSectors uint64       //Sectors written, a sector is 512 bytes
+	WriteTime uint64          //Time spent writing in milliseconds
+	IOInProgress uint64       //I/Os currently in progress
+	IOTime uint64             //Time spent doing I/Os in milliseconds
+	WeightedIOTime uint64     //Weighted time spent doing I/Os in milliseconds
+}
+
+//Read /proc/diskstats
+func (fs *FS) DiskStats() ([]DiskStats, error) {
+	lines, err := fs.ReadLines("proc", "diskstats")
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []DiskStats{}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		if len(fields) < 14 {
+			continue
+		}
+
+		values, err := parseUints(append(fields[:2:2], fields[3:14]...))
+
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, DiskStats{
+			Major: values[0],
+			Minor: values[1],
+			Name: fields[2],
+			Reads: values[2],
+			ReadMerged: values[3],
+			ReadSectors: values[4],
+			ReadTime: values[5],
+			Writes: values[6],
+			WriteMerged: values[7],
+			WriteSectors: values[8],
+			WriteTime: values[9],
+			IOInProgress: values[10],
+			IOTime: values[11],
+			WeightedIOTime: values[12],
+		})
+	}
+
+	return stats, nil
+}
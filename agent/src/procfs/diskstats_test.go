@@ -0,0 +1,79 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+//Same counters of sda in each format
+var GlobalSda = DiskStats{
+	Major: 8,
+	Minor: 0,
+	Name: "sda",
+	Reads: 5136,
+	ReadMerged: 1539,
+	ReadSectors: 379702,
+	ReadTime: 3081,
+	Writes: 9416,
+	WriteMerged: 8539,
+	WriteSectors: 419336,
+	WriteTime: 11268,
+	IOTime: 11016,
+	WeightedIOTime: 15484,
+}
+
+var GlobalSda1 = DiskStats{
+	Major: 8,
+	Minor: 1,
+	Name: "sda1",
+	Reads: 4992,
+	ReadMerged: 1539,
+	ReadSectors: 371230,
+	ReadTime: 3043,
+	Writes: 9410,
+	WriteMerged: 8539,
+	WriteSectors: 419336,
+	WriteTime: 11266,
+	IOInProgress: 2,
+	IOTime: 10984,
+	WeightedIOTime: 14309,
+}
+
+func TestDiskStats(t *testing.T) {
+	tests := []struct {
+		name string
+		fs *FS
+		want []DiskStats
+	}{
+		//Since 5.5, discard fields and flush fields are appended
+		{"5.5", GlobalHostFS, []DiskStats{
+			{Major: 7, Minor: 0, Name: "loop0", Reads: 57, ReadSectors: 2148, ReadTime: 12, IOTime: 36, WeightedIOTime: 12},
+			GlobalSda,
+			GlobalSda1,
+			{Major: 259, Minor: 0, Name: "nvme0n1", Reads: 183294, ReadMerged: 3071, ReadSectors: 10234568, ReadTime: 48213, Writes: 917254, WriteMerged: 401123, WriteSectors: 42170352, WriteTime: 1298833, IOInProgress: 1, IOTime: 412311, WeightedIOTime: 1402180},
+		}},
+		//Since 4.18, discard fields are appended
+		{"4.18", NewFS("testdata/kernel4.18"), []DiskStats{GlobalSda, GlobalSda1}},
+		//Before 4.18, partitions of kernels before 2.6.25 have less fields and are skipped
+		{"4.4", NewFS("testdata/kernel4.4"), []DiskStats{GlobalSda, GlobalSda1}},
+	}
+
+	for _, test := range tests {
+		stats, err := test.fs.DiskStats()
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(stats, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, stats, test.want)
+		}
+	}
+
+	_, err := GlobalContainerFS.DiskStats()
+
+	if err == nil {
+		t.Errorf("missing diskstats should fail")
+	}
+}
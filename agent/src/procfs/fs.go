@@ -0,0 +1,107 @@
+package procfs
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//File system rooted at a path, /proc and /sys are read under the root path.
+//An agent in a container could read the host's /proc and /sys by mounting the host's / to the root path,
+//and fixture directories of captured /proc and /sys files could be read the same way.
+type FS struct {
+	root string          //Root path, default is "/"
+}
+
+func NewFS(root string) *FS {
+	if len(root) == 0 {
+		root = "/"
+	}
+
+	return &FS{
+		root: root,
+	}
+}
+
+//Get root path
+func (fs *FS) Root() string {
+	return fs.root
+}
+
+//Get path under the root path
+func (fs *FS) Path(elems ...string) string {
+	return filepath.Join(append([]string{fs.root}, elems...)...)
+}
+
+//Read file content as string with spaces trimmed
+func (fs *FS) ReadString(elems ...string) (string, error) {
+	content, err := ioutil.ReadFile(fs.Path(elems...))
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+//Read file content as lines, empty lines are skipped
+func (fs *FS) ReadLines(elems ...string) ([]string, error) {
+	content, err := ioutil.ReadFile(fs.Path(elems...))
+
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+//Read file content as int64
+func (fs *FS) ReadInt(elems ...string) (int64, error) {
+	content, err := fs.ReadString(elems...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(content, 10, 64)
+}
+
+//Read file content as uint64
+func (fs *FS) ReadUint(elems ...string) (uint64, error) {
+	content, err := fs.ReadString(elems...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(content, 10, 64)
+}
+
+//Parse fields as uint64 values, fields that could not be parsed are returned as error
+func parseUints(fields []string) ([]uint64, error) {
+	values := make([]uint64, len(fields))
+
+	for index, field := range fields {
+		value, err := strconv.ParseUint(field, 10, 64)
+
+		if err != nil {
+			return nil, errors.New("Parse '" + field + "' failed! error:" + err.Error())
+		}
+
+		values[index] = value
+	}
+
+	return values, nil
+}
@@ -0,0 +1,129 @@
+package procfs
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+//Host information
+type HostInfo struct {
+	OSName string             //e.g.:"Linux"
+	OSRelease string          //Kernel release, e.g.:"3.10.0-514.el7.x86_64"
+	OSVersion string          //Kernel version, e.g.:"#1 SMP Tue Nov 22 16:42:41 UTC 2016"
+	Platform string           //Machine hardware name, e.g.:"x86_64"
+	HostName string
+	NCPUs int                 //Online cpus
+	MaxCPUs int               //Possible cpus
+	BitWidth int
+}
+
+//Read host information from /proc/sys/kernel and /sys/devices/system/cpu
+func (fs *FS) HostInfo() (*HostInfo, error) {
+	var err error
+
+	hostInfo := &HostInfo{
+		BitWidth: strconv.IntSize,
+	}
+
+	hostInfo.OSName, err = fs.ReadString("proc", "sys", "kernel", "ostype")
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostInfo.OSRelease, err = fs.ReadString("proc", "sys", "kernel", "osrelease")
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostInfo.OSVersion, err = fs.ReadString("proc", "sys", "kernel", "version")
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostInfo.HostName, err = fs.ReadString("proc", "sys", "kernel", "hostname")
+
+	if err != nil {
+		return nil, err
+	}
+
+	//Machine hardware name is not in /proc, the running kernel is the host's kernel even in a container
+	var uname syscall.Utsname
+
+	err = syscall.Uname(&uname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	machine := make([]byte, 0, len(uname.Machine))
+
+	for _, char := range uname.Machine {
+		if char == 0 {
+			break
+		}
+
+		machine = append(machine, byte(char))
+	}
+
+	hostInfo.Platform = string(machine)
+
+	hostInfo.NCPUs, err = fs.cpuCount("online")
+
+	if err != nil {
+		return nil, err
+	}
+
+	hostInfo.MaxCPUs, err = fs.cpuCount("possible")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return hostInfo, nil
+}
+
+//Count cpus in cpu list file(e.g.:"0-3,5") of /sys/devices/system/cpu, fallback to count cpus in /proc/stat
+func (fs *FS) cpuCount(name string) (int, error) {
+	content, err := ioutil.ReadFile(fs.Path("sys", "devices", "system", "cpu", name))
+
+	if err != nil {
+		stat, err := fs.Stat()
+
+		if err != nil {
+			return 0, err
+		}
+
+		return len(stat.CPUs), nil
+	}
+
+	count := 0
+
+	for _, part := range strings.Split(strings.TrimSpace(string(content)), ",") {
+		bounds := strings.SplitN(part, "-", 2)
+
+		begin, err := strconv.Atoi(bounds[0])
+
+		if err != nil {
+			return 0, err
+		}
+
+		end := begin
+
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		count += end - begin + 1
+	}
+
+	return count, nil
+}
@@ -0,0 +1,68 @@
+package procfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+//Read /proc/meminfo, values with 'kB' unit are converted to bytes, key is the name before ':'
+func (fs *FS) MemInfo() (map[string]uint64, error) {
+	lines, err := fs.ReadLines("proc", "meminfo")
+
+	if err != nil {
+		return nil, err
+	}
+
+	memInfo := make(map[string]uint64)
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+
+		memInfo[strings.TrimSuffix(fields[0], ":")] = value
+	}
+
+	return memInfo, nil
+}
+
+//Read /proc/vmstat
+func (fs *FS) VMStat() (map[string]uint64, error) {
+	lines, err := fs.ReadLines("proc", "vmstat")
+
+	if err != nil {
+		return nil, err
+	}
+
+	vmStat := make(map[string]uint64)
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		if len(fields) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		vmStat[fields[0]] = value
+	}
+
+	return vmStat, nil
+}
@@ -0,0 +1,63 @@
+package procfs
+
+import (
+	"testing"
+)
+
+func TestMemInfo(t *testing.T) {
+	memInfo, err := GlobalHostFS.MemInfo()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key string
+		want uint64
+	}{
+		{"MemTotal", 8048488 * 1024},
+		{"MemFree", 371024 * 1024},
+		{"MemAvailable", 4101232 * 1024},
+		//Values without unit are not converted
+		{"HugePages_Total", 4},
+		{"Hugepagesize", 2048 * 1024},
+	}
+
+	for _, test := range tests {
+		if memInfo[test.key] != test.want {
+			t.Errorf("%s: got %d, want %d", test.key, memInfo[test.key], test.want)
+		}
+	}
+
+	if len(memInfo) != len(tests) {
+		t.Errorf("got %d keys, want %d", len(memInfo), len(tests))
+	}
+}
+
+func TestVMStat(t *testing.T) {
+	vmStat, err := GlobalHostFS.VMStat()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key string
+		want uint64
+	}{
+		{"nr_free_pages", 92756},
+		{"pgpgin", 2345678},
+		{"pswpout", 12},
+	}
+
+	for _, test := range tests {
+		if vmStat[test.key] != test.want {
+			t.Errorf("%s: got %d, want %d", test.key, vmStat[test.key], test.want)
+		}
+	}
+
+	//Lines not in 'name value' format are skipped
+	if len(vmStat) != len(tests) {
+		t.Errorf("got %d keys, want %d", len(vmStat), len(tests))
+	}
+}
@@ -0,0 +1,114 @@
+package procfs
+
+import (
+	"strings"
+	"syscall"
+)
+
+//Mount information from /proc/<pid>/mounts
+type Mount struct {
+	Device string
+	MountPoint string
+	FSType string
+	Options string
+}
+
+//Read mounts of pid 1 which are the host's mounts when the host's /proc is used, fallback to /proc/self/mounts
+func (fs *FS) Mounts() ([]Mount, error) {
+	lines, err := fs.ReadLines("proc", "1", "mounts")
+
+	if err != nil {
+		lines, err = fs.ReadLines("proc", "self", "mounts")
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mounts := []Mount{}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		if len(fields) < 4 {
+			continue
+		}
+
+		mounts = append(mounts, Mount{
+			Device: unescapeMountField(fields[0]),
+			MountPoint: unescapeMountField(fields[1]),
+			FSType: fields[2],
+			Options: fields[3],
+		})
+	}
+
+	return mounts, nil
+}
+
+//Unescape octal escaped characters(e.g.:'\040' for space) in mounts
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+
+	result := make([]byte, 0, len(field))
+
+	for index := 0; index < len(field); index++ {
+		if field[index] == '\\' && index + 3 < len(field) && isOctal(field[index + 1]) && isOctal(field[index + 2]) && isOctal(field[index + 3]) {
+			result = append(result, (field[index + 1] - '0') << 6 | (field[index + 2] - '0') << 3 | (field[index + 3] - '0'))
+			index += 3
+			continue
+		}
+
+		result = append(result, field[index])
+	}
+
+	return string(result)
+}
+
+func isOctal(char byte) bool {
+	return char >= '0' && char <= '7'
+}
+
+//File system usage in bytes and inodes
+type FSUsage struct {
+	Size uint64
+	Used uint64
+	Free uint64
+	Available uint64
+	TotalInodes uint64
+	UsedInodes uint64
+	FreeInodes uint64
+	AvailableInodes uint64
+}
+
+//Get file system usage of the mount point under the root path
+func (fs *FS) FSUsage(mountPoint string) (*FSUsage, error) {
+	var stat syscall.Statfs_t
+
+	err := syscall.Statfs(fs.Path(mountPoint), &stat)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := uint64(stat.Frsize)
+
+	if blockSize == 0 {
+		blockSize = uint64(stat.Bsize)
+	}
+
+	usage := &FSUsage{
+		Size: uint64(stat.Blocks) * blockSize,
+		Free: uint64(stat.Bfree) * blockSize,
+		Available: uint64(stat.Bavail) * blockSize,
+		TotalInodes: uint64(stat.Files),
+		FreeInodes: uint64(stat.Ffree),
+		AvailableInodes: uint64(stat.Ffree),
+	}
+
+	usage.Used = usage.Size - usage.Free
+	usage.UsedInodes = usage.TotalInodes - usage.FreeInodes
+
+	return usage, nil
+}
@@ -0,0 +1,60 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMounts(t *testing.T) {
+	tests := []struct {
+		name string
+		fs *FS
+		want []Mount
+	}{
+		{"host", GlobalHostFS, []Mount{
+			{Device: "/dev/sda1", MountPoint: "/", FSType: "ext4", Options: "rw,relatime"},
+			{Device: "proc", MountPoint: "/proc", FSType: "proc", Options: "rw,nosuid,nodev,noexec,relatime"},
+			{Device: "/dev/sdb1", MountPoint: "/mnt/my disk", FSType: "xfs", Options: "ro"},
+		}},
+		//Fallback to /proc/self/mounts
+		{"container", GlobalContainerFS, []Mount{
+			{Device: "/dev/vda1", MountPoint: "/", FSType: "overlay", Options: "rw"},
+		}},
+	}
+
+	for _, test := range tests {
+		mounts, err := test.fs.Mounts()
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(mounts, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, mounts, test.want)
+		}
+	}
+}
+
+func TestUnescapeMountField(t *testing.T) {
+	tests := []struct {
+		field string
+		want string
+	}{
+		{"/mnt/data", "/mnt/data"},
+		{"/mnt/my\\040disk", "/mnt/my disk"},
+		{"/mnt/tab\\011", "/mnt/tab\t"},
+		{"/mnt/back\\134slash", "/mnt/back\\slash"},
+		//Not octal escaped
+		{"/mnt/a\\89", "/mnt/a\\89"},
+		{"/mnt/a\\04", "/mnt/a\\04"},
+	}
+
+	for _, test := range tests {
+		got := unescapeMountField(test.field)
+
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.field, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package procfs
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+//Network interface counters from /proc/<pid>/net/dev
+type NetDev struct {
+	Name string
+	RxBytes uint64
+	RxPackets uint64
+	RxErrors uint64
+	RxDropped uint64
+	TxBytes uint64
+	TxPackets uint64
+	TxErrors uint64
+	TxDropped uint64
+	Collisions uint64
+}
+
+//Read /proc/1/net/dev
+func (fs *FS) NetDev() ([]NetDev, error) {
+	lines, err := fs.readNetLines("dev")
+
+	if err != nil {
+		return nil, err
+	}
+
+	devs := []NetDev{}
+
+	for _, line := range lines {
+		parts := strings.SplitN(line, ":", 2)
+
+		//Skip the header lines
+		if len(parts) != 2 {
+			continue
+		}
+
+		fields := strings.Fields(parts[1])
+
+		if len(fields) < 16 {
+			continue
+		}
+
+		values, err := parseUints(fields[:16])
+
+		if err != nil {
+			return nil, err
+		}
+
+		devs = append(devs, NetDev{
+			Name: strings.TrimSpace(parts[0]),
+			RxBytes: values[0],
+			RxPackets: values[1],
+			RxErrors: values[2],
+			RxDropped: values[3],
+			TxBytes: values[8],
+			TxPackets: values[9],
+			TxErrors: values[10],
+			TxDropped: values[11],
+			Collisions: values[13],
+		})
+	}
+
+	return devs, nil
+}
+
+//Read /proc/1/net/<name> which is in the host's network namespace when the host's /proc is used,
+//fallback to /proc/self/net/<name>. /proc/net is the network namespace of the agent itself.
+func (fs *FS) readNetLines(name string) ([]string, error) {
+	lines, err := fs.ReadLines("proc", "1", "net", name)
+
+	if err != nil {
+		return fs.ReadLines("proc", "self", "net", name)
+	}
+
+	return lines, nil
+}
+
+//Network interface link information from /sys/class/net
+type NetInterface struct {
+	Name string
+	Speed int64            //Speed in Mb/s, 0 if unknown
+	Duplex string          //"full", "half" or "unknown"
+	Up bool                //Is IFF_UP set in flags
+	OperState string       //Operational state, e.g.:"up", "down", "unknown"
+	MTU int64
+	Address string         //Hardware address
+	Carrier bool           //Is carrier detected
+	CarrierChanges uint64  //Carrier changes count, 0 if not supported
+}
+
+//Read /sys/class/net
+func (fs *FS) NetInterfaces() ([]NetInterface, error) {
+	infos, err := ioutil.ReadDir(fs.Path("sys", "class", "net"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := []NetInterface{}
+
+	for _, info := range infos {
+		name := info.Name()
+
+		netInterface := NetInterface{
+			Name: name,
+			Duplex: "unknown",
+			OperState: "unknown",
+		}
+
+		//Speed and duplex could not be read if the link is down
+		speed, err := fs.ReadInt("sys", "class", "net", name, "speed")
+
+		if err == nil && speed > 0 {
+			netInterface.Speed = speed
+		}
+
+		duplex, err := fs.ReadString("sys", "class", "net", name, "duplex")
+
+		if err == nil && len(duplex) != 0 {
+			netInterface.Duplex = duplex
+		}
+
+		flags, err := fs.ReadString("sys", "class", "net", name, "flags")
+
+		if err == nil {
+			value, err := strconv.ParseUint(strings.TrimPrefix(flags, "0x"), 16, 64)
+
+			if err == nil {
+				netInterface.Up = value & 0x1 != 0
+			}
+		}
+
+		operState, err := fs.ReadString("sys", "class", "net", name, "operstate")
+
+		if err == nil && len(operState) != 0 {
+			netInterface.OperState = operState
+		}
+
+		netInterface.MTU, _ = fs.ReadInt("sys", "class", "net", name, "mtu")
+		netInterface.Address, _ = fs.ReadString("sys", "class", "net", name, "address")
+
+		carrier, err := fs.ReadInt("sys", "class", "net", name, "carrier")
+
+		if err == nil {
+			netInterface.Carrier = carrier == 1
+		}
+
+		netInterface.CarrierChanges, _ = fs.ReadUint("sys", "class", "net", name, "carrier_changes")
+
+		interfaces = append(interfaces, netInterface)
+	}
+
+	return interfaces, nil
+}
@@ -0,0 +1,55 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetDev(t *testing.T) {
+	tests := []struct {
+		name string
+		fs *FS
+		want []NetDev
+	}{
+		{"host", GlobalHostFS, []NetDev{
+			{Name: "lo", RxBytes: 1000, RxPackets: 10, TxBytes: 1000, TxPackets: 10},
+			{Name: "eth0", RxBytes: 123456789, RxPackets: 98765, RxErrors: 1, RxDropped: 2, TxBytes: 987654321, TxPackets: 56789, TxErrors: 3, TxDropped: 4, Collisions: 7},
+		}},
+		//Fallback to /proc/self/net/dev
+		{"container", GlobalContainerFS, []NetDev{
+			{Name: "eth0", RxBytes: 500, RxPackets: 5, TxBytes: 600, TxPackets: 6},
+		}},
+	}
+
+	for _, test := range tests {
+		devs, err := test.fs.NetDev()
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(devs, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, devs, test.want)
+		}
+	}
+}
+
+func TestNetInterfaces(t *testing.T) {
+	interfaces, err := GlobalHostFS.NetInterfaces()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Sorted by name, missing files are left as default values
+	want := []NetInterface{
+		{Name: "eth0", Speed: 1000, Duplex: "full", Up: true, OperState: "up", MTU: 1500, Address: "52:54:00:12:34:56", Carrier: true, CarrierChanges: 3},
+		{Name: "lo", Duplex: "unknown", Up: true, OperState: "unknown", MTU: 65536, Address: "00:00:00:00:00:00", Carrier: true},
+		{Name: "veth0abc", Duplex: "unknown", OperState: "down", MTU: 1500},
+	}
+
+	if !reflect.DeepEqual(interfaces, want) {
+		t.Errorf("got %+v, want %+v", interfaces, want)
+	}
+}
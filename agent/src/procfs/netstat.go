@@ -0,0 +1,144 @@
+package procfs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//TCP states in /proc/<pid>/net/tcp
+var TCPStates = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0A: "LISTEN",
+	0x0B: "CLOSING",
+	0x0C: "NEW_SYN_RECV",
+}
+
+//Socket from /proc/<pid>/net/{tcp,tcp6,udp,udp6}
+type NetSocket struct {
+	LocalPort uint64
+	RemotePort uint64
+	State uint64             //State in hex, see TCPStates
+	TxQueue uint64
+	RxQueue uint64
+	Uid uint64
+	Inode uint64
+	Drops uint64             //Dropped packets, only for udp
+}
+
+//Read sockets from /proc/1/net/<name>, name is one of tcp, tcp6, udp and udp6
+func (fs *FS) NetSockets(name string) ([]NetSocket, error) {
+	lines, err := fs.readNetLines(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sockets := []NetSocket{}
+
+	//Skip the header line
+	for index := 1; index < len(lines); index++ {
+		fields := strings.Fields(lines[index])
+
+		if len(fields) < 10 {
+			continue
+		}
+
+		socket := NetSocket{}
+
+		socket.LocalPort, err = parseAddressPort(fields[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		socket.RemotePort, err = parseAddressPort(fields[2])
+
+		if err != nil {
+			return nil, err
+		}
+
+		socket.State, err = strconv.ParseUint(fields[3], 16, 64)
+
+		if err != nil {
+			return nil, errors.New("Parse socket state failed! error:" + err.Error())
+		}
+
+		queues := strings.SplitN(fields[4], ":", 2)
+
+		if len(queues) == 2 {
+			socket.TxQueue, _ = strconv.ParseUint(queues[0], 16, 64)
+			socket.RxQueue, _ = strconv.ParseUint(queues[1], 16, 64)
+		}
+
+		socket.Uid, _ = strconv.ParseUint(fields[7], 10, 64)
+		socket.Inode, _ = strconv.ParseUint(fields[9], 10, 64)
+
+		//Udp sockets have the drops column at the end
+		if strings.HasPrefix(name, "udp") && len(fields) >= 13 {
+			socket.Drops, _ = strconv.ParseUint(fields[12], 10, 64)
+		}
+
+		sockets = append(sockets, socket)
+	}
+
+	return sockets, nil
+}
+
+//Parse port from 'address:port' in hex
+func parseAddressPort(address string) (uint64, error) {
+	index := strings.LastIndexByte(address, ':')
+
+	if index < 0 {
+		return 0, errors.New("Parse address failed! address:" + address)
+	}
+
+	return strconv.ParseUint(address[index + 1:], 16, 64)
+}
+
+//Read protocol counters from /proc/1/net/<name>, name is snmp or netstat.
+//The file has pairs of lines, a header line followed by a value line with the same prefix, e.g.:
+//    Tcp: RtoAlgorithm RtoMin ...
+//    Tcp: 1 200 ...
+//The result is map of prefix(e.g.:"Tcp", "TcpExt") to map of counter name to value
+func (fs *FS) NetProtocolCounters(name string) (map[string]map[string]int64, error) {
+	lines, err := fs.readNetLines(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]map[string]int64)
+
+	for index := 0; index + 1 < len(lines); index += 2 {
+		names := strings.Fields(lines[index])
+		values := strings.Fields(lines[index + 1])
+
+		if len(names) != len(values) || len(names) == 0 || names[0] != values[0] {
+			return nil, errors.New("Parse " + name + " failed! line:" + lines[index])
+		}
+
+		prefix := strings.TrimSuffix(names[0], ":")
+		counters[prefix] = make(map[string]int64)
+
+		for column := 1; column < len(names); column++ {
+			value, err := strconv.ParseInt(values[column], 10, 64)
+
+			if err != nil {
+				continue
+			}
+
+			counters[prefix][names[column]] = value
+		}
+	}
+
+	return counters, nil
+}
@@ -0,0 +1,106 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetSockets(t *testing.T) {
+	tests := []struct {
+		name string
+		want []NetSocket
+	}{
+		{"tcp", []NetSocket{
+			{LocalPort: 3306, State: 0x0A, Uid: 999, Inode: 23456},
+			{LocalPort: 22, RemotePort: 54321, State: 0x01, TxQueue: 36, Inode: 34567},
+			{LocalPort: 80, RemotePort: 50000, State: 0x06},
+		}},
+		{"tcp6", []NetSocket{
+			{LocalPort: 8080, State: 0x0A, RxQueue: 16, Uid: 1000, Inode: 45678},
+			{LocalPort: 8080, RemotePort: 57554, State: 0x08, Uid: 1000, Inode: 56789},
+		}},
+		//Only udp sockets have drops
+		{"udp", []NetSocket{
+			{LocalPort: 68, State: 0x07, RxQueue: 256, Inode: 15432, Drops: 17},
+			{LocalPort: 53, State: 0x07, Uid: 101, Inode: 16543},
+		}},
+	}
+
+	for _, test := range tests {
+		sockets, err := GlobalHostFS.NetSockets(test.name)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(sockets, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, sockets, test.want)
+		}
+	}
+
+	if TCPStates[0x0A] != "LISTEN" || TCPStates[0x06] != "TIME_WAIT" {
+		t.Errorf("TCPStates invalid")
+	}
+}
+
+func TestParseAddressPort(t *testing.T) {
+	tests := []struct {
+		address string
+		want uint64
+		fail bool
+	}{
+		{"0100007F:0CEA", 3306, false},
+		{"0000000000000000FFFF00000100007F:1F90", 8080, false},
+		{"00000000:FFFF", 65535, false},
+		{"0100007F", 0, true},
+		{"0100007F:XYZ", 0, true},
+	}
+
+	for _, test := range tests {
+		port, err := parseAddressPort(test.address)
+
+		if (err != nil) != test.fail || port != test.want {
+			t.Errorf("%s: got %d, %v, want %d, fail %v", test.address, port, err, test.want, test.fail)
+		}
+	}
+}
+
+func TestNetProtocolCounters(t *testing.T) {
+	tests := []struct {
+		name string
+		want map[string]map[string]int64
+	}{
+		{"snmp", map[string]map[string]int64{
+			"Ip": {"Forwarding": 1, "DefaultTTL": 64, "InReceives": 123456},
+			"Tcp": {"RtoAlgorithm": 1, "RtoMin": 200, "RtoMax": 120000, "MaxConn": -1, "ActiveOpens": 3456, "CurrEstab": 12, "RetransSegs": 789},
+			"Udp": {"InDatagrams": 98765, "NoPorts": 21, "InErrors": 3, "RcvbufErrors": 2},
+		}},
+		{"netstat", map[string]map[string]int64{
+			"TcpExt": {"SyncookiesSent": 0, "ListenOverflows": 5, "ListenDrops": 7, "TCPTimeouts": 42},
+			"IpExt": {"InNoRoutes": 0, "InOctets": 123456789012},
+		}},
+	}
+
+	for _, test := range tests {
+		counters, err := GlobalHostFS.NetProtocolCounters(test.name)
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(counters, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, counters, test.want)
+		}
+	}
+
+	//Header and value lines not paired are rejected
+	for _, name := range []string{"snmp", "netstat"} {
+		_, err := GlobalContainerFS.NetProtocolCounters(name)
+
+		if err == nil {
+			t.Errorf("%s: unpaired lines should fail", name)
+		}
+	}
+}
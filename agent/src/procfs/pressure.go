@@ -0,0 +1,70 @@
+package procfs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//Pressure stall information of a resource from /proc/pressure
+type Pressure struct {
+	Avg10 float64             //Percentage of time stalled in last 10 seconds
+	Avg60 float64             //Percentage of time stalled in last 60 seconds
+	Avg300 float64            //Percentage of time stalled in last 300 seconds
+	Total uint64              //Total time stalled in microseconds
+}
+
+//Read /proc/pressure/<resource>, resource is cpu, memory or io, the result is keyed by 'some' and 'full'
+func (fs *FS) Pressure(resource string) (map[string]Pressure, error) {
+	lines, err := fs.ReadLines("proc", "pressure", resource)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pressures := make(map[string]Pressure)
+
+	for _, line := range lines {
+		//Format is 'some avg10=0.00 avg60=0.00 avg300=0.00 total=0'
+		fields := strings.Fields(line)
+
+		if len(fields) != 5 {
+			return nil, errors.New("Parse pressure line '" + line + "' failed!")
+		}
+
+		var pressure Pressure
+
+		for _, field := range fields[1:] {
+			pair := strings.SplitN(field, "=", 2)
+
+			if len(pair) != 2 {
+				return nil, errors.New("Parse pressure field '" + field + "' failed!")
+			}
+
+			if pair[0] == "total" {
+				pressure.Total, err = strconv.ParseUint(pair[1], 10, 64)
+			} else {
+				var value float64
+
+				value, err = strconv.ParseFloat(pair[1], 64)
+
+				switch pair[0] {
+				case "avg10":
+					pressure.Avg10 = value
+				case "avg60":
+					pressure.Avg60 = value
+				case "avg300":
+					pressure.Avg300 = value
+				}
+			}
+
+			if err != nil {
+				return nil, errors.New("Parse pressure field '" + field + "' failed! error:" + err.Error())
+			}
+		}
+
+		pressures[fields[0]] = pressure
+	}
+
+	return pressures, nil
+}
@@ -0,0 +1,57 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPressure(t *testing.T) {
+	tests := []struct {
+		fs *FS
+		resource string
+		want map[string]Pressure
+	}{
+		{GlobalHostFS, "cpu", map[string]Pressure{
+			"some": {Avg10: 1.53, Avg60: 0.87, Avg300: 0.33, Total: 12345678},
+			"full": {},
+		}},
+		{GlobalHostFS, "memory", map[string]Pressure{
+			"some": {Avg10: 0.25, Avg60: 0.10, Avg300: 0.05, Total: 456789},
+			"full": {Avg10: 0.12, Avg60: 0.05, Avg300: 0.01, Total: 234567},
+		}},
+		{GlobalHostFS, "io", map[string]Pressure{
+			"some": {Avg10: 12.50, Avg60: 8.25, Avg300: 3.00, Total: 98765432},
+			"full": {Avg10: 10.00, Avg60: 6.50, Avg300: 2.75, Total: 87654321},
+		}},
+		//Cpu has no 'full' line before kernel 5.13
+		{NewFS("testdata/kernel5.4"), "cpu", map[string]Pressure{
+			"some": {Avg60: 0.01, Avg300: 0.02, Total: 100},
+		}},
+	}
+
+	for _, test := range tests {
+		pressures, err := test.fs.Pressure(test.resource)
+
+		if err != nil {
+			t.Fatalf("%s: %s", test.resource, err)
+		}
+
+		if !reflect.DeepEqual(pressures, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.resource, pressures, test.want)
+		}
+	}
+
+	//Malformed line
+	_, err := NewFS("testdata/kernel5.4").Pressure("memory")
+
+	if err == nil {
+		t.Errorf("malformed pressure should fail")
+	}
+
+	//Kernel without CONFIG_PSI
+	_, err = GlobalContainerFS.Pressure("cpu")
+
+	if err == nil {
+		t.Errorf("missing pressure should fail")
+	}
+}
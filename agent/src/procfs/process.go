@@ -0,0 +1,266 @@
+package procfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//Type of the clock ticks entry in auxv
+const atClockTicks = 17
+
+//Clock ticks per second(USER_HZ) of times in /proc/<pid>/stat and cgroup v1 cpuacct.stat.
+//USER_HZ is the same for all processes of a kernel, so it is read from the agent's own auxv, 100 if could not be read.
+var ClockTicks = readClockTicks()
+
+//Read AT_CLKTCK from /proc/self/auxv which has pairs of type and value in native word size
+func readClockTicks() uint64 {
+	content, err := ioutil.ReadFile("/proc/self/auxv")
+
+	if err != nil {
+		return 100
+	}
+
+	size := strconv.IntSize / 8
+
+	for index := 0; index + size * 2 <= len(content); index += size * 2 {
+		var key, value uint64
+
+		if size == 8 {
+			key = binary.NativeEndian.Uint64(content[index:])
+			value = binary.NativeEndian.Uint64(content[index + size:])
+		} else {
+			key = uint64(binary.NativeEndian.Uint32(content[index:]))
+			value = uint64(binary.NativeEndian.Uint32(content[index + size:]))
+		}
+
+		if key == atClockTicks && value > 0 {
+			return value
+		}
+	}
+
+	return 100
+}
+
+//Process statistics from /proc/<pid>/stat
+type ProcessStat struct {
+	Pid int
+	Comm string
+	State string           //e.g.:"R" running, "S" sleeping, "D" disk sleep, "T" stopped, "Z" zombie
+	PPid int
+	MinorFaults uint64
+	MajorFaults uint64
+	UTime uint64           //User time in clock ticks, see ClockTicks
+	STime uint64           //System time in clock ticks, see ClockTicks
+	NumThreads int64
+	StartTime uint64       //Start time after boot in clock ticks, see ClockTicks
+	VSize uint64           //Virtual memory size in bytes
+	RSS int64              //Resident set size in pages
+}
+
+//Get all pids in /proc
+func (fs *FS) Pids() ([]int, error) {
+	infos, err := ioutil.ReadDir(fs.Path("proc"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	pids := []int{}
+
+	for _, info := range infos {
+		pid, err := strconv.Atoi(info.Name())
+
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		pids = append(pids, pid)
+	}
+
+	return pids, nil
+}
+
+//Read /proc/<pid>/stat
+func (fs *FS) ProcessStat(pid int) (*ProcessStat, error) {
+	content, err := fs.ReadString("proc", strconv.Itoa(pid), "stat")
+
+	if err != nil {
+		return nil, err
+	}
+
+	//Process name could contain spaces and brackets, so find the last ')'
+	begin := strings.IndexByte(content, '(')
+	end := strings.LastIndexByte(content, ')')
+
+	if begin < 0 || end < begin {
+		return nil, errors.New("Parse process stat failed! content:" + content)
+	}
+
+	fields := strings.Fields(content[end + 1:])
+
+	if len(fields) < 22 {
+		return nil, errors.New("Parse process stat failed! content:" + content)
+	}
+
+	stat := &ProcessStat{
+		Pid: pid,
+		Comm: content[begin + 1:end],
+		State: fields[0],
+	}
+
+	stat.PPid, _ = strconv.Atoi(fields[1])
+	stat.MinorFaults, _ = strconv.ParseUint(fields[7], 10, 64)
+	stat.MajorFaults, _ = strconv.ParseUint(fields[9], 10, 64)
+	stat.UTime, _ = strconv.ParseUint(fields[11], 10, 64)
+	stat.STime, _ = strconv.ParseUint(fields[12], 10, 64)
+	stat.NumThreads, _ = strconv.ParseInt(fields[17], 10, 64)
+	stat.StartTime, _ = strconv.ParseUint(fields[19], 10, 64)
+	stat.VSize, _ = strconv.ParseUint(fields[20], 10, 64)
+	stat.RSS, _ = strconv.ParseInt(fields[21], 10, 64)
+
+	return stat, nil
+}
+
+//Read /proc/<pid>/cmdline, arguments are separated by NUL
+func (fs *FS) ProcessCmdline(pid int) ([]string, error) {
+	content, err := ioutil.ReadFile(fs.Path("proc", strconv.Itoa(pid), "cmdline"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	args := strings.Split(strings.TrimRight(string(content), "\x00"), "\x00")
+
+	if len(args) == 1 && len(args[0]) == 0 {
+		return []string{}, nil
+	}
+
+	return args, nil
+}
+
+//Read /proc/<pid>/status, key is the name before ':' and value is the trimmed content after ':'
+func (fs *FS) ProcessStatus(pid int) (map[string]string, error) {
+	lines, err := fs.ReadLines("proc", strconv.Itoa(pid), "status")
+
+	if err != nil {
+		return nil, err
+	}
+
+	status := make(map[string]string)
+
+	for _, line := range lines {
+		pair := strings.SplitN(line, ":", 2)
+
+		if len(pair) != 2 {
+			continue
+		}
+
+		status[pair[0]] = strings.TrimSpace(pair[1])
+	}
+
+	return status, nil
+}
+
+//Read /proc/<pid>/io, e.g.:"read_bytes", "write_bytes", only readable by the owner of the process or root
+func (fs *FS) ProcessIO(pid int) (map[string]uint64, error) {
+	lines, err := fs.ReadLines("proc", strconv.Itoa(pid), "io")
+
+	if err != nil {
+		return nil, err
+	}
+
+	io := make(map[string]uint64)
+
+	for _, line := range lines {
+		pair := strings.SplitN(line, ":", 2)
+
+		if len(pair) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(strings.TrimSpace(pair[1]), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		io[pair[0]] = value
+	}
+
+	return io, nil
+}
+
+//Count open file descriptors in /proc/<pid>/fd, only readable by the owner of the process or root
+func (fs *FS) ProcessFDCount(pid int) (int, error) {
+	dir, err := os.Open(fs.Path("proc", strconv.Itoa(pid), "fd"))
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(names), nil
+}
+
+//Read cgroup paths in /proc/<pid>/cgroup, e.g.:"/system.slice/nginx.service"
+func (fs *FS) ProcessCgroups(pid int) ([]string, error) {
+	lines, err := fs.ReadLines("proc", strconv.Itoa(pid), "cgroup")
+
+	if err != nil {
+		return nil, err
+	}
+
+	cgroups := []string{}
+
+	for _, line := range lines {
+		//Format is 'hierarchy-ID:controller-list:cgroup-path'
+		fields := strings.SplitN(line, ":", 3)
+
+		if len(fields) != 3 {
+			continue
+		}
+
+		cgroups = append(cgroups, fields[2])
+	}
+
+	return cgroups, nil
+}
+
+//Lookup the uid of the user name in /etc/passwd, so users of the root path are resolved instead of the agent's
+func (fs *FS) LookupUid(name string) (string, error) {
+	lines, err := fs.ReadLines("etc", "passwd")
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range lines {
+		//Format is 'name:password:uid:gid:gecos:home:shell'
+		fields := strings.Split(line, ":")
+
+		if len(fields) < 3 || fields[0] != name {
+			continue
+		}
+
+		_, err := strconv.Atoi(fields[2])
+
+		if err != nil {
+			return "", errors.New("Parse passwd failed! line:" + line)
+		}
+
+		return fields[2], nil
+	}
+
+	return "", errors.New("Unknown user '" + name + "' in " + fs.Path("etc", "passwd"))
+}
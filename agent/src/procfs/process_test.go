@@ -0,0 +1,152 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClockTicks(t *testing.T) {
+	if ClockTicks == 0 {
+		t.Errorf("clock ticks should not be 0")
+	}
+}
+
+func TestPids(t *testing.T) {
+	pids, err := GlobalHostFS.Pids()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Files and non numeric names are skipped
+	want := []int{1, 1234}
+
+	if !reflect.DeepEqual(pids, want) {
+		t.Errorf("got %v, want %v", pids, want)
+	}
+}
+
+func TestProcessStat(t *testing.T) {
+	stat, err := GlobalHostFS.ProcessStat(1234)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Process name contains spaces and brackets
+	want := &ProcessStat{
+		Pid: 1234,
+		Comm: "tmux: (server) 1",
+		State: "S",
+		PPid: 1,
+		MinorFaults: 2571,
+		MajorFaults: 12,
+		UTime: 1500,
+		STime: 250,
+		NumThreads: 3,
+		StartTime: 120000,
+		VSize: 34390016,
+		RSS: 1195,
+	}
+
+	if !reflect.DeepEqual(stat, want) {
+		t.Errorf("got %+v, want %+v", stat, want)
+	}
+
+	_, err = GlobalHostFS.ProcessStat(1)
+
+	if err == nil {
+		t.Errorf("missing stat should fail")
+	}
+}
+
+func TestProcessFiles(t *testing.T) {
+	cmdline, err := GlobalHostFS.ProcessCmdline(1234)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := GlobalHostFS.ProcessStatus(1234)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io, err := GlobalHostFS.ProcessIO(1234)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fds, err := GlobalHostFS.ProcessFDCount(1234)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cgroups, err := GlobalHostFS.ProcessCgroups(1234)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got interface{}
+		want interface{}
+	}{
+		{"cmdline", cmdline, []string{"tmux", "new-session", "-d"}},
+		{"status_name", status["Name"], "tmux: server"},
+		{"status_uid", status["Uid"], "1000\t1000\t1000\t1000"},
+		{"status_voluntary", status["voluntary_ctxt_switches"], "1024"},
+		{"io_read_bytes", io["read_bytes"], uint64(8192)},
+		{"io_write_bytes", io["write_bytes"], uint64(4096)},
+		{"io_rchar", io["rchar"], uint64(4194304)},
+		{"fds", fds, 4},
+		{"cgroups", cgroups, []string{"/user.slice/user-1000.slice/session-1.scope", "/user.slice/user-1000.slice/session-1.scope", "/user.slice/user-1000.slice/session-1.scope"}},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLookupUid(t *testing.T) {
+	tests := []struct {
+		name string
+		uid string
+		fail bool
+	}{
+		{"root", "0", false},
+		{"deploy", "1000", false},
+		{"nginx", "101", false},
+		//Uid is not a number
+		{"broken", "", true},
+		{"unknown", "", true},
+	}
+
+	for _, test := range tests {
+		uid, err := GlobalHostFS.LookupUid(test.name)
+
+		if test.fail {
+			if err == nil {
+				t.Errorf("%s: should fail, got %s", test.name, uid)
+			}
+
+			continue
+		}
+
+		if err != nil || uid != test.uid {
+			t.Errorf("%s: got %s, %v, want %s", test.name, uid, err, test.uid)
+		}
+	}
+
+	_, err := GlobalContainerFS.LookupUid("root")
+
+	if err == nil {
+		t.Errorf("missing passwd should fail")
+	}
+}
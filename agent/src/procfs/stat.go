@@ -0,0 +1,158 @@
+package procfs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//CPU times in jiffies from /proc/stat
+type CPUTimes struct {
+	Name string           //"cpu" for total, "cpuN" for each core
+	User uint64
+	Nice uint64
+	System uint64
+	Idle uint64
+	IOWait uint64
+	IRQ uint64
+	SoftIRQ uint64
+	Steal uint64
+	Guest uint64
+	GuestNice uint64
+}
+
+//Get total jiffies, guest time is already counted in user and nice time
+func (times *CPUTimes) Total() uint64 {
+	return times.User + times.Nice + times.System + times.Idle + times.IOWait + times.IRQ + times.SoftIRQ + times.Steal
+}
+
+//Kernel statistics from /proc/stat
+type Stat struct {
+	Total CPUTimes         //Total times of all cpus
+	CPUs []CPUTimes        //Times of each cpu
+	BootTime int64         //Boot time in seconds since epoch
+	ProcessesRunning uint64
+	ProcessesBlocked uint64
+}
+
+//Read /proc/stat
+func (fs *FS) Stat() (*Stat, error) {
+	lines, err := fs.ReadLines("proc", "stat")
+
+	if err != nil {
+		return nil, err
+	}
+
+	stat := &Stat{
+		CPUs: []CPUTimes{},
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(fields[0], "cpu"):
+			values, err := parseUints(fields[1:])
+
+			if err != nil {
+				return nil, err
+			}
+
+			//Older kernels have less columns
+			for len(values) < 10 {
+				values = append(values, 0)
+			}
+
+			times := CPUTimes{
+				Name: fields[0],
+				User: values[0],
+				Nice: values[1],
+				System: values[2],
+				Idle: values[3],
+				IOWait: values[4],
+				IRQ: values[5],
+				SoftIRQ: values[6],
+				Steal: values[7],
+				Guest: values[8],
+				GuestNice: values[9],
+			}
+
+			if fields[0] == "cpu" {
+				stat.Total = times
+			} else {
+				stat.CPUs = append(stat.CPUs, times)
+			}
+		case fields[0] == "btime":
+			stat.BootTime, err = strconv.ParseInt(fields[1], 10, 64)
+
+			if err != nil {
+				return nil, errors.New("Parse btime failed! error:" + err.Error())
+			}
+		case fields[0] == "procs_running":
+			stat.ProcessesRunning, _ = strconv.ParseUint(fields[1], 10, 64)
+		case fields[0] == "procs_blocked":
+			stat.ProcessesBlocked, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	return stat, nil
+}
+
+//Load average from /proc/loadavg
+type LoadAvg struct {
+	Load1 float64
+	Load5 float64
+	Load15 float64
+}
+
+//Read /proc/loadavg
+func (fs *FS) LoadAvg() (*LoadAvg, error) {
+	content, err := fs.ReadString("proc", "loadavg")
+
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(content)
+
+	if len(fields) < 3 {
+		return nil, errors.New("Parse loadavg failed! content:" + content)
+	}
+
+	loads := make([]float64, 3)
+
+	for index := range loads {
+		loads[index], err = strconv.ParseFloat(fields[index], 64)
+
+		if err != nil {
+			return nil, errors.New("Parse loadavg failed! error:" + err.Error())
+		}
+	}
+
+	return &LoadAvg{
+		Load1: loads[0],
+		Load5: loads[1],
+		Load15: loads[2],
+	}, nil
+}
+
+//Read uptime in seconds from /proc/uptime
+func (fs *FS) Uptime() (float64, error) {
+	content, err := fs.ReadString("proc", "uptime")
+
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(content)
+
+	if len(fields) < 1 {
+		return 0, errors.New("Parse uptime failed! content:" + content)
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
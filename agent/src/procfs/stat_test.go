@@ -0,0 +1,62 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+//Fixtures of a host's /proc and /sys
+var GlobalHostFS = NewFS("testdata/host")
+
+//Fixtures of a container's /proc without pid 1
+var GlobalContainerFS = NewFS("testdata/container")
+
+func TestStat(t *testing.T) {
+	stat, err := GlobalHostFS.Stat()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got interface{}
+		want interface{}
+	}{
+		{"total", stat.Total, CPUTimes{Name: "cpu", User: 10132153, Nice: 290696, System: 3084719, Idle: 46828483, IOWait: 16683, SoftIRQ: 25195}},
+		{"cpu0", stat.CPUs[0], CPUTimes{Name: "cpu0", User: 1393280, Nice: 32966, System: 572056, Idle: 13343292, IOWait: 6130, SoftIRQ: 17875}},
+		//Older kernels have less columns
+		{"cpu1", stat.CPUs[1], CPUTimes{Name: "cpu1", User: 1335, Nice: 12, System: 1080, Idle: 22}},
+		{"cpus", len(stat.CPUs), 2},
+		{"btime", stat.BootTime, int64(1700000000)},
+		{"procs_running", stat.ProcessesRunning, uint64(3)},
+		{"procs_blocked", stat.ProcessesBlocked, uint64(1)},
+		{"cpu_total", stat.CPUs[1].Total(), uint64(2449)},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadAvg(t *testing.T) {
+	loadAvg, err := GlobalHostFS.LoadAvg()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &LoadAvg{Load1: 0.25, Load5: 0.5, Load15: 1.75}
+
+	if !reflect.DeepEqual(loadAvg, want) {
+		t.Errorf("got %+v, want %+v", loadAvg, want)
+	}
+
+	_, err = GlobalContainerFS.LoadAvg()
+
+	if err == nil {
+		t.Errorf("missing loadavg should fail")
+	}
+}
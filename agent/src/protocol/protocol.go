@@ -3,6 +3,7 @@ package protocol
 import "time"
 
 type Data struct {
+	Name string `json:"name,omitempty"`        //Optional, reported to measurement '<proto name>_<name>' instead of the proto name
 	Time string `json:"time"`
 	Tag map[string]interface{} `json:"tag"`
 	Field map[string]interface{} `json:"field"`
@@ -29,3 +30,12 @@ func NewProto(version int) *Proto {
 		DataList: []Data{},
 	}
 }
+
+//Get the measurement of the data, e.g.:"application" or "application_internal"
+func (proto *Proto) Measurement(data *Data) string {
+	if len(data.Name) == 0 {
+		return proto.Name
+	}
+
+	return proto.Name + "_" + data.Name
+}
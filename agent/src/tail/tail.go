@@ -0,0 +1,202 @@
+package tail
+
+import (
+	"io"
+	"os"
+	"strings"
+	"io/ioutil"
+)
+
+//Max bytes read in one call, the rest are read next call
+const MaxReadBytes = 16 * 1024 * 1024
+
+//Follow a file by path like 'tail -F', lines appended since last read are returned.
+//Rotated files are drained before the new file is opened, and truncated files are read from the beginning.
+type Tailer struct {
+	path string
+	fromEnd bool              //Start from the end of the file when it is opened the first time
+	file *os.File
+	info os.FileInfo          //File info when opened, used to detect rotation
+	offset int64              //Offset read to
+	partial string            //Incomplete last line, returned when completed
+}
+
+func NewTailer(path string, fromEnd bool) *Tailer {
+	return &Tailer{
+		path: path,
+		fromEnd: fromEnd,
+	}
+}
+
+//Get path
+func (tailer *Tailer) Path() string {
+	return tailer.path
+}
+
+//Get offset read to and file info of the opened file, info is nil if not opened
+func (tailer *Tailer) Position() (int64, os.FileInfo) {
+	return tailer.offset - int64(len(tailer.partial)), tailer.info
+}
+
+//Set offset to read from when the file is opened, read from the beginning if the file opened is not the same file
+func (tailer *Tailer) SetPosition(offset int64, info os.FileInfo) {
+	tailer.fromEnd = false
+	tailer.offset = offset
+	tailer.info = info
+}
+
+//Open the file
+func (tailer *Tailer) open() error {
+	file, err := os.Open(tailer.path)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	switch {
+	case tailer.fromEnd:
+		tailer.offset = info.Size()
+	case tailer.info != nil && os.SameFile(tailer.info, info) && tailer.offset <= info.Size():
+		//Continue from the position set
+	default:
+		tailer.offset = 0
+	}
+
+	tailer.fromEnd = false
+	tailer.file = file
+	tailer.info = info
+	tailer.partial = ""
+
+	return nil
+}
+
+//Read the opened file from offset to the end
+func (tailer *Tailer) readFile() ([]string, error) {
+	info, err := tailer.file.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	//Truncated
+	if info.Size() < tailer.offset {
+		tailer.offset = 0
+		tailer.partial = ""
+	}
+
+	_, err = tailer.file.Seek(tailer.offset, io.SeekStart)
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(tailer.file, MaxReadBytes))
+
+	if err != nil {
+		return nil, err
+	}
+
+	tailer.offset += int64(len(content))
+
+	text := tailer.partial + string(content)
+
+	index := strings.LastIndex(text, "\n")
+
+	if index < 0 {
+		tailer.partial = text
+		return nil, nil
+	}
+
+	tailer.partial = text[index + 1:]
+
+	lines := []string{}
+
+	for _, line := range strings.Split(text[:index], "\n") {
+		lines = append(lines, strings.TrimSuffix(line, "\r"))
+	}
+
+	return lines, nil
+}
+
+//Open the file if not opened, so lines appended from now on are read when starting from the end
+func (tailer *Tailer) Open() error {
+	if tailer.file != nil {
+		return nil
+	}
+
+	err := tailer.open()
+
+	//A file created later is read from the beginning
+	if os.IsNotExist(err) {
+		tailer.fromEnd = false
+	}
+
+	return err
+}
+
+//Read lines appended since last read, an error is returned if the file could not be opened
+func (tailer *Tailer) Read() ([]string, error) {
+	err := tailer.Open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := tailer.readFile()
+
+	if err != nil {
+		tailer.Close()
+		return nil, err
+	}
+
+	//Rotated, the old file is drained, read the new file from the beginning
+	info, err := os.Stat(tailer.path)
+
+	if err != nil || os.SameFile(tailer.info, info) {
+		return lines, nil
+	}
+
+	//Lines of the old file may be more than max bytes
+	current, err := tailer.file.Stat()
+
+	if err == nil && tailer.offset < current.Size() {
+		return lines, nil
+	}
+
+	if len(tailer.partial) != 0 {
+		lines = append(lines, tailer.partial)
+	}
+
+	tailer.Close()
+	tailer.info = nil
+
+	err = tailer.open()
+
+	if err != nil {
+		return lines, nil
+	}
+
+	newLines, err := tailer.readFile()
+
+	if err != nil {
+		tailer.Close()
+		return lines, nil
+	}
+
+	return append(lines, newLines...), nil
+}
+
+//Close the file, the file is opened again next read
+func (tailer *Tailer) Close() {
+	if tailer.file != nil {
+		tailer.file.Close()
+		tailer.file = nil
+	}
+}
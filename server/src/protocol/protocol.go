@@ -99,6 +99,18 @@ type Node struct {
 
 	Bitwith string `json:"bitwidth" bson:"bitwidth"`
 
+	KernelVersion string `json:"kernel_version" bson:"kernel_version"`
+	BootTime string `json:"boot_time" bson:"boot_time"`
+	MemTotal string `json:"mem_total" bson:"mem_total"`
+
+	MachineID string `json:"machine_id" bson:"machine_id"`
+	Vendor string `json:"vendor" bson:"vendor"`
+	Product string `json:"product" bson:"product"`
+	Virtualization string `json:"virtualization" bson:"virtualization"`
+
+	AgentVersion string `json:"agent_version" bson:"agent_version"`
+	ConfigHash string `json:"config_hash" bson:"config_hash"`
+
 	Time string `json:"time" bson:"time"`
 }
 
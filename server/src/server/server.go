@@ -406,6 +406,18 @@ func (server *MonitorServer) SyncMetaDataNode(duration time.Duration) {
 
 				nodeInMongo.Bitwith = node.Info["bitwidth"]
 
+				nodeInMongo.KernelVersion = node.Info["kernel_version"]
+				nodeInMongo.BootTime = node.Info["boot_time"]
+				nodeInMongo.MemTotal = node.Info["mem_total"]
+
+				nodeInMongo.MachineID = node.Info["machine_id"]
+				nodeInMongo.Vendor = node.Info["vendor"]
+				nodeInMongo.Product = node.Info["product"]
+				nodeInMongo.Virtualization = node.Info["virtualization"]
+
+				nodeInMongo.AgentVersion = node.Info["agent_version"]
+				nodeInMongo.ConfigHash = node.Info["config_hash"]
+
 				nodeInMongo.Time = node.Info["time"]
 
 				err = server.mongodb.AddNode(nodeInMongo)